@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"cookbook/internal/core"
+)
+
+// basicCacheTime is how long Basic credentials checked against a password
+// hash are remembered.  Clients like WebDAV send them with every request, and
+// bcrypt is slow on purpose.
+var basicCacheTime = 5 * time.Minute
+
+// Basic checks the credentials of clients that cannot sign in with a
+// browser: Basic authentication with a form based user and password, or with
+// a personal access token as the password, or a bearer token.
+type Basic struct {
+	state core.State
+
+	mu       sync.Mutex
+	verified map[[sha256.Size]byte]time.Time
+}
+
+func NewBasic(state core.State) *Basic {
+	return &Basic{state: state, verified: map[[sha256.Size]byte]time.Time{}}
+}
+
+// Role returns the role of the request's credentials, or "" when they are
+// missing or wrong.
+func (b *Basic) Role(r *http.Request) core.Role {
+	if BearerToken(r) != "" {
+		return RequestRole(b.state, r)
+	}
+	username, password, found := r.BasicAuth()
+	if !found || password == "" {
+		return ""
+	}
+	if token, ok := b.state.Tokens.Verify(password); ok {
+		return userRole(b.state, token.Owner, token.Role())
+	}
+	if b.password(username, password) {
+		return (*b.state.Config.FormBasedAuthUsers)[username].Role
+	}
+
+	// Slow down guessing, as the login form does.
+	time.Sleep(time.Duration(1+rand.Intn(3)) * time.Second)
+	return ""
+}
+
+func (b *Basic) password(username, password string) bool {
+	if b.state.Config.FormBasedAuthUsers == nil {
+		return false
+	}
+	user, ok := (*b.state.Config.FormBasedAuthUsers)[username]
+	if !ok {
+		return false
+	}
+	hash := user.Password
+	key := sha256.Sum256([]byte(username + "\x00" + password + "\x00" + hash))
+	now := time.Now()
+
+	b.mu.Lock()
+	expires, cached := b.verified[key]
+	b.mu.Unlock()
+	if cached && now.Before(expires) {
+		return true
+	}
+
+	if !ComparePasswordHash(hash, password) {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for k, expires := range b.verified {
+		if !now.Before(expires) {
+			delete(b.verified, k)
+		}
+	}
+	b.verified[key] = now.Add(basicCacheTime)
+	return true
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"cookbook/internal/core"
+)
+
+func TestBasicRole(t *testing.T) {
+	t.Parallel()
+
+	state := newTestState(t)
+	write := createToken(t, state, "alice", core.RoleAdmin, core.ScopeWrite)
+	read := createToken(t, state, "alice", core.RoleAdmin, core.ScopeRead)
+	demoted := createToken(t, state, "bob", core.RoleEditor, core.ScopeWrite)
+	basic := NewBasic(state)
+
+	// Wrong passwords are left out, they are slowed down on purpose.
+	for _, test := range []struct {
+		name     string
+		username string
+		password string
+		bearer   string
+		expected core.Role
+	}{
+		{name: "none", expected: ""},
+		{name: "admin password", username: "alice", password: "alice's password", expected: core.RoleAdmin},
+		{name: "viewer password", username: "bob", password: "bob's password", expected: core.RoleViewer},
+		{name: "admin password again, cached", username: "alice", password: "alice's password", expected: core.RoleAdmin},
+		{name: "empty password", username: "alice", expected: ""},
+		{name: "write token as password", username: "alice", password: write, expected: core.RoleAdmin},
+		{name: "read token as password", username: "anyone", password: read, expected: core.RoleViewer},
+		{name: "token of a demoted user as password", username: "bob", password: demoted, expected: core.RoleViewer},
+		{name: "bearer write token", bearer: write, expected: core.RoleAdmin},
+		{name: "bearer read token", bearer: read, expected: core.RoleViewer},
+		{name: "unknown bearer token", bearer: "cookbook_0123_secret", expected: ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("PROPFIND", "/dav/", nil)
+			if test.username != "" {
+				r.SetBasicAuth(test.username, test.password)
+			}
+			if test.bearer != "" {
+				r.Header.Set("Authorization", "Bearer "+test.bearer)
+			}
+			if role := basic.Role(r); role != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, role)
+			}
+		})
+	}
+}
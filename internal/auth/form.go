@@ -136,7 +136,7 @@ func AddFormBasedHandlers(state core.State, serveMux *http.ServeMux) {
 		}
 
 		users := *state.Config.FormBasedAuthUsers
-		if ComparePasswordHash(users[username], password) {
+		if ComparePasswordHash(users[username].Password, password) {
 			session, err := GetSession(state.SessionStore, r)
 			if err != nil {
 				if err.Error() == "securecookie: the value is not valid" {
@@ -25,26 +25,6 @@ func randString(nByte int) (string, error) {
 	return base64.RawURLEncoding.EncodeToString(b), nil
 }
 
-// ContainsAll returns true if all elements in subset exist in superset
-func ContainsAll(superset, subset []string) bool {
-	if len(subset) == 0 {
-		return true
-	}
-	for _, item := range subset {
-		found := false
-		for _, superItem := range superset {
-			if superItem == item {
-				found = true
-				break
-			}
-		}
-		if !found {
-			return false
-		}
-	}
-	return true
-}
-
 func setRandomCookie(w http.ResponseWriter, name string) string {
 	randString, err := randString(16)
 	if err != nil {
@@ -196,17 +176,24 @@ func AddOIDCBasedHandlers(state core.State, serveMux *http.ServeMux) {
 			return
 		}
 
-		var claims struct {
-			Sub    string   `json:"sub"`
-			Groups []string `json:"groups"`
-		}
+		var claims map[string]any
 		if err := json.Unmarshal(*resp.IDTokenClaims, &claims); err != nil {
 			slog.Error(err.Error())
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		sub, _ := claims["sub"].(string)
 
-		if state.Config.OIDC.GroupsClaim != nil && !ContainsAll(claims.Groups, *state.Config.OIDC.GroupsClaim) {
+		role := state.Config.OIDC.Role(claims)
+		// Tokens and share links follow the role of the last sign in.
+		if sub != "" {
+			if err := state.Users.SetRole(sub, role); err != nil {
+				slog.Error(err.Error())
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		if sub == "" || role == "" {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
@@ -217,7 +204,8 @@ func AddOIDCBasedHandlers(state core.State, serveMux *http.ServeMux) {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		session.Values["sub"] = claims.Sub
+		session.Values["sub"] = sub
+		session.Values["role"] = string(role)
 		err = session.Save(r, w)
 		if err != nil {
 			slog.Error(err.Error())
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"encoding/json"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"cookbook/internal/core"
+)
+
+// RequireLoginToView guards every route of next for Server.RequireLoginToView,
+// except the login routes under the auth mount point, the files in the static
+// directory, share links, and WebDAV, which has its own authentication.  Browsers are
+// redirected to the login page, which returns them to the page they asked
+// for.
+func RequireLoginToView(state core.State, static fs.FS, next http.Handler) http.Handler {
+	assets := map[string]bool{}
+	err := fs.WalkDir(static, ".", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			assets["/"+path] = true
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path
+		public := assets[path] ||
+			strings.HasPrefix(path, state.Auth.MountPoint+"/") ||
+			strings.HasPrefix(path, "/share/") ||
+			strings.HasPrefix(path, "/dav/")
+		if public || RequestRole(state, r).Can(core.PermissionView) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		switch {
+		case strings.HasPrefix(path, "/api/"):
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": http.StatusText(http.StatusUnauthorized)})
+		case r.Method == "GET" || r.Method == "HEAD":
+			loginURL := state.Auth.LoginUrl + "?return_to=" + url.QueryEscape(r.URL.RequestURI())
+			if r.Header.Get("HX-Request") == "true" {
+				// Redirect the whole page, not the fragment htmx asked for.
+				w.Header().Set("HX-Redirect", loginURL)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			http.Redirect(w, r, loginURL, http.StatusSeeOther)
+		default:
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRequireLoginToView(t *testing.T) {
+	t.Parallel()
+
+	state := newTestState(t)
+	static := fstest.MapFS{
+		"style.css":     {Data: []byte("body {}")},
+		"icons/pan.svg": {Data: []byte("<svg/>")},
+	}
+	handler := RequireLoginToView(state, static, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	for _, test := range []struct {
+		name     string
+		method   string
+		path     string
+		user     string
+		htmx     bool
+		expected int
+		location string // of the redirect, or HX-Redirect
+	}{
+		{name: "asset", path: "/style.css", expected: http.StatusTeapot},
+		{name: "nested asset", path: "/icons/pan.svg", expected: http.StatusTeapot},
+		{name: "login", path: "/auth/login", expected: http.StatusTeapot},
+		{name: "mount point without a route", path: "/authors", expected: http.StatusSeeOther, location: "/auth/login?return_to=%2Fauthors"},
+		{name: "share link", path: "/share/abc", expected: http.StatusTeapot},
+		{name: "WebDAV", method: "PROPFIND", path: "/dav/", expected: http.StatusTeapot},
+		{name: "signed in", path: "/recipe/SquashSoup", user: "bob", expected: http.StatusTeapot},
+		{name: "signed in, removed", path: "/recipe/SquashSoup", user: "carol", expected: http.StatusSeeOther, location: "/auth/login?return_to=%2Frecipe%2FSquashSoup"},
+		{name: "page", path: "/recipe/SquashSoup?scale=2", expected: http.StatusSeeOther, location: "/auth/login?return_to=%2Frecipe%2FSquashSoup%3Fscale%3D2"},
+		{name: "head", method: "HEAD", path: "/", expected: http.StatusSeeOther, location: "/auth/login?return_to=%2F"},
+		{name: "htmx", path: "/search?q=soup", htmx: true, expected: http.StatusUnauthorized, location: "/auth/login?return_to=%2Fsearch%3Fq%3Dsoup"},
+		{name: "post", method: "POST", path: "/recipe/SquashSoup/edit", expected: http.StatusUnauthorized},
+		{name: "API", path: "/api/v1/recipes", expected: http.StatusUnauthorized},
+		{name: "API post", method: "POST", path: "/api/v1/recipes", expected: http.StatusUnauthorized},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(test.method, test.path, nil)
+			if test.user != "" {
+				signIn(t, state, r, test.user, "")
+			}
+			if test.htmx {
+				r.Header.Set("HX-Request", "true")
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, r)
+
+			if rec.Code != test.expected {
+				t.Fatalf("expected %d, got %d", test.expected, rec.Code)
+			}
+			location := rec.Header().Get("Location")
+			if test.htmx {
+				location = rec.Header().Get("HX-Redirect")
+			}
+			if location != test.location {
+				t.Errorf("expected to be sent to %q, got %q", test.location, location)
+			}
+		})
+	}
+}
+
+func TestRequireLoginToViewAPIError(t *testing.T) {
+	t.Parallel()
+
+	state := newTestState(t)
+	handler := RequireLoginToView(state, fstest.MapFS{}, http.NotFoundHandler())
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/recipes", nil))
+
+	if contentType := rec.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("expected a JSON error, got %q", contentType)
+	}
+	var body struct{ Error string }
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Error != http.StatusText(http.StatusUnauthorized) {
+		t.Errorf("expected the status as the error, got %q", body.Error)
+	}
+}
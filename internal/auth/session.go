@@ -1,6 +1,8 @@
 package auth
 
 import (
+	"cmp"
+	"cookbook/internal/core"
 	"encoding/hex"
 	"log"
 	"log/slog"
@@ -46,16 +48,68 @@ func GetSession(store *sessions.CookieStore, r *http.Request) (*sessions.Session
 	return store.Get(r, sessionKey)
 }
 
-func IsAuthenticated(store *sessions.CookieStore, r *http.Request) bool {
-	session, err := GetSession(store, r)
+// RequestRole returns the role of the user of the request, from its bearer
+// token or its session, or "" when it has neither.  The session is not used
+// for requests with a token.
+func RequestRole(state core.State, r *http.Request) core.Role {
+	if secret := BearerToken(r); secret != "" {
+		token, ok := state.Tokens.Verify(secret)
+		if !ok {
+			return ""
+		}
+		return userRole(state, token.Owner, token.Role())
+	}
+
+	session, err := GetSession(state.SessionStore, r)
 	if err != nil {
 		if err.Error() == "securecookie: the value is not valid" {
-			ClearSession(store, r, nil)
-			return false
+			ClearSession(state.SessionStore, r, nil)
 		} else {
 			slog.Error(err.Error())
-			return false
 		}
+		return ""
+	}
+	sub, _ := session.Values["sub"].(string)
+	if sub == "" {
+		return ""
+	}
+	role, _ := session.Values["role"].(string)
+	return userRole(state, sub, core.Role(role))
+}
+
+// userRole returns role, limited to the current role of the user sub, which
+// may have changed since they signed in or created a token: the configured
+// role of form based users, or the role of OIDC users at their last sign in.
+// Users who no longer exist have no role.
+func userRole(state core.State, sub string, role core.Role) core.Role {
+	if state.Config.FormBasedAuthUsers != nil {
+		user, ok := (*state.Config.FormBasedAuthUsers)[sub]
+		if !ok {
+			return ""
+		}
+		return user.Role.Min(cmp.Or(role, core.RoleAdmin))
+	}
+	if state.Users != nil {
+		return state.Users.Role(sub).Min(cmp.Or(role, core.RoleAdmin))
+	}
+	if !role.Valid() {
+		return ""
+	}
+	return role
+}
+
+// UserRole returns the current role of the user sub, "" when they no longer
+// exist, ex. to check the owner of a share link.
+func UserRole(state core.State, sub string) core.Role {
+	return userRole(state, sub, "")
+}
+
+// Subject returns the user signed in to the session, or "".
+func Subject(store *sessions.CookieStore, r *http.Request) string {
+	session, err := GetSession(store, r)
+	if err != nil {
+		return ""
 	}
-	return session.Values["sub"] != nil
+	sub, _ := session.Values["sub"].(string)
+	return sub
 }
@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cookbook/internal/core"
+)
+
+// newTestState returns the state of a cookbook with the form based users
+// alice, an admin, and bob, a viewer, and a tokens file.
+func newTestState(t *testing.T) core.State {
+	t.Helper()
+
+	var state core.State
+	state.Config.FormBasedAuthUsers = &map[string]core.FormUser{
+		"alice": {Password: HashPassword([]byte("alice's password")), Role: core.RoleAdmin},
+		"bob":   {Password: HashPassword([]byte("bob's password")), Role: core.RoleViewer},
+	}
+	state.Auth = core.Auth{AuthInfo: core.NewAuthInfo("/auth")}
+	state.SessionStore = NewSessionStore([]string{"0123456789abcdef0123456789abcdef"}, false)
+	tokens, err := core.NewTokens(filepath.Join(t.TempDir(), "tokens.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.Tokens = tokens
+	return state
+}
+
+// signIn adds the session cookie of user sub, signed in with role, to r.
+func signIn(t *testing.T, state core.State, r *http.Request, sub string, role core.Role) {
+	t.Helper()
+
+	session, err := GetSession(state.SessionStore, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.Values["sub"] = sub
+	if role != "" {
+		session.Values["role"] = string(role)
+	}
+	rec := httptest.NewRecorder()
+	if err := session.Save(r, rec); err != nil {
+		t.Fatal(err)
+	}
+	for _, cookie := range rec.Result().Cookies() {
+		r.AddCookie(cookie)
+	}
+}
+
+// createToken returns a new token of owner, who has role.
+func createToken(t *testing.T, state core.State, owner string, role core.Role, scope core.TokenScope) string {
+	t.Helper()
+
+	secret, _, err := state.Tokens.Create(owner, role, "test", scope, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return secret
+}
+
+func TestRequestRole(t *testing.T) {
+	t.Parallel()
+
+	state := newTestState(t)
+	adminWrite := createToken(t, state, "alice", core.RoleAdmin, core.ScopeWrite)
+	adminRead := createToken(t, state, "alice", core.RoleAdmin, core.ScopeRead)
+	// Bob was an editor when he created the token.
+	demoted := createToken(t, state, "bob", core.RoleEditor, core.ScopeWrite)
+	removed := createToken(t, state, "carol", core.RoleAdmin, core.ScopeWrite)
+
+	for _, test := range []struct {
+		name     string
+		sub      string
+		role     core.Role // of the session
+		token    string
+		expected core.Role
+	}{
+		{name: "anonymous", expected: ""},
+		{name: "form admin", sub: "alice", expected: core.RoleAdmin},
+		{name: "form viewer", sub: "bob", expected: core.RoleViewer},
+		{name: "form viewer with a stale role", sub: "bob", role: core.RoleAdmin, expected: core.RoleViewer},
+		{name: "removed form user", sub: "carol", expected: ""},
+		{name: "write token", token: adminWrite, expected: core.RoleAdmin},
+		{name: "read token", token: adminRead, expected: core.RoleViewer},
+		{name: "token of a demoted user", token: demoted, expected: core.RoleViewer},
+		{name: "token of a removed user", token: removed, expected: ""},
+		{name: "unknown token", token: "cookbook_0123_secret", expected: ""},
+		{name: "token takes precedence over session", sub: "alice", token: adminRead, expected: core.RoleViewer},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			if test.sub != "" {
+				signIn(t, state, r, test.sub, test.role)
+			}
+			if test.token != "" {
+				r.Header.Set("Authorization", "Bearer "+test.token)
+			}
+			if role := RequestRole(state, r); role != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, role)
+			}
+		})
+	}
+}
+
+func TestUserRole(t *testing.T) {
+	t.Parallel()
+
+	users, err := core.NewUsers(filepath.Join(t.TempDir(), "users.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := users.SetRole("dave", core.RoleEditor); err != nil {
+		t.Fatal(err)
+	}
+
+	formBased := newTestState(t)
+	var oidc core.State
+	oidc.Users = users
+	var legacy core.State
+
+	for _, test := range []struct {
+		name     string
+		state    core.State
+		sub      string
+		role     core.Role
+		expected core.Role
+	}{
+		{name: "form user", state: formBased, sub: "alice", expected: core.RoleAdmin},
+		{name: "form user limited by role", state: formBased, sub: "alice", role: core.RoleViewer, expected: core.RoleViewer},
+		{name: "form user limited by config", state: formBased, sub: "bob", role: core.RoleEditor, expected: core.RoleViewer},
+		{name: "removed form user", state: formBased, sub: "carol", role: core.RoleAdmin, expected: ""},
+		{name: "OIDC user", state: oidc, sub: "dave", expected: core.RoleEditor},
+		{name: "OIDC user limited by last sign in", state: oidc, sub: "dave", role: core.RoleAdmin, expected: core.RoleEditor},
+		{name: "OIDC user limited by role", state: oidc, sub: "dave", role: core.RoleViewer, expected: core.RoleViewer},
+		{name: "OIDC user who no longer signs in", state: oidc, sub: "erin", role: core.RoleAdmin, expected: ""},
+		{name: "without users", state: legacy, sub: "frank", role: core.RoleEditor, expected: core.RoleEditor},
+		{name: "without users, unknown role", state: legacy, sub: "frank", role: "chef", expected: ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if role := userRole(test.state, test.sub, test.role); role != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, role)
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+package core
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"cookbook/internal/search"
+
+	"github.com/gorilla/securecookie"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// ParseURLList returns the http(s) URLs found in a pasted list, one per line.
+// Blank lines, comments starting with # and duplicates are skipped.
+func ParseURLList(list string) ([]string, error) {
+	urls := []string{}
+	seen := map[string]bool{}
+	for _, line := range strings.Split(list, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		u, err := url.Parse(line)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid url: %s", line)
+		}
+		if !seen[line] {
+			seen[line] = true
+			urls = append(urls, line)
+		}
+	}
+	return urls, nil
+}
+
+type sitemap struct {
+	URLs     []string `xml:"url>loc"`
+	Sitemaps []string `xml:"sitemap>loc"`
+}
+
+// SitemapURLs fetches a sitemap, or a sitemap index one level deep, and returns
+// the page URLs whose path matches pattern.  A nil pattern matches everything.
+func SitemapURLs(ctx context.Context, request Request, sitemapURL string, pattern *regexp.Regexp) ([]string, error) {
+	fetch := func(u string) (*sitemap, error) {
+		readCloser, err := request(ctx, u)
+		if err != nil {
+			return nil, err
+		}
+		defer readCloser.Close()
+		var sm sitemap
+		if err := xml.NewDecoder(readCloser).Decode(&sm); err != nil {
+			return nil, fmt.Errorf("error parsing sitemap %s: %v", u, err)
+		}
+		return &sm, nil
+	}
+
+	root, err := fetch(sitemapURL)
+	if err != nil {
+		return nil, err
+	}
+
+	locs := root.URLs
+	for _, child := range root.Sitemaps {
+		sm, err := fetch(strings.TrimSpace(child))
+		if err != nil {
+			return nil, err
+		}
+		locs = append(locs, sm.URLs...)
+	}
+
+	urls := []string{}
+	seen := map[string]bool{}
+	for _, loc := range locs {
+		loc = strings.TrimSpace(loc)
+		u, err := url.Parse(loc)
+		if err != nil || seen[loc] {
+			continue
+		}
+		if pattern != nil && !pattern.MatchString(u.Path) {
+			continue
+		}
+		seen[loc] = true
+		urls = append(urls, loc)
+	}
+	return urls, nil
+}
+
+type BulkImportResult struct {
+	URL     string
+	Draft   string
+	Skipped bool
+	Err     error
+}
+
+type BulkImportOptions struct {
+	Concurrency int
+	Interval    time.Duration
+	Import      ImportOptions
+	// Skip reports whether a url has already been imported.
+	Skip func(url string) bool
+	// Save stores an imported recipe and returns the name of the draft.
+	Save func(url string, recipe *Recipe) (string, error)
+}
+
+// BulkImport runs Import for each url, starting at most one import per
+// Interval with at most Concurrency imports in flight.  Results are reported
+// through the result callback in completion order.
+func BulkImport(
+	ctx context.Context,
+	llm llms.Model,
+	request Request,
+	urls []string,
+	opts BulkImportOptions,
+	result func(BulkImportResult),
+) {
+	concurrency := max(opts.Concurrency, 1)
+	interval := max(opts.Interval, time.Millisecond)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i, u := range urls {
+		if opts.Skip != nil && opts.Skip(u) {
+			result(BulkImportResult{URL: u, Skipped: true})
+			continue
+		}
+
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+			case <-ticker.C:
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			result(BulkImportResult{URL: u, Err: ctx.Err()})
+			continue
+		case sem <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(u string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			recipe, err := Import(ctx, llm, request, u, opts.Import)
+			if err == nil && recipe == nil {
+				err = fmt.Errorf("no recipe found")
+			}
+			res := BulkImportResult{URL: u, Err: err}
+			if err == nil {
+				res.Draft, res.Err = opts.Save(u, recipe)
+			}
+			if res.Err != nil {
+				slog.Error("bulk import", "url", u, "error", res.Err)
+			}
+			result(res)
+		}(u)
+	}
+
+	wg.Wait()
+}
+
+type BulkImportJob struct {
+	ID      string
+	Total   int
+	mu      sync.Mutex
+	results []BulkImportResult
+	done    bool
+	// finished is when the job finished, finished jobs are forgotten after
+	// bulkImportJobTTL.
+	finished time.Time
+}
+
+func (j *BulkImportJob) add(result BulkImportResult) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.results = append(j.results, result)
+}
+
+func (j *BulkImportJob) finish() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.done = true
+	j.finished = time.Now()
+}
+
+// expired reports whether the job finished more than bulkImportJobTTL before
+// now.
+func (j *BulkImportJob) expired(now time.Time) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.done && now.Sub(j.finished) > bulkImportJobTTL
+}
+
+// Status returns a copy of the results so far and whether the job finished.
+func (j *BulkImportJob) Status() ([]BulkImportResult, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return append([]BulkImportResult(nil), j.results...), j.done
+}
+
+// bulkImportJobTTL is how long the status of a finished job can be checked.
+var bulkImportJobTTL = time.Hour
+
+type BulkImportJobs struct {
+	mu   sync.Mutex
+	jobs map[string]*BulkImportJob
+}
+
+func NewBulkImportJobs() *BulkImportJobs {
+	return &BulkImportJobs{jobs: map[string]*BulkImportJob{}}
+}
+
+func (b *BulkImportJobs) Get(id string) *BulkImportJob {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expire()
+	return b.jobs[id]
+}
+
+func (b *BulkImportJobs) add(job *BulkImportJob) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expire()
+	b.jobs[job.ID] = job
+}
+
+// expire forgets the jobs that finished more than bulkImportJobTTL ago.
+func (b *BulkImportJobs) expire() {
+	now := time.Now()
+	for id, job := range b.jobs {
+		if job.expired(now) {
+			delete(b.jobs, id)
+		}
+	}
+}
+
+// StartBulkImport imports urls in the background, saving each recipe as a
+// draft.  Urls imported before, or the source of an existing recipe, are
+// skipped.
+func (s *State) StartBulkImport(llm llms.Model, request Request, urls []string) *BulkImportJob {
+	job := &BulkImportJob{
+		ID:    fmt.Sprintf("%x", securecookie.GenerateRandomKey(8)),
+		Total: len(urls),
+	}
+
+	s.BulkImports.add(job)
+
+	imported := s.ImportedURLs()
+
+	go func() {
+		BulkImport(context.Background(), llm, request, urls, BulkImportOptions{
+			Concurrency: s.Config.Import.Concurrency,
+			Interval:    s.Config.Import.Interval,
+			Import:      s.ImportOptions(),
+			Skip: func(u string) bool {
+				if imported[u] {
+					return true
+				}
+				found, err := search.HasSource(s.Index, u)
+				if err != nil {
+					slog.Error(err.Error())
+				}
+				return found
+			},
+			Save: s.SaveDraft,
+		}, job.add)
+		job.finish()
+		s.Webhooks.ImportCompleted(job)
+	}()
+
+	return job
+}
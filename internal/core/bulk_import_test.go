@@ -0,0 +1,81 @@
+package core
+
+import (
+	"context"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSitemapURLs(t *testing.T) {
+	t.Parallel()
+
+	pages := map[string]string{
+		"https://example.com/sitemap.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>https://example.com/sitemap-1.xml</loc></sitemap>
+</sitemapindex>`,
+		"https://example.com/sitemap-1.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>https://example.com/recipes/soup</loc></url>
+  <url><loc>https://example.com/about</loc></url>
+  <url><loc> https://example.com/recipes/bread </loc></url>
+  <url><loc>https://example.com/recipes/soup</loc></url>
+</urlset>`,
+	}
+
+	request := func(_ context.Context, url string) (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(pages[url])), nil
+	}
+
+	urls, err := SitemapURLs(context.Background(), request, "https://example.com/sitemap.xml", regexp.MustCompile("^/recipes/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"https://example.com/recipes/soup", "https://example.com/recipes/bread"}
+	if !slices.Equal(urls, expected) {
+		t.Errorf("expected %q, got %q", expected, urls)
+	}
+}
+
+func TestParseURLList(t *testing.T) {
+	t.Parallel()
+
+	urls, err := ParseURLList("https://example.com/a\n\n# comment\n https://example.com/b \nhttps://example.com/a\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"https://example.com/a", "https://example.com/b"}
+	if !slices.Equal(urls, expected) {
+		t.Errorf("expected %q, got %q", expected, urls)
+	}
+
+	if _, err := ParseURLList("not a url"); err == nil {
+		t.Error("expected error for invalid url")
+	}
+}
+
+func TestBulkImportJobsExpire(t *testing.T) {
+	t.Parallel()
+
+	jobs := NewBulkImportJobs()
+	running := &BulkImportJob{ID: "running"}
+	finished := &BulkImportJob{ID: "finished"}
+	old := &BulkImportJob{ID: "old"}
+	for _, job := range []*BulkImportJob{running, finished, old} {
+		jobs.add(job)
+	}
+	finished.finish()
+	old.finish()
+	old.finished = time.Now().Add(-bulkImportJobTTL - time.Minute)
+
+	for id, want := range map[string]bool{"running": true, "finished": true, "old": false} {
+		if got := jobs.Get(id) != nil; got != want {
+			t.Errorf("job %s: expected kept %v, got %v", id, want, got)
+		}
+	}
+}
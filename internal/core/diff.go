@@ -0,0 +1,62 @@
+package core
+
+import "strings"
+
+type DiffOp string
+
+const (
+	DiffEqual  DiffOp = "equal"
+	DiffInsert DiffOp = "insert"
+	DiffDelete DiffOp = "delete"
+)
+
+type DiffLine struct {
+	Op   DiffOp
+	Text string
+}
+
+// DiffLines returns the line by line differences turning a into b, using the
+// longest common subsequence of lines.
+func DiffLines(a, b string) []DiffLine {
+	as := strings.Split(strings.TrimRight(a, "\n"), "\n")
+	bs := strings.Split(strings.TrimRight(b, "\n"), "\n")
+
+	// lcs[i][j] is the length of the longest common subsequence of as[i:] and bs[j:]
+	lcs := make([][]int, len(as)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bs)+1)
+	}
+	for i := len(as) - 1; i >= 0; i-- {
+		for j := len(bs) - 1; j >= 0; j-- {
+			if as[i] == bs[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	diff := []DiffLine{}
+	i, j := 0, 0
+	for i < len(as) && j < len(bs) {
+		switch {
+		case as[i] == bs[j]:
+			diff = append(diff, DiffLine{DiffEqual, as[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, DiffLine{DiffDelete, as[i]})
+			i++
+		default:
+			diff = append(diff, DiffLine{DiffInsert, bs[j]})
+			j++
+		}
+	}
+	for ; i < len(as); i++ {
+		diff = append(diff, DiffLine{DiffDelete, as[i]})
+	}
+	for ; j < len(bs); j++ {
+		diff = append(diff, DiffLine{DiffInsert, bs[j]})
+	}
+	return diff
+}
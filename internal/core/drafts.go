@@ -0,0 +1,134 @@
+package core
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// importedFile records, one per line, the urls that have been imported.
+var importedFile = "imported.txt"
+
+var draftsMu sync.Mutex
+
+type Draft struct {
+	Name     string
+	Filename string
+}
+
+func (s *State) draftsPath() string {
+	return s.Config.Server.DraftsPath
+}
+
+// ImportedURLs returns the set of urls previously saved as drafts.
+func (s *State) ImportedURLs() map[string]bool {
+	draftsMu.Lock()
+	defer draftsMu.Unlock()
+
+	urls := map[string]bool{}
+	file, err := os.Open(filepath.Join(s.draftsPath(), importedFile))
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Println("Error opening imported urls:", err)
+		}
+		return urls
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			urls[line] = true
+		}
+	}
+	return urls
+}
+
+// SaveDraft writes an imported recipe to the drafts directory and records its
+// url as imported.  The draft name is made unique if a draft with the same
+// name already exists.
+func (s *State) SaveDraft(url string, recipe *Recipe) (string, error) {
+	draftsMu.Lock()
+	defer draftsMu.Unlock()
+
+	if err := os.MkdirAll(s.draftsPath(), 0755); err != nil {
+		return "", err
+	}
+
+	base := strings.TrimSpace(filepath.Base(recipe.Name))
+	if base == "" || base == "." || base == string(filepath.Separator) {
+		base = "Untitled"
+	}
+
+	name := base
+	for i := 2; ; i++ {
+		fp := filepath.Join(s.draftsPath(), name+RecipeExt)
+		f, err := os.OpenFile(fp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if errors.Is(err, fs.ErrExist) {
+			name = fmt.Sprintf("%s %d", base, i)
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		_, err = f.WriteString(recipe.Markdown())
+		if err1 := f.Close(); err1 != nil && err == nil {
+			err = err1
+		}
+		if err != nil {
+			return "", err
+		}
+		break
+	}
+
+	ledger, err := os.OpenFile(filepath.Join(s.draftsPath(), importedFile), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return name, err
+	}
+	_, err = fmt.Fprintln(ledger, url)
+	if err1 := ledger.Close(); err1 != nil && err == nil {
+		err = err1
+	}
+	return name, err
+}
+
+func (s *State) ListDrafts() ([]Draft, error) {
+	entries, err := os.ReadDir(s.draftsPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return []Draft{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	drafts := []Draft{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), RecipeExt) {
+			continue
+		}
+		drafts = append(drafts, Draft{
+			Name:     strings.TrimSuffix(entry.Name(), RecipeExt),
+			Filename: entry.Name(),
+		})
+	}
+	sort.Slice(drafts, func(i, j int) bool {
+		return drafts[i].Name < drafts[j].Name
+	})
+	return drafts, nil
+}
+
+// DraftPath returns the path of the named draft, or an error if the name
+// would escape the drafts directory.
+func (s *State) DraftPath(name string) (string, error) {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return "", fs.ErrNotExist
+	}
+	return filepath.Join(s.draftsPath(), name+RecipeExt), nil
+}
@@ -0,0 +1,303 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"cookbook/internal/search"
+
+	"github.com/tmc/langchaingo/embeddings"
+)
+
+// maxEmbeddingText limits the recipe text sent to the embedding model.
+var maxEmbeddingText = 8000
+
+var embeddingBatchSize = 16
+
+// Recipes that failed to embed are retried after embeddingRetryDelay,
+// doubling after each failure up to maxEmbeddingRetryDelay.
+var (
+	embeddingRetryDelay    = 30 * time.Second
+	maxEmbeddingRetryDelay = time.Hour
+)
+
+// Embeddings computes recipe embeddings in the background through an LLM
+// provider and keeps them in Vectors.  Embeddings are cached on disk by
+// content so unchanged recipes are not embedded again after a restart.
+type Embeddings struct {
+	Vectors   *search.Vectors
+	client    embeddings.EmbedderClient
+	model     string
+	timeout   time.Duration
+	cachePath string
+
+	mu      sync.Mutex
+	cache   map[string][]float32 // embedding by content hash
+	hashes  map[string]string    // content hash by webpath
+	pending map[string]string    // text to embed by webpath
+	wake    chan struct{}
+}
+
+// NewEmbeddings uses the Embeddings.Provider from config, it returns nil when
+// no provider is configured.
+func NewEmbeddings(ctx context.Context, config Config) (*Embeddings, error) {
+	name := config.Embeddings.Provider
+	if name == "" {
+		return nil, nil
+	}
+
+	model, err := newModel(ctx, config, name)
+	if err != nil {
+		return nil, err
+	}
+	client, ok := model.Model.(embeddings.EmbedderClient)
+	if !ok {
+		return nil, fmt.Errorf("%s: provider does not support embeddings", name)
+	}
+
+	c := providerConfig(config, name)
+	modelName := name
+	if c.Model != nil {
+		modelName += "/" + *c.Model
+	}
+
+	e := &Embeddings{
+		Vectors:   search.NewVectors(),
+		client:    client,
+		model:     modelName,
+		timeout:   c.Timeout,
+		cachePath: config.Embeddings.CachePath,
+		cache:     map[string][]float32{},
+		hashes:    map[string]string{},
+		pending:   map[string]string{},
+		wake:      make(chan struct{}, 1),
+	}
+
+	b, err := os.ReadFile(e.cachePath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(b, &e.cache); err != nil {
+			slog.Error("ignoring embeddings cache", "path", e.cachePath, "error", err)
+		}
+	}
+	return e, nil
+}
+
+func (e *Embeddings) hash(text string) string {
+	sum := sha256.Sum256([]byte(e.model + "\n" + text))
+	return hex.EncodeToString(sum[:])
+}
+
+// Update embeds a recipe's text, unless the same text was embedded before.
+func (e *Embeddings) Update(webpath, text string) {
+	if len(text) > maxEmbeddingText {
+		text = strings.ToValidUTF8(text[:maxEmbeddingText], "")
+	}
+	hash := e.hash(text)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.hashes[webpath] = hash
+	if vector, ok := e.cache[hash]; ok {
+		delete(e.pending, webpath)
+		e.Vectors.Set(webpath, vector)
+		return
+	}
+
+	e.pending[webpath] = text
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (e *Embeddings) Delete(webpath string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	delete(e.hashes, webpath)
+	delete(e.pending, webpath)
+	e.Vectors.Delete(webpath)
+}
+
+// Run embeds pending recipes until ctx is done.  Recipes that fail to embed
+// are retried with backoff.
+func (e *Embeddings) Run(ctx context.Context) {
+	var retry <-chan time.Time
+	failures := 0
+	for {
+		// Updates wait for a retry, so that they do not skip its backoff.
+		wake := e.wake
+		if retry != nil {
+			wake = nil
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-wake:
+		case <-retry:
+			retry = nil
+		}
+
+		e.mu.Lock()
+		pending := e.pending
+		e.pending = map[string]string{}
+		e.mu.Unlock()
+
+		webpaths := make([]string, 0, len(pending))
+		for webpath := range pending {
+			webpaths = append(webpaths, webpath)
+		}
+
+		failed := false
+		for len(webpaths) > 0 {
+			batch := webpaths[:min(embeddingBatchSize, len(webpaths))]
+			webpaths = webpaths[len(batch):]
+
+			texts := make([]string, len(batch))
+			for i, webpath := range batch {
+				texts[i] = pending[webpath]
+			}
+
+			vectors, err := e.embed(ctx, texts)
+			if err != nil {
+				slog.Error("error computing embeddings", "error", err)
+				e.requeue(batch, texts)
+				failed = true
+				continue
+			}
+
+			e.mu.Lock()
+			for i, webpath := range batch {
+				hash := e.hash(texts[i])
+				e.cache[hash] = vectors[i]
+				// Skip recipes changed or deleted while embedding.
+				if e.hashes[webpath] == hash {
+					e.Vectors.Set(webpath, vectors[i])
+				}
+			}
+			e.mu.Unlock()
+		}
+
+		if failed {
+			delay := min(embeddingRetryDelay<<min(failures, 16), maxEmbeddingRetryDelay)
+			failures++
+			slog.Info("retrying embeddings", "delay", delay)
+			retry = time.After(delay)
+		} else {
+			failures = 0
+		}
+
+		if err := e.save(); err != nil {
+			slog.Error("error saving embeddings cache", "error", err)
+		}
+	}
+}
+
+// requeue makes the recipes of a failed batch pending again, unless they were
+// changed or deleted since.
+func (e *Embeddings) requeue(webpaths, texts []string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for i, webpath := range webpaths {
+		if _, ok := e.pending[webpath]; ok || e.hashes[webpath] != e.hash(texts[i]) {
+			continue
+		}
+		e.pending[webpath] = texts[i]
+	}
+}
+
+func (e *Embeddings) embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if e.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.timeout)
+		defer cancel()
+	}
+	vectors, err := e.client.CreateEmbedding(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != len(texts) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(texts), len(vectors))
+	}
+	return vectors, nil
+}
+
+// Query embeds a search query.
+func (e *Embeddings) Query(ctx context.Context, query string) ([]float32, error) {
+	vectors, err := e.embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	return vectors[0], nil
+}
+
+// save writes the embeddings of the current recipes to the cache file.
+func (e *Embeddings) save() error {
+	e.mu.Lock()
+	cache := make(map[string][]float32, len(e.hashes))
+	for _, hash := range e.hashes {
+		if vector, ok := e.cache[hash]; ok {
+			cache[hash] = vector
+		}
+	}
+	e.cache = cache
+	b, err := json.Marshal(cache)
+	e.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(e.cachePath), 0755); err != nil {
+		return err
+	}
+	tmp := e.cachePath + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, e.cachePath)
+}
+
+func embeddingText(name string, tags []string, md string) string {
+	return name + "\n" + strings.Join(tags, ", ") + "\n\n" + md
+}
+
+// SearchRecipes searches the index, blending in similarity to the query's
+// embedding when embeddings are configured.
+func (s *State) SearchRecipes(ctx context.Context, query string, options search.Options) (*search.SearchResults, error) {
+	options.Boosts = s.Config.Search.Boosts
+	// Only the words of the query are embedded, not its field terms.
+	parsed, err := search.ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	if s.Embeddings != nil && parsed.Text != "" && options.Sort == search.SortRelevance {
+		vector, err := s.Embeddings.Query(ctx, parsed.Text)
+		if err != nil {
+			slog.Error("searching without embeddings", "error", err)
+		} else {
+			options.Semantic = &search.Semantic{
+				Vectors:       s.Embeddings.Vectors,
+				Query:         vector,
+				Weight:        s.Config.Embeddings.Weight,
+				MinSimilarity: s.Config.Embeddings.MinSimilarity,
+			}
+		}
+	}
+	return search.SearchRecipes(s.Index, query, options)
+}
@@ -0,0 +1,57 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"cookbook/internal/search"
+)
+
+// flakyEmbedder fails its first calls.
+type flakyEmbedder struct {
+	mu       sync.Mutex
+	failures int
+}
+
+func (f *flakyEmbedder) CreateEmbedding(_ context.Context, texts []string) ([][]float32, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failures > 0 {
+		f.failures--
+		return nil, errors.New("503 service unavailable")
+	}
+	vectors := make([][]float32, len(texts))
+	for i := range texts {
+		vectors[i] = []float32{1, 0}
+	}
+	return vectors, nil
+}
+
+func TestEmbeddingsRetryFailedBatch(t *testing.T) {
+	embeddingRetryDelay = time.Millisecond
+
+	e := &Embeddings{
+		Vectors:   search.NewVectors(),
+		client:    &flakyEmbedder{failures: 2},
+		cachePath: filepath.Join(t.TempDir(), "embeddings.json"),
+		cache:     map[string][]float32{},
+		hashes:    map[string]string{},
+		pending:   map[string]string{},
+		wake:      make(chan struct{}, 1),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.Run(ctx)
+
+	e.Update("SquashSoup", "Squash Soup")
+	for deadline := time.Now().Add(5 * time.Second); e.Vectors.Len() == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the recipe to be embedded after the failures")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,276 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+)
+
+// FetchError describes why a url could not be fetched, in terms suitable to
+// show to the user.
+type FetchError struct {
+	URL string
+	Msg string
+}
+
+func (e *FetchError) Error() string {
+	return fmt.Sprintf("cannot fetch %s: %s", e.URL, e.Msg)
+}
+
+var errBlockedAddress = errors.New("address is not allowed")
+
+// blockedNetworks are the special purpose networks, see RFC 6890, that are
+// not on the public internet and not already refused by isAllowed's checks.
+var blockedNetworks = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // this network
+	netip.MustParsePrefix("100.64.0.0/10"),   // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // documentation
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // documentation
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved and broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),    // NAT64, may reach private IPv4
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // local NAT64
+	netip.MustParsePrefix("100::/64"),        // discard
+	netip.MustParsePrefix("2001::/23"),       // IETF protocol assignments
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+	netip.MustParsePrefix("2002::/16"),       // 6to4, may reach private IPv4
+}
+
+var fetchContentTypes = []string{
+	"text/html",
+	"application/xhtml+xml",
+	"application/xml",
+	"text/xml",
+}
+
+type Fetcher struct {
+	client      *http.Client
+	userAgent   string
+	maxBodySize int64
+	allowed     []netip.Prefix
+	proxied     bool
+}
+
+// NewFetcher returns a Fetcher configured from the Fetcher config section.
+// Connections to loopback, link-local, private and other special purpose
+// addresses are refused unless they fall within Fetcher.AllowedNetworks.  A
+// Fetcher.Proxy resolves hosts itself, so a host could resolve differently
+// for it than for the check, it must be trusted with Fetcher.TrustProxy to
+// refuse those addresses.
+func NewFetcher(config Config) (*Fetcher, error) {
+	cfg := config.Fetcher
+
+	f := &Fetcher{
+		userAgent:   cfg.UserAgent,
+		maxBodySize: cfg.MaxBodySize,
+	}
+
+	for _, network := range cfg.AllowedNetworks {
+		prefix, err := netip.ParsePrefix(network)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Fetcher.AllowedNetworks entry %q: %v", network, err)
+		}
+		f.allowed = append(f.allowed, prefix)
+	}
+
+	dialer := &net.Dialer{Timeout: cfg.ConnectTimeout}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.TLSHandshakeTimeout = cfg.ConnectTimeout
+
+	if cfg.Proxy != "" {
+		if !cfg.TrustProxy {
+			return nil, errors.New("Fetcher.Proxy must block private networks itself, set Fetcher.TrustProxy when it does")
+		}
+		proxyURL, err := url.Parse(cfg.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Fetcher.Proxy: %v", err)
+		}
+		// The proxy resolves the target so the host is also checked before
+		// each request, though only the proxy can enforce it.
+		transport.Proxy = http.ProxyURL(proxyURL)
+		f.proxied = true
+	} else {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			addr, err := netip.ParseAddr(host)
+			if err != nil {
+				return err
+			}
+			if !f.isAllowed(addr) {
+				return errBlockedAddress
+			}
+			return nil
+		}
+	}
+	transport.DialContext = dialer.DialContext
+
+	f.client = &http.Client{
+		Transport: transport,
+		Timeout:   cfg.Timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return f.checkURL(req.Context(), req.URL)
+		},
+	}
+
+	return f, nil
+}
+
+func (f *Fetcher) isAllowed(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range f.allowed {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	for _, prefix := range blockedNetworks {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return !(addr.IsLoopback() ||
+		addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() ||
+		addr.IsUnspecified())
+}
+
+func (f *Fetcher) checkURL(ctx context.Context, u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	if !f.proxied {
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", u.Hostname())
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if !f.isAllowed(addr) {
+			return errBlockedAddress
+		}
+	}
+	return nil
+}
+
+func (f *Fetcher) fetchError(rawURL string, err error) error {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, errBlockedAddress):
+		return &FetchError{URL: rawURL, Msg: "the address is on a blocked network"}
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return &FetchError{URL: rawURL, Msg: "the request timed out"}
+	case errors.Is(err, context.Canceled):
+		return err
+	default:
+		return &FetchError{URL: rawURL, Msg: err.Error()}
+	}
+}
+
+// Request fetches rawURL and returns its body.  It satisfies Request.
+func (f *Fetcher) Request(ctx context.Context, rawURL string) (io.ReadCloser, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, &FetchError{URL: rawURL, Msg: "invalid url"}
+	}
+	if err := f.checkURL(ctx, u); err != nil {
+		return nil, f.fetchError(rawURL, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, f.fetchError(rawURL, err)
+	}
+	req.Header.Set("User-Agent", f.userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, f.fetchError(rawURL, err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, &FetchError{URL: rawURL, Msg: "the server responded " + resp.Status}
+	}
+
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || !isFetchContentType(mediaType) {
+			resp.Body.Close()
+			return nil, &FetchError{URL: rawURL, Msg: "unsupported content type " + contentType}
+		}
+	}
+
+	if f.maxBodySize > 0 && resp.ContentLength > f.maxBodySize {
+		resp.Body.Close()
+		return nil, &FetchError{URL: rawURL, Msg: fmt.Sprintf("the page is larger than %d bytes", f.maxBodySize)}
+	}
+
+	return &limitedBody{
+		ReadCloser: resp.Body,
+		url:        rawURL,
+		remaining:  f.maxBodySize,
+		limited:    f.maxBodySize > 0,
+	}, nil
+}
+
+func isFetchContentType(mediaType string) bool {
+	for _, t := range fetchContentTypes {
+		if strings.EqualFold(mediaType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// limitedBody fails reads once more than the maximum body size is read.
+type limitedBody struct {
+	io.ReadCloser
+	url       string
+	remaining int64
+	limited   bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.limited {
+		if b.remaining < 0 {
+			return 0, &FetchError{URL: b.url, Msg: "the page is too large"}
+		}
+		if int64(len(p)) > b.remaining+1 {
+			p = p[:b.remaining+1]
+		}
+	}
+	n, err := b.ReadCloser.Read(p)
+	if b.limited {
+		b.remaining -= int64(n)
+		if b.remaining < 0 {
+			return n, &FetchError{URL: b.url, Msg: "the page is too large"}
+		}
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return n, &FetchError{URL: b.url, Msg: "the request timed out"}
+	}
+	return n, err
+}
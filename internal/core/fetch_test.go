@@ -0,0 +1,131 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestFetcher(t *testing.T, allowedNetworks ...string) *Fetcher {
+	var config Config
+	config.Fetcher.ConnectTimeout = time.Second
+	config.Fetcher.Timeout = time.Second
+	config.Fetcher.MaxBodySize = 64
+	config.Fetcher.UserAgent = "test-agent"
+	config.Fetcher.AllowedNetworks = allowedNetworks
+
+	fetcher, err := NewFetcher(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fetcher
+}
+
+func TestFetcher(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/recipe":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(r.UserAgent()))
+		case "/large":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(strings.Repeat("a", 65)))
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("png"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+
+	t.Run("blocks loopback", func(t *testing.T) {
+		_, err := newTestFetcher(t).Request(ctx, server.URL+"/recipe")
+		var fetchErr *FetchError
+		if !errors.As(err, &fetchErr) || !strings.Contains(err.Error(), "blocked network") {
+			t.Errorf("expected blocked network error, got %v", err)
+		}
+	})
+
+	fetcher := newTestFetcher(t, "127.0.0.0/8", "::1/128")
+
+	t.Run("allowed network", func(t *testing.T) {
+		body, err := fetcher.Request(ctx, server.URL+"/recipe")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer body.Close()
+		b, err := io.ReadAll(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != "test-agent" {
+			t.Errorf("expected user agent to be sent, got %q", b)
+		}
+	})
+
+	t.Run("non-2xx", func(t *testing.T) {
+		_, err := fetcher.Request(ctx, server.URL+"/missing")
+		if err == nil || !strings.Contains(err.Error(), "404") {
+			t.Errorf("expected 404 error, got %v", err)
+		}
+	})
+
+	t.Run("content type", func(t *testing.T) {
+		_, err := fetcher.Request(ctx, server.URL+"/image")
+		if err == nil || !strings.Contains(err.Error(), "content type") {
+			t.Errorf("expected content type error, got %v", err)
+		}
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		body, err := fetcher.Request(ctx, server.URL+"/large")
+		if err == nil {
+			defer body.Close()
+			_, err = io.ReadAll(body)
+		}
+		if err == nil || !strings.Contains(err.Error(), "large") {
+			t.Errorf("expected size error, got %v", err)
+		}
+	})
+
+	t.Run("special networks", func(t *testing.T) {
+		for _, addr := range []string{"100.64.0.1", "192.0.0.8", "198.18.0.1", "240.0.0.1", "64:ff9b::a00:1", "2002:a00:1::1"} {
+			if fetcher.isAllowed(netip.MustParseAddr(addr)) {
+				t.Errorf("expected %s to be blocked", addr)
+			}
+		}
+		if !fetcher.isAllowed(netip.MustParseAddr("93.184.215.14")) {
+			t.Error("expected a public address to be allowed")
+		}
+	})
+
+	t.Run("untrusted proxy", func(t *testing.T) {
+		var config Config
+		config.Fetcher.Proxy = "http://proxy.example.com:3128"
+		if _, err := NewFetcher(config); err == nil {
+			t.Error("expected a proxy without TrustProxy to be refused")
+		}
+		config.Fetcher.TrustProxy = true
+		if _, err := NewFetcher(config); err != nil {
+			t.Errorf("expected a trusted proxy, got %v", err)
+		}
+	})
+
+	t.Run("scheme", func(t *testing.T) {
+		_, err := fetcher.Request(ctx, "file:///etc/passwd")
+		if err == nil {
+			t.Error("expected scheme error")
+		}
+	})
+}
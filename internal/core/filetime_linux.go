@@ -0,0 +1,19 @@
+package core
+
+import (
+	"io/fs"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// fileTimes returns when a file was created, its birth time where the file
+// system records it, and last modified.
+func fileTimes(path string, info fs.FileInfo) (time.Time, time.Time) {
+	var stx unix.Statx_t
+	err := unix.Statx(unix.AT_FDCWD, path, unix.AT_SYMLINK_NOFOLLOW, unix.STATX_BTIME, &stx)
+	if err != nil || stx.Mask&unix.STATX_BTIME == 0 {
+		return info.ModTime(), info.ModTime()
+	}
+	return time.Unix(stx.Btime.Sec, int64(stx.Btime.Nsec)), info.ModTime()
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package core
+
+import (
+	"io/fs"
+	"time"
+)
+
+// fileTimes returns when a file was created and last modified.  Only the
+// modification time is portable, so it stands in for both.
+func fileTimes(path string, info fs.FileInfo) (time.Time, time.Time) {
+	return info.ModTime(), info.ModTime()
+}
@@ -1,20 +1,21 @@
 package core
 
 import (
+	"cmp"
+	"errors"
 	"fmt"
 	"io"
-	"net/http"
 	"strings"
+	"text/template"
+	"time"
+
+	"cookbook/internal/markdown"
 
 	"encoding/json"
 
 	"github.com/PuerkitoBio/goquery"
 
 	"github.com/tmc/langchaingo/llms"
-	"github.com/tmc/langchaingo/llms/googleai"
-
-	"github.com/tmc/langchaingo/llms/ollama"
-	"github.com/tmc/langchaingo/llms/openai"
 
 	"golang.org/x/exp/slog"
 	"golang.org/x/net/context"
@@ -24,15 +25,43 @@ import (
 type Recipe struct {
 	Name string `json:"name"`
 	Body string `json:"body"`
+
+	// Source is the url the recipe was imported from.
+	Source string `json:"-"`
+	// Imported is when the recipe was imported.
+	Imported time.Time `json:"-"`
+	// Method is how the recipe was extracted, see ImportMethodCrawled and
+	// ImportMethodFetched.
+	Method string `json:"-"`
 }
 
+const (
+	// ImportMethodCrawled means the LLM knew the recipe from its training data.
+	ImportMethodCrawled = "crawled"
+	// ImportMethodFetched means the LLM extracted the recipe from the fetched page.
+	ImportMethodFetched = "fetched"
+)
+
+// Markdown returns the recipe body with its import metadata.
+func (r *Recipe) Markdown() string {
+	if r.Source == "" {
+		return r.Body
+	}
+	return markdown.SetMetadata(r.Body, markdown.Metadata{
+		"source":   r.Source,
+		"imported": r.Imported.Format(time.DateOnly),
+		"method":   r.Method,
+	})
+}
+
+// CRAWLED_PARSE_PROMPT is a text/template executed with the recipe URL.
 const CRAWLED_PARSE_PROMPT = `
-  Consider this recipe URL: %s.
+  Consider this recipe URL: {{.URL}}.
   The output should be JSON formatted with the following schema:
   {
     "type": "object",
     "nullable": true,
-    "description": "A recipe.  The object should be null if you have never crawled the provided URL.",
+    "description": "A recipe.  The object should be null, or {} in JSON mode, if you have never crawled the provided URL.",
     "properties": {
     	"name": {
     		"type": "string",
@@ -47,16 +76,17 @@ const CRAWLED_PARSE_PROMPT = `
   }
 `
 
+// FETCHED_PARSE_PROMPT is a text/template executed with the page HTML.
 const FETCHED_PARSE_PROMPT = `
   Consider this recipe:
   <html>
-  	%s
+  	{{.HTML}}
   </html>
   The output should be JSON formatted with the following schema:
   {
     "type": "object",
     "nullable": true,
-    "description": "A recipe.  The object should be null if you have not found a recipe.",
+    "description": "A recipe.  The object should be null, or {} in JSON mode, if you have not found a recipe.",
     "properties": {
     	"name": {
     		"type": "string",
@@ -71,34 +101,126 @@ const FETCHED_PARSE_PROMPT = `
   }
 `
 
+const REPAIR_PROMPT = `
+  That reply is not valid: %s.
+  Reply again with only the JSON object following the schema, or null or {} if there is no recipe.
+`
+
+type ImportOptions struct {
+	// CrawledPrompt overrides CRAWLED_PARSE_PROMPT.
+	CrawledPrompt string
+	// FetchedPrompt overrides FETCHED_PARSE_PROMPT.
+	FetchedPrompt string
+	// RepairRetries is how many times an invalid reply is sent back to the
+	// LLM with the validation error.
+	RepairRetries int
+}
+
+func (o ImportOptions) crawledPrompt(url string) (string, error) {
+	return renderPrompt(cmp.Or(o.CrawledPrompt, CRAWLED_PARSE_PROMPT), struct{ URL string }{url})
+}
+
+func (o ImportOptions) fetchedPrompt(html string) (string, error) {
+	return renderPrompt(cmp.Or(o.FetchedPrompt, FETCHED_PARSE_PROMPT), struct{ HTML string }{html})
+}
+
+func renderPrompt(prompt string, data any) (string, error) {
+	t, err := template.New("prompt").Parse(prompt)
+	if err != nil {
+		return "", fmt.Errorf("error parsing prompt: %v", err)
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("error executing prompt: %v", err)
+	}
+	return b.String(), nil
+}
+
 func TrimCompletion(completion string) string {
 	completion = strings.TrimPrefix(completion, "```json")
 	completion = strings.TrimSuffix(completion, "```")
 	return strings.TrimSpace(completion)
 }
 
-func QueryLLM(ctx context.Context, llm llms.Model, prompt string) (*Recipe, error) {
-	completion, err := llms.GenerateFromSinglePrompt(ctx, llm, prompt)
-	if err != nil {
-		return nil, fmt.Errorf("error generating content: %v", err)
-	}
+type RecipeValidationError struct{ Msg string }
 
-	slog.Info("LLM", "request", prompt, "response", completion)
+func (e *RecipeValidationError) Error() string {
+	return e.Msg
+}
 
+// ValidateRecipe checks a recipe has a name, ingredients and steps.
+func ValidateRecipe(recipe *Recipe) error {
+	if strings.TrimSpace(recipe.Name) == "" {
+		return &RecipeValidationError{"the name is empty"}
+	}
+	sections := markdown.ParseSections([]byte(recipe.Body))
+	if len(sections.Ingredients) == 0 {
+		return &RecipeValidationError{"the body has no list of ingredients under an Ingredients heading"}
+	}
+	if len(sections.Steps) == 0 {
+		return &RecipeValidationError{"the body has no steps under a Directions heading"}
+	}
+	return nil
+}
+
+func parseCompletion(completion string) (*Recipe, error) {
 	completion = TrimCompletion(completion)
 
-	if completion == "null" {
+	// JSON mode cannot reply null, it replies {} for no recipe.
+	if completion == "null" || completion == "{}" {
+		return nil, nil
+	}
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(completion), &object); err == nil && len(object) == 0 {
 		return nil, nil
 	}
 
 	var recipe Recipe
 	if err := json.Unmarshal([]byte(completion), &recipe); err != nil {
-		return nil, fmt.Errorf("error parsing response: %v", err)
+		return nil, &RecipeValidationError{fmt.Sprintf("the reply is not JSON matching the schema: %v", err)}
+	}
+
+	if err := ValidateRecipe(&recipe); err != nil {
+		return nil, err
 	}
 
 	return &recipe, nil
 }
 
+// QueryLLM asks for a recipe using the provider's JSON mode where supported.
+// Invalid replies are sent back with the validation error up to retries times.
+func QueryLLM(ctx context.Context, llm llms.Model, prompt string, retries int) (*Recipe, error) {
+	messages := []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeHuman, prompt),
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := llm.GenerateContent(ctx, messages, llms.WithJSONMode())
+		if err != nil {
+			return nil, fmt.Errorf("error generating content: %v", err)
+		}
+		if len(resp.Choices) < 1 {
+			return nil, fmt.Errorf("error generating content: empty response")
+		}
+		completion := resp.Choices[0].Content
+
+		slog.Info("LLM", "request", messages[len(messages)-1].Parts, "response", completion, "attempt", attempt)
+
+		recipe, err := parseCompletion(completion)
+		if err == nil {
+			return recipe, nil
+		}
+		if attempt >= retries {
+			return nil, fmt.Errorf("error parsing response: %w", err)
+		}
+
+		messages = append(messages,
+			llms.TextParts(llms.ChatMessageTypeAI, completion),
+			llms.TextParts(llms.ChatMessageTypeHuman, fmt.Sprintf(REPAIR_PROMPT, err)),
+		)
+	}
+}
+
 func StripExtraneousHTML(reader io.Reader) (string, error) {
 	doc, err := goquery.NewDocumentFromReader(reader)
 	if err != nil {
@@ -129,88 +251,21 @@ func StripExtraneousHTML(reader io.Reader) (string, error) {
 	return doc.Html()
 }
 
-type LLMNotFoundError struct{ LLM string }
-
-func (u *LLMNotFoundError) Error() string {
-	return fmt.Sprintf("llm not found: %s", u.LLM)
-}
-
-func LLMModel(ctx context.Context, config Config) (llms.Model, error) {
-	if config.Server.LLM == nil {
-		return nil, &LLMNotFoundError{LLM: "unknown"}
-	}
-
-	switch *config.Server.LLM {
-
-	// https://github.com/tmc/langchaingo/blob/main/llms/googleai/option.go
-	case "Google":
-		options := []googleai.Option{}
-
-		if config.Google.APIKey != nil {
-			options = append(options, googleai.WithAPIKey(*config.Google.APIKey))
-		}
-
-		if config.Google.Model != nil {
-			options = append(options, googleai.WithDefaultModel(*config.Google.Model))
-		}
-
-		return googleai.New(ctx, options...)
-
-	// https://github.com/tmc/langchaingo/blob/main/llms/ollama/options.go
-	case "Ollama":
-		options := []ollama.Option{}
-
-		if config.Ollama.ServerURL != nil {
-			options = append(options, ollama.WithServerURL(*config.Ollama.ServerURL))
-		}
-
-		if config.Ollama.Model != nil {
-			options = append(options, ollama.WithModel(*config.Ollama.Model))
-		}
-
-		return ollama.New(options...)
-
-	// https://github.com/tmc/langchaingo/blob/main/llms/openai/openaillm_option.go
-	case "OpenAI":
-		options := []openai.Option{}
-
-		if config.OpenAI.Token != nil {
-			options = append(options, openai.WithToken(*config.OpenAI.Token))
-		}
-
-		if config.OpenAI.BaseURL != nil {
-			options = append(options, openai.WithBaseURL(*config.OpenAI.BaseURL))
-		}
-
-		if config.OpenAI.Model != nil {
-			options = append(options, openai.WithModel(*config.OpenAI.Model))
-		}
-
-		return openai.New(options...)
-	}
-
-	return nil, &LLMNotFoundError{LLM: *config.Server.LLM}
-}
-
 type Request func(ctx context.Context, url string) (io.ReadCloser, error)
 
-func HTTPRequest(ctx context.Context, url string) (io.ReadCloser, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+func Import(ctx context.Context, llm llms.Model, request Request, url string, options ImportOptions) (*Recipe, error) {
+	crawledPrompt, err := options.crawledPrompt(url)
 	if err != nil {
 		return nil, err
 	}
-	resp, err := http.DefaultClient.Do(req)
-	return resp.Body, err
-}
 
-func Import(ctx context.Context, llm llms.Model, request Request, url string) (*Recipe, error) {
 	crawledChan := make(chan struct {
 		*Recipe
 		error
 	}, 1)
 
 	go func() {
-		result, err := QueryLLM(ctx, llm, fmt.Sprintf(CRAWLED_PARSE_PROMPT, url))
+		result, err := QueryLLM(ctx, llm, crawledPrompt, options.RepairRetries)
 		crawledChan <- struct {
 			*Recipe
 			error
@@ -239,11 +294,21 @@ func Import(ctx context.Context, llm llms.Model, request Request, url string) (*
 		}{str, err}
 	}()
 
+	// A crawled recipe that stays invalid is as unknown as none, the page
+	// fetched meanwhile is used instead.
 	crawlResult := <-crawledChan
+	var validationErr *RecipeValidationError
+	if errors.As(crawlResult.error, &validationErr) {
+		slog.Info("crawled recipe invalid, using the fetched page", "url", url, "error", crawlResult.error)
+		crawlResult.error = nil
+	}
 	if crawlResult.error != nil {
 		return nil, crawlResult.error
 	}
 	if crawlResult.Recipe != nil {
+		crawlResult.Recipe.Source = url
+		crawlResult.Recipe.Imported = time.Now()
+		crawlResult.Recipe.Method = ImportMethodCrawled
 		return crawlResult.Recipe, nil
 	}
 
@@ -252,5 +317,16 @@ func Import(ctx context.Context, llm llms.Model, request Request, url string) (*
 		return nil, requestResult.error
 	}
 
-	return QueryLLM(ctx, llm, fmt.Sprintf(FETCHED_PARSE_PROMPT, requestResult.string))
+	fetchedPrompt, err := options.fetchedPrompt(requestResult.string)
+	if err != nil {
+		return nil, err
+	}
+
+	recipe, err := QueryLLM(ctx, llm, fetchedPrompt, options.RepairRetries)
+	if recipe != nil {
+		recipe.Source = url
+		recipe.Imported = time.Now()
+		recipe.Method = ImportMethodFetched
+	}
+	return recipe, err
 }
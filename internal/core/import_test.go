@@ -100,11 +100,12 @@ func TestImport(t *testing.T) {
 	defer cancel()
 
 	name := "Fake Recipe"
-	body := "Fake recipe body"
-	success := fmt.Sprintf("```json\n"+`{"name": "%s", "body": "%s"}`+"```", name, body)
+	body := "## Ingredients\n- flour\n\n## Directions\n1. Bake."
+	success := fmt.Sprintf("```json\n"+`{"name": "%s", "body": %q}`+"```", name, body)
+	options := ImportOptions{RepairRetries: 1}
 
 	successTest := func(llm llms.Model) {
-		recipe, err := Import(ctx, llm, fakeRequest, "https://example.com/recipe")
+		recipe, err := Import(ctx, llm, fakeRequest, "https://example.com/recipe", options)
 		if err != nil {
 			t.Errorf("import failed: %v", err)
 			return
@@ -117,7 +118,10 @@ func TestImport(t *testing.T) {
 			t.Errorf("expected name 'Fake Recipe', got '%s'", recipe.Name)
 		}
 		if recipe.Body != body {
-			t.Errorf("expected body 'Fake recipe body', got '%s'", recipe.Body)
+			t.Errorf("expected body %q, got %q", body, recipe.Body)
+		}
+		if recipe.Source != "https://example.com/recipe" {
+			t.Errorf("expected source to be recorded, got '%s'", recipe.Source)
 		}
 	}
 
@@ -129,9 +133,31 @@ func TestImport(t *testing.T) {
 		successTest(fake.NewFakeLLM([]string{"null", success}))
 	})
 
+	t.Run("crawl invalid, repaired", func(t *testing.T) {
+		successTest(fake.NewFakeLLM([]string{`{"name": "Fake Recipe", "body": "no ingredients"}`, success}))
+	})
+
+	t.Run("crawl empty object, request success", func(t *testing.T) {
+		successTest(fake.NewFakeLLM([]string{"{}", success}))
+	})
+
+	t.Run("crawl invalid after retries, request success", func(t *testing.T) {
+		invalid := `{"name": "", "body": "no ingredients"}`
+		successTest(fake.NewFakeLLM([]string{invalid, invalid, success}))
+	})
+
+	t.Run("invalid after retries", func(t *testing.T) {
+		invalid := `{"name": "", "body": "no ingredients"}`
+		fakeLLM := fake.NewFakeLLM([]string{invalid, invalid, invalid, invalid})
+		_, err := Import(ctx, fakeLLM, fakeRequest, "https://example.com/recipe", options)
+		if err == nil {
+			t.Error("expected validation error")
+		}
+	})
+
 	t.Run("fail", func(t *testing.T) {
 		fakeLLM := fake.NewFakeLLM([]string{"null", "null"})
-		recipe, err := Import(ctx, fakeLLM, fakeRequest, "https://example.com/recipe")
+		recipe, err := Import(ctx, fakeLLM, fakeRequest, "https://example.com/recipe", options)
 		if err != nil {
 			return
 		}
@@ -141,3 +167,18 @@ func TestImport(t *testing.T) {
 		}
 	})
 }
+
+func TestDiffLines(t *testing.T) {
+	t.Parallel()
+
+	diff := DiffLines("a\nb\nc\n", "a\nc\nd")
+	expected := []DiffLine{
+		{DiffEqual, "a"},
+		{DiffDelete, "b"},
+		{DiffEqual, "c"},
+		{DiffInsert, "d"},
+	}
+	if fmt.Sprint(diff) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, diff)
+	}
+}
@@ -0,0 +1,258 @@
+package core
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/anthropic"
+	"github.com/tmc/langchaingo/llms/googleai"
+	"github.com/tmc/langchaingo/llms/mistral"
+	"github.com/tmc/langchaingo/llms/ollama"
+	"github.com/tmc/langchaingo/llms/openai"
+)
+
+// LLMProviderConfig configures an LLM provider, either a [Providers.<name>]
+// section or one of the [Google], [Ollama] and [OpenAI] sections.  Not every
+// provider uses every option.
+type LLMProviderConfig struct {
+	// Type is the registered provider, it defaults to the provider name.
+	Type      string
+	APIKey    *string
+	Token     *string
+	ServerURL *string
+	BaseURL   *string
+	Model     *string
+
+	Temperature *float64
+	MaxTokens   *int
+	Timeout     time.Duration
+}
+
+func (c LLMProviderConfig) key() string {
+	if c.APIKey != nil {
+		return *c.APIKey
+	}
+	if c.Token != nil {
+		return *c.Token
+	}
+	return ""
+}
+
+// LLMProvider creates a model from its config.
+type LLMProvider func(ctx context.Context, config LLMProviderConfig) (llms.Model, error)
+
+var llmProviders = map[string]LLMProvider{}
+
+// RegisterLLMProvider makes a langchaingo backend available by name.
+func RegisterLLMProvider(name string, provider LLMProvider) {
+	llmProviders[name] = provider
+}
+
+func init() {
+	// https://github.com/tmc/langchaingo/blob/main/llms/googleai/option.go
+	RegisterLLMProvider("Google", func(ctx context.Context, config LLMProviderConfig) (llms.Model, error) {
+		options := []googleai.Option{}
+		if key := config.key(); key != "" {
+			options = append(options, googleai.WithAPIKey(key))
+		}
+		if config.Model != nil {
+			options = append(options, googleai.WithDefaultModel(*config.Model))
+		}
+		return googleai.New(ctx, options...)
+	})
+
+	// https://github.com/tmc/langchaingo/blob/main/llms/ollama/options.go
+	RegisterLLMProvider("Ollama", func(ctx context.Context, config LLMProviderConfig) (llms.Model, error) {
+		options := []ollama.Option{}
+		if serverURL := cmp.Or(config.ServerURL, config.BaseURL); serverURL != nil {
+			options = append(options, ollama.WithServerURL(*serverURL))
+		}
+		if config.Model != nil {
+			options = append(options, ollama.WithModel(*config.Model))
+		}
+		return ollama.New(options...)
+	})
+
+	// https://github.com/tmc/langchaingo/blob/main/llms/openai/openaillm_option.go
+	// Also for OpenAI compatible servers, set BaseURL and any Token.
+	RegisterLLMProvider("OpenAI", func(ctx context.Context, config LLMProviderConfig) (llms.Model, error) {
+		options := []openai.Option{}
+		if key := config.key(); key != "" {
+			options = append(options, openai.WithToken(key))
+		}
+		if config.BaseURL != nil {
+			options = append(options, openai.WithBaseURL(*config.BaseURL))
+		}
+		if config.Model != nil {
+			options = append(options, openai.WithModel(*config.Model))
+		}
+		return openai.New(options...)
+	})
+
+	// https://github.com/tmc/langchaingo/blob/main/llms/anthropic/anthropicllm_option.go
+	RegisterLLMProvider("Anthropic", func(ctx context.Context, config LLMProviderConfig) (llms.Model, error) {
+		options := []anthropic.Option{}
+		if key := config.key(); key != "" {
+			options = append(options, anthropic.WithToken(key))
+		}
+		if config.BaseURL != nil {
+			options = append(options, anthropic.WithBaseURL(*config.BaseURL))
+		}
+		if config.Model != nil {
+			options = append(options, anthropic.WithModel(*config.Model))
+		}
+		return anthropic.New(options...)
+	})
+
+	// https://github.com/tmc/langchaingo/blob/main/llms/mistral/client_options.go
+	RegisterLLMProvider("Mistral", func(ctx context.Context, config LLMProviderConfig) (llms.Model, error) {
+		options := []mistral.Option{}
+		if key := config.key(); key != "" {
+			options = append(options, mistral.WithAPIKey(key))
+		}
+		if config.BaseURL != nil {
+			options = append(options, mistral.WithEndpoint(*config.BaseURL))
+		}
+		if config.Model != nil {
+			options = append(options, mistral.WithModel(*config.Model))
+		}
+		return mistral.New(options...)
+	})
+}
+
+type LLMNotFoundError struct{ LLM string }
+
+func (u *LLMNotFoundError) Error() string {
+	return fmt.Sprintf("llm not found: %s", u.LLM)
+}
+
+// providerConfig looks up a provider by name in the Providers sections and
+// then the legacy provider sections.  A missing legacy section is empty.
+func providerConfig(config Config, name string) LLMProviderConfig {
+	if c, ok := config.Providers[name]; ok {
+		return c
+	}
+
+	var c *LLMProviderConfig
+	switch name {
+	case "Google":
+		c = config.Google
+	case "Ollama":
+		c = config.Ollama
+	case "OpenAI":
+		c = config.OpenAI
+	}
+	if c == nil {
+		return LLMProviderConfig{}
+	}
+	return *c
+}
+
+func newModel(ctx context.Context, config Config, name string) (*ProviderModel, error) {
+	c := providerConfig(config, name)
+
+	provider, ok := llmProviders[cmp.Or(c.Type, name)]
+	if !ok {
+		return nil, &LLMNotFoundError{LLM: name}
+	}
+
+	model, err := provider(ctx, c)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+
+	options := []llms.CallOption{}
+	if c.Temperature != nil {
+		options = append(options, llms.WithTemperature(*c.Temperature))
+	}
+	if c.MaxTokens != nil {
+		options = append(options, llms.WithMaxTokens(*c.MaxTokens))
+	}
+
+	return &ProviderModel{Model: model, Name: name, options: options, timeout: c.Timeout}, nil
+}
+
+// ProviderModel applies a provider's generation options and timeout to every
+// call.  Options passed to a call take precedence.
+type ProviderModel struct {
+	llms.Model
+	Name    string
+	options []llms.CallOption
+	timeout time.Duration
+}
+
+func (m *ProviderModel) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	if m.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.timeout)
+		defer cancel()
+	}
+	// Clone so that concurrent calls never append into the shared options.
+	return m.Model.GenerateContent(ctx, messages, append(slices.Clone(m.options), options...)...)
+}
+
+func (m *ProviderModel) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+// FallbackModel tries each model in order until one succeeds, ex. when a
+// provider errors or is rate limited.
+type FallbackModel struct {
+	Models []*ProviderModel
+}
+
+func (m *FallbackModel) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	errs := []error{}
+	for _, model := range m.Models {
+		resp, err := model.GenerateContent(ctx, messages, options...)
+		if err == nil {
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		slog.Warn("LLM provider failed", "provider", model.Name, "error", err)
+		errs = append(errs, fmt.Errorf("%s: %w", model.Name, err))
+	}
+	return nil, errors.Join(errs...)
+}
+
+func (m *FallbackModel) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+// LLMModel returns the Server.LLM provider, falling back to the providers in
+// Server.LLMFallback in order.  A provider that cannot be created is skipped,
+// it is an error only when none can be.
+func LLMModel(ctx context.Context, config Config) (llms.Model, error) {
+	if config.Server.LLM == nil {
+		return nil, &LLMNotFoundError{LLM: "unknown"}
+	}
+
+	names := append([]string{*config.Server.LLM}, config.Server.LLMFallback...)
+	models := []*ProviderModel{}
+	errs := []error{}
+	for _, name := range names {
+		model, err := newModel(ctx, config, name)
+		if err != nil {
+			slog.Error("skipping LLM provider", "provider", name, "error", err)
+			errs = append(errs, err)
+			continue
+		}
+		models = append(models, model)
+	}
+
+	switch len(models) {
+	case 0:
+		return nil, errors.Join(errs...)
+	case 1:
+		return models[0], nil
+	}
+	return &FallbackModel{Models: models}, nil
+}
@@ -0,0 +1,80 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/fake"
+)
+
+type rateLimitedLLM struct{}
+
+func (rateLimitedLLM) GenerateContent(context.Context, []llms.MessageContent, ...llms.CallOption) (*llms.ContentResponse, error) {
+	return nil, errors.New("429 too many requests")
+}
+
+func (m rateLimitedLLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+func TestFallbackModel(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	model := &FallbackModel{Models: []*ProviderModel{
+		{Model: rateLimitedLLM{}, Name: "limited"},
+		{Model: fake.NewFakeLLM([]string{"ok"}), Name: "fake"},
+	}}
+	completion, err := llms.GenerateFromSinglePrompt(ctx, model, "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if completion != "ok" {
+		t.Errorf("expected fallback completion, got %q", completion)
+	}
+
+	model = &FallbackModel{Models: []*ProviderModel{{Model: rateLimitedLLM{}, Name: "limited"}}}
+	if _, err := llms.GenerateFromSinglePrompt(ctx, model, "hi"); err == nil {
+		t.Error("expected error when every provider fails")
+	}
+}
+
+func TestLLMModelUnknownProvider(t *testing.T) {
+	t.Parallel()
+
+	var config Config
+	name := "missing"
+	config.Server.LLM = &name
+
+	var notFound *LLMNotFoundError
+	if _, err := LLMModel(context.Background(), config); !errors.As(err, &notFound) {
+		t.Errorf("expected llm not found error, got %v", err)
+	}
+}
+
+func TestLLMModelSkipsBrokenProvider(t *testing.T) {
+	// Not parallel, registering writes the providers the other tests read.
+	RegisterLLMProvider("TestFake", func(context.Context, LLMProviderConfig) (llms.Model, error) {
+		return fake.NewFakeLLM([]string{"ok"}), nil
+	})
+
+	var config Config
+	primary := "missing"
+	config.Server.LLM = &primary
+	config.Server.LLMFallback = []string{"TestFake"}
+
+	model, err := LLMModel(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	completion, err := llms.GenerateFromSinglePrompt(context.Background(), model, "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if completion != "ok" {
+		t.Errorf("expected the fallback's completion, got %q", completion)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/fsnotify/fsnotify"
 	"golang.org/x/text/cases"
@@ -18,6 +19,11 @@ import (
 
 var RecipeExt = ".md"
 
+// RecipeWrites serializes recipe writes from the browser, the API and
+// WebDAV, so an API update's version check and write are not interleaved with
+// another write.  It is held around each write of a recipe file.
+var RecipeWrites sync.Mutex
+
 func NameToWebpath(name string) string {
 	title := cases.Title(language.English, cases.Compact).String(name)
 	return strings.ReplaceAll(title, " ", "")
@@ -27,29 +33,85 @@ func (s *State) isRecipe(entry fs.FileInfo) bool {
 	return !entry.IsDir() && strings.HasSuffix(entry.Name(), RecipeExt)
 }
 
-func (s *State) upsertRecipe(filename string, entry fs.FileInfo) {
+// upsertRecipe indexes the recipe file and returns its name and content, or
+// false when it is not a recipe or cannot be read.
+func (s *State) upsertRecipe(filename string, entry fs.FileInfo) (string, []byte, bool) {
 	if s.isRecipe(entry) {
 		var name = strings.TrimSuffix(entry.Name(), RecipeExt)
 
 		file, err := os.DirFS(s.Config.Server.RecipesPath).Open(filename)
 		if err != nil {
 			log.Println("Error opening recipe file:", err)
-			return
+			return "", nil, false
 		}
 		var md bytes.Buffer
 		if _, err = md.ReadFrom(file); err != nil {
 			log.Println("Error reading recipe file:", err)
-			return
+			return "", nil, false
 		}
-		html, tags, err := markdown.ConvertToHtml(md.Bytes())
+		html, tags, metadata, err := markdown.ConvertToHtml(md.Bytes())
 		if err != nil {
 			log.Println("Error converting recipe file:", err)
-			return
+			return "", nil, false
 		}
 		var escapedMarkdown bytes.Buffer
 		template.HTMLEscape(&escapedMarkdown, md.Bytes())
-		search.UpsertRecipe(s.Index, filename, name, NameToWebpath(name), html, escapedMarkdown.String(), tags)
+		var cookTime, servings *float64
+		if minutes, ok := markdown.ParseMinutes(metadata["time"]); ok {
+			cookTime = &minutes
+		}
+		if n, ok := markdown.ParseServings(metadata["servings"]); ok {
+			servings = &n
+		}
+		visibility, err := search.ParseVisibility(metadata["visibility"])
+		if err != nil {
+			// Keep a mistyped visibility from publishing the recipe.
+			log.Println("Error in recipe file", filename+":", err)
+			visibility = search.VisibilityPrivate
+		}
+		added, modified := fileTimes(filepath.Join(s.Config.Server.RecipesPath, filename), entry)
+		search.UpsertRecipe(s.Index, search.Recipe{
+			Filename:    filename,
+			Name:        name,
+			Webpath:     NameToWebpath(name),
+			HTML:        html,
+			Markdown:    escapedMarkdown.String(),
+			Tags:        tags,
+			Source:      metadata["source"],
+			Imported:    metadata["imported"],
+			Method:      metadata["method"],
+			Course:      metadata["course"],
+			Language:    s.recipeLanguage(metadata["language"], md.String()),
+			Time:        cookTime,
+			Servings:    servings,
+			Added:       added,
+			Modified:    modified,
+			Ingredients: markdown.ParseSections(md.Bytes()).Ingredients,
+			Visibility:  visibility,
+		})
+		if s.Embeddings != nil {
+			s.Embeddings.Update(NameToWebpath(name), embeddingText(name, tags, md.String()))
+		}
+		s.Related.Changed(NameToWebpath(name))
+		return name, md.Bytes(), true
+	}
+	return "", nil, false
+}
+
+// recipeLanguage returns the language declared in a recipe's metadata, ex.
+// "de" or "de-CH", or else the one of Server.Languages detected from its text,
+// or else Server.Language.
+func (s *State) recipeLanguage(declared string, md string) string {
+	declared = strings.ToLower(strings.TrimSpace(declared))
+	if language, _, _ := strings.Cut(strings.ReplaceAll(declared, "_", "-"), "-"); language != "" {
+		return language
+	}
+	if len(s.Config.Server.Languages) > 1 {
+		if language := search.DetectLanguage(md, s.Config.Server.Languages); language != "" {
+			return language
+		}
 	}
+	return s.Config.Server.Language
 }
 
 func (s *State) LoadRecipes() {
@@ -63,7 +125,36 @@ func (s *State) LoadRecipes() {
 		if err != nil {
 			log.Fatal(err)
 		}
-		s.upsertRecipe(entry.Name(), info)
+		if name, md, ok := s.upsertRecipe(entry.Name(), info); ok {
+			s.Webhooks.Loaded(NameToWebpath(name), md)
+		}
+	}
+}
+
+// recipeFileChanged indexes the file filename in RecipesPath after it is
+// created or written.
+func (s *State) recipeFileChanged(filename string) error {
+	entry, err := os.Stat(filepath.Join(s.Config.Server.RecipesPath, filename))
+	if err != nil {
+		return err
+	}
+	if name, md, ok := s.upsertRecipe(filename, entry); ok {
+		s.Webhooks.Upserted(NameToWebpath(name), name, md)
+	}
+	return nil
+}
+
+// recipeFileRemoved removes the file filename in RecipesPath from the index
+// after it is removed or renamed.
+func (s *State) recipeFileRemoved(filename string) {
+	name := strings.TrimSuffix(filename, RecipeExt)
+	search.DeleteRecipe(s.Index, NameToWebpath(name))
+	if s.Embeddings != nil {
+		s.Embeddings.Delete(NameToWebpath(name))
+	}
+	s.Related.Changed(NameToWebpath(name))
+	if strings.HasSuffix(filename, RecipeExt) {
+		s.Webhooks.Removed(NameToWebpath(name), name)
 	}
 }
 
@@ -87,15 +178,12 @@ func (s *State) MonitorRecipesDirectory() {
 			}
 			filename := filepath.Base(event.Name)
 			if event.Has(fsnotify.Create) || event.Has(fsnotify.Write) {
-				entry, err := os.Stat(event.Name)
-				if err != nil {
+				if err := s.recipeFileChanged(filename); err != nil {
 					log.Fatal(err)
 				}
-				s.upsertRecipe(filename, entry)
 			}
 			if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
-				name := strings.TrimSuffix(filename, RecipeExt)
-				search.DeleteRecipe(s.Index, NameToWebpath(name))
+				s.recipeFileRemoved(filename)
 			}
 			log.Println("Event:", event)
 		case err, ok := <-watcher.Errors:
@@ -0,0 +1,221 @@
+package core
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"cookbook/internal/search"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+// relatedDelay groups the changes of a burst, like startup or a bulk import,
+// into one update.
+var relatedDelay = time.Second
+
+// RelatedRecipes keeps the recipes related to each recipe, updated in the
+// background whenever recipes are indexed.  After the first update, only the
+// changed recipes and the recipes related to them before or after the change
+// are updated.
+type RelatedRecipes struct {
+	index   bleve.Index
+	weights search.RelatedWeights
+	count   int
+
+	mu      sync.RWMutex
+	related map[string][]search.RelatedRecipe
+	loaded  bool
+	changed map[string]bool
+	wake    chan struct{}
+}
+
+func NewRelatedRecipes(index bleve.Index, config Config) *RelatedRecipes {
+	return &RelatedRecipes{
+		index: index,
+		weights: search.RelatedWeights{
+			Tags:        config.Related.Tags,
+			Ingredients: config.Related.Ingredients,
+			Terms:       config.Related.Terms,
+		},
+		count:   config.Related.Count,
+		related: map[string][]search.RelatedRecipe{},
+		changed: map[string]bool{},
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// Get returns the recipes related to the recipe at webpath, computing them if
+// it has not been updated yet.
+func (r *RelatedRecipes) Get(webpath string) []search.RelatedRecipe {
+	if r == nil || r.count <= 0 {
+		return nil
+	}
+
+	r.mu.RLock()
+	related, ok := r.related[webpath]
+	r.mu.RUnlock()
+	if ok {
+		return related
+	}
+
+	related, err := search.Related(r.index, webpath, r.weights, r.count)
+	if err != nil {
+		slog.Error("error finding related recipes", "webpath", webpath, "error", err)
+		return nil
+	}
+	return related
+}
+
+// Changed schedules an update after the recipe at webpath is indexed or
+// deleted.
+func (r *RelatedRecipes) Changed(webpath string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.changed[webpath] = true
+	r.mu.Unlock()
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run updates the related recipes after changes until ctx is done.
+func (r *RelatedRecipes) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.wake:
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(relatedDelay):
+		}
+		// Changes during the delay are part of this update.
+		select {
+		case <-r.wake:
+		default:
+		}
+
+		if err := r.update(); err != nil {
+			slog.Error("error updating related recipes", "error", err)
+		}
+	}
+}
+
+// update computes the related recipes of every recipe the first time, and
+// then of the changed recipes and the recipes related to them.
+func (r *RelatedRecipes) update() error {
+	if r.count <= 0 {
+		return nil
+	}
+
+	r.mu.Lock()
+	changed := r.changed
+	r.changed = map[string]bool{}
+	loaded := r.loaded
+	r.mu.Unlock()
+
+	if !loaded {
+		return r.updateAll()
+	}
+
+	// The recipes whose related recipes may include a changed recipe.
+	stale := map[string]bool{}
+	r.mu.RLock()
+	for webpath, recipes := range r.related {
+		for _, recipe := range recipes {
+			if changed[recipe.Webpath] {
+				stale[webpath] = true
+				break
+			}
+		}
+	}
+	r.mu.RUnlock()
+
+	updated := map[string][]search.RelatedRecipe{}
+	removed := []string{}
+	for webpath := range changed {
+		recipes, err := search.Related(r.index, webpath, r.weights, r.count)
+		if err == search.ErrNotFound {
+			removed = append(removed, webpath)
+			continue
+		}
+		if err != nil {
+			r.requeue(changed)
+			return err
+		}
+		updated[webpath] = recipes
+		// The recipes now related to a changed recipe may in turn be
+		// related to it.
+		for _, recipe := range recipes {
+			stale[recipe.Webpath] = true
+		}
+	}
+	for webpath := range stale {
+		if _, ok := updated[webpath]; ok || changed[webpath] {
+			continue
+		}
+		recipes, err := search.Related(r.index, webpath, r.weights, r.count)
+		if err == search.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			r.requeue(changed)
+			return err
+		}
+		updated[webpath] = recipes
+	}
+
+	r.mu.Lock()
+	for _, webpath := range removed {
+		delete(r.related, webpath)
+	}
+	for webpath, recipes := range updated {
+		r.related[webpath] = recipes
+	}
+	r.mu.Unlock()
+	return nil
+}
+
+// updateAll computes the related recipes of every recipe.
+func (r *RelatedRecipes) updateAll() error {
+	webpaths, err := search.Webpaths(r.index)
+	if err != nil {
+		return err
+	}
+
+	related := make(map[string][]search.RelatedRecipe, len(webpaths))
+	for _, webpath := range webpaths {
+		recipes, err := search.Related(r.index, webpath, r.weights, r.count)
+		// Deleted since listed.
+		if err == search.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		related[webpath] = recipes
+	}
+
+	r.mu.Lock()
+	r.related = related
+	r.loaded = true
+	r.mu.Unlock()
+	return nil
+}
+
+// requeue schedules the changes of a failed update for the next one.
+func (r *RelatedRecipes) requeue(changed map[string]bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for webpath := range changed {
+		r.changed[webpath] = true
+	}
+}
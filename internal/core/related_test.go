@@ -0,0 +1,81 @@
+package core
+
+import (
+	"slices"
+	"testing"
+
+	"cookbook/internal/search"
+)
+
+func TestRelatedRecipesUpdate(t *testing.T) {
+	t.Parallel()
+
+	idx := search.NewIndex([]string{"en"}, nil)
+	defer idx.Close()
+
+	upsert := func(r search.Recipe) {
+		t.Helper()
+		if err := search.UpsertRecipe(idx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	upsert(search.Recipe{Name: "Squash Soup", Webpath: "SquashSoup", Tags: []string{"Soup"}, Ingredients: []string{"squash", "stock"}})
+	upsert(search.Recipe{Name: "Onion Soup", Webpath: "OnionSoup", Tags: []string{"Soup"}, Ingredients: []string{"onion", "stock"}})
+	upsert(search.Recipe{Name: "Lemonade", Webpath: "Lemonade", Tags: []string{"Drink"}, Ingredients: []string{"lemons"}})
+
+	var config Config
+	config.Related.Count = 5
+	config.Related.Tags = 3
+	config.Related.Ingredients = 2
+	related := NewRelatedRecipes(idx, config)
+	if err := related.update(); err != nil {
+		t.Fatal(err)
+	}
+
+	webpaths := func(webpath string) []string {
+		related.mu.RLock()
+		defer related.mu.RUnlock()
+		result := []string{}
+		for _, r := range related.related[webpath] {
+			result = append(result, r.Webpath)
+		}
+		return result
+	}
+	if got := webpaths("SquashSoup"); !slices.Equal(got, []string{"OnionSoup"}) {
+		t.Errorf("expected Onion Soup related to Squash Soup, got %v", got)
+	}
+
+	// A new recipe is related to the recipes it is like, and they to it.
+	upsert(search.Recipe{Name: "Leek Soup", Webpath: "LeekSoup", Tags: []string{"Soup"}, Ingredients: []string{"leek", "stock"}})
+	related.Changed("LeekSoup")
+	if err := related.update(); err != nil {
+		t.Fatal(err)
+	}
+	if got := webpaths("LeekSoup"); len(got) != 2 {
+		t.Errorf("expected the soups related to Leek Soup, got %v", got)
+	}
+	if got := webpaths("SquashSoup"); !slices.Contains(got, "LeekSoup") {
+		t.Errorf("expected Leek Soup related to Squash Soup, got %v", got)
+	}
+
+	// A deleted recipe is dropped from the lists it was in.
+	if err := search.DeleteRecipe(idx, "OnionSoup"); err != nil {
+		t.Fatal(err)
+	}
+	related.Changed("OnionSoup")
+	if err := related.update(); err != nil {
+		t.Fatal(err)
+	}
+	if got := webpaths("SquashSoup"); slices.Contains(got, "OnionSoup") {
+		t.Errorf("expected Onion Soup gone from Squash Soup's related recipes, got %v", got)
+	}
+	if got := webpaths("Lemonade"); len(got) != 0 {
+		t.Errorf("expected nothing related to Lemonade, got %v", got)
+	}
+	related.mu.RLock()
+	_, ok := related.related["OnionSoup"]
+	related.mu.RUnlock()
+	if ok {
+		t.Error("expected the deleted recipe's related recipes removed")
+	}
+}
@@ -0,0 +1,161 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Role is what a signed in user may do.
+type Role string
+
+const (
+	RoleViewer Role = "viewer"
+	RoleEditor Role = "editor"
+	RoleAdmin  Role = "admin"
+)
+
+// Roles are the roles from least to most allowed.
+var Roles = []Role{RoleViewer, RoleEditor, RoleAdmin}
+
+// Permission is an action checked by the handlers.
+type Permission string
+
+const (
+	PermissionView   Permission = "view"
+	PermissionEdit   Permission = "edit"
+	PermissionDelete Permission = "delete"
+	PermissionImport Permission = "import"
+	PermissionShare  Permission = "share"
+	PermissionAdmin  Permission = "admin"
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleViewer: {PermissionView},
+	RoleEditor: {PermissionView, PermissionEdit, PermissionImport, PermissionShare},
+	RoleAdmin:  {PermissionView, PermissionEdit, PermissionDelete, PermissionImport, PermissionShare, PermissionAdmin},
+}
+
+// Valid reports whether r is one of Roles.
+func (r Role) Valid() bool {
+	return slices.Contains(Roles, r)
+}
+
+// Can reports whether the role has permission p.  The empty role, of users
+// who are not signed in, has none.
+func (r Role) Can(p Permission) bool {
+	return slices.Contains(rolePermissions[r], p)
+}
+
+// Max returns the more allowed of r and other.
+func (r Role) Max(other Role) Role {
+	if slices.Index(Roles, other) > slices.Index(Roles, r) {
+		return other
+	}
+	return r
+}
+
+// Min returns the less allowed of r and other, "" when either is "".
+func (r Role) Min(other Role) Role {
+	if !r.Valid() || !other.Valid() {
+		return ""
+	}
+	if slices.Index(Roles, other) < slices.Index(Roles, r) {
+		return other
+	}
+	return r
+}
+
+// FormUser is a FormBasedAuthUsers entry, the password hash, or a table with
+// the Password hash and the Role.  Users without a role are admins.
+type FormUser struct {
+	Password string
+	Role     Role
+}
+
+// UnmarshalTOML reads a password hash string or a table.
+func (u *FormUser) UnmarshalTOML(v any) error {
+	switch v := v.(type) {
+	case string:
+		*u = FormUser{Password: v, Role: RoleAdmin}
+	case map[string]any:
+		*u = FormUser{Role: RoleAdmin}
+		for key, value := range v {
+			s, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("%s must be a string", key)
+			}
+			switch key {
+			case "Password":
+				u.Password = s
+			case "Role":
+				u.Role = Role(s)
+			default:
+				return fmt.Errorf("unknown key %s", key)
+			}
+		}
+	default:
+		return fmt.Errorf("expected a password hash or a table, got %T", v)
+	}
+	if !u.Role.Valid() {
+		return fmt.Errorf("unknown role %q", u.Role)
+	}
+	return nil
+}
+
+type OIDCConfig struct {
+	Issuer             string
+	EndSessionEndpoint string
+	ClientID           string
+	ClientSecret       string
+	RedirectURI        string
+	// GroupsClaim are the groups a user must all be in to sign in.
+	GroupsClaim *[]string
+	// RolesClaim is the claim with the user's groups or roles, a string or a
+	// list of them.
+	RolesClaim string
+	// Roles maps values of RolesClaim to roles, a user gets the most allowed.
+	Roles map[string]Role
+	// DefaultRole is the role of users without any of Roles, "" refuses them.
+	DefaultRole Role
+}
+
+// Role returns the role of a user with the ID token claims, or "" when the
+// user may not sign in.
+func (c *OIDCConfig) Role(claims map[string]any) Role {
+	if c.GroupsClaim != nil && !containsAll(claimValues(claims["groups"]), *c.GroupsClaim) {
+		return ""
+	}
+	role := c.DefaultRole
+	for _, value := range claimValues(claims[c.RolesClaim]) {
+		if mapped, ok := c.Roles[value]; ok {
+			role = role.Max(mapped)
+		}
+	}
+	return role
+}
+
+// claimValues returns the strings of a claim, a string or a list.
+func claimValues(claim any) []string {
+	switch claim := claim.(type) {
+	case string:
+		return []string{claim}
+	case []any:
+		values := []string{}
+		for _, value := range claim {
+			if s, ok := value.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func containsAll(superset, subset []string) bool {
+	for _, item := range subset {
+		if !slices.Contains(superset, item) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,106 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/BurntSushi/toml"
+)
+
+func TestRoles(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		role       Role
+		permission Permission
+		want       bool
+	}{
+		{RoleViewer, PermissionView, true},
+		{RoleViewer, PermissionEdit, false},
+		{RoleEditor, PermissionEdit, true},
+		{RoleEditor, PermissionImport, true},
+		{RoleEditor, PermissionDelete, false},
+		{RoleViewer, PermissionShare, false},
+		{RoleEditor, PermissionShare, true},
+		{RoleAdmin, PermissionDelete, true},
+		{RoleAdmin, PermissionAdmin, true},
+		{"", PermissionView, false},
+	} {
+		if got := test.role.Can(test.permission); got != test.want {
+			t.Errorf("%q.Can(%s) = %v, expected %v", test.role, test.permission, got, test.want)
+		}
+	}
+
+	if got := RoleViewer.Max(RoleAdmin); got != RoleAdmin {
+		t.Errorf("expected admin, got %s", got)
+	}
+	if got := RoleAdmin.Min(RoleEditor); got != RoleEditor {
+		t.Errorf("expected editor, got %s", got)
+	}
+	if got := RoleAdmin.Min(""); got != "" {
+		t.Errorf("expected no role, got %s", got)
+	}
+}
+
+func TestFormUsers(t *testing.T) {
+	t.Parallel()
+
+	var config Config
+	_, err := toml.Decode(`
+[FormBasedAuthUsers]
+"alice" = "bcrypt$a$b"
+"bob" = { Password = "bcrypt$c$d", Role = "viewer" }
+`, &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := *config.FormBasedAuthUsers
+	if users["alice"] != (FormUser{Password: "bcrypt$a$b", Role: RoleAdmin}) {
+		t.Errorf("expected alice to be an admin, got %+v", users["alice"])
+	}
+	if users["bob"] != (FormUser{Password: "bcrypt$c$d", Role: RoleViewer}) {
+		t.Errorf("expected bob to be a viewer, got %+v", users["bob"])
+	}
+
+	if _, err := toml.Decode(`
+[FormBasedAuthUsers]
+"carol" = { Password = "x", Role = "chef" }
+`, &config); err == nil {
+		t.Error("expected an error for an unknown role")
+	}
+}
+
+func TestOIDCRole(t *testing.T) {
+	t.Parallel()
+
+	config := OIDCConfig{
+		RolesClaim: "groups",
+		Roles:      map[string]Role{"family": RoleViewer, "cooks": RoleEditor},
+	}
+	for _, test := range []struct {
+		claims map[string]any
+		want   Role
+	}{
+		{map[string]any{"groups": []any{"family", "cooks"}}, RoleEditor},
+		{map[string]any{"groups": "family"}, RoleViewer},
+		{map[string]any{"groups": []any{"other"}}, ""},
+		{map[string]any{}, ""},
+	} {
+		if got := config.Role(test.claims); got != test.want {
+			t.Errorf("%v: expected %q, got %q", test.claims, test.want, got)
+		}
+	}
+
+	config.DefaultRole = RoleViewer
+	if got := config.Role(map[string]any{}); got != RoleViewer {
+		t.Errorf("expected the default role, got %q", got)
+	}
+
+	// GroupsClaim still requires all of its groups.
+	config.GroupsClaim = &[]string{"cookbook"}
+	if got := config.Role(map[string]any{"groups": []any{"cooks"}}); got != "" {
+		t.Errorf("expected users outside GroupsClaim to be refused, got %q", got)
+	}
+	if got := config.Role(map[string]any{"groups": []any{"cookbook", "cooks"}}); got != RoleEditor {
+		t.Errorf("expected editor, got %q", got)
+	}
+}
@@ -0,0 +1,237 @@
+package core
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/securecookie"
+)
+
+var ErrShareNotFound = errors.New("share link not found")
+
+// ShareLink lets anyone with its URL view one recipe until it expires or is
+// revoked.
+type ShareLink struct {
+	ID      string    `json:"id"`
+	Owner   string    `json:"owner"`
+	Webpath string    `json:"webpath"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+}
+
+func (l ShareLink) Expired(now time.Time) bool {
+	return !now.Before(l.Expires)
+}
+
+// Shares are the share links of all recipes.  The links are signed with the
+// first of the keys and verified with any of them, and kept in a JSON file so
+// they can be listed and revoked.
+type Shares struct {
+	path string
+	keys [][]byte
+	// saveMu is held while the file is written, as for Tokens.
+	saveMu sync.Mutex
+
+	mu    sync.Mutex
+	links map[string]*ShareLink // by ID
+}
+
+// shareKeyLabel derives the share key from a session secret, so that links
+// are not signed with the session key itself.
+const shareKeyLabel = "cookbook share links"
+
+// NewShares reads the share links file, which need not exist yet.  Links are
+// signed with Server.ShareSecrets, or keys derived from
+// Server.SessionSecrets.  Without either share links are disabled, and it
+// returns nil Shares.
+func NewShares(config Config) (*Shares, error) {
+	s := &Shares{path: config.Server.SharesPath, links: map[string]*ShareLink{}}
+
+	secrets, derived := config.Server.ShareSecrets, false
+	if len(secrets) == 0 {
+		secrets, derived = config.Server.SessionSecrets, true
+	}
+	for _, secret := range secrets {
+		key, err := hex.DecodeString(secret)
+		if err != nil || len(key) == 0 {
+			return nil, errors.New("cannot read ShareSecrets config")
+		}
+		if derived {
+			mac := hmac.New(sha256.New, key)
+			mac.Write([]byte(shareKeyLabel))
+			key = mac.Sum(nil)
+		}
+		s.keys = append(s.keys, key)
+	}
+	if len(s.keys) == 0 {
+		return nil, nil
+	}
+
+	b, err := os.ReadFile(s.path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		links := []*ShareLink{}
+		if err := json.Unmarshal(b, &links); err != nil {
+			return nil, fmt.Errorf("%s: %w", s.path, err)
+		}
+		for _, link := range links {
+			s.links[link.ID] = link
+		}
+	}
+	return s, nil
+}
+
+// shareSignature returns the signature of a link with key.
+func shareSignature(key []byte, id, webpath string, expires int64) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id + "\n" + webpath + "\n" + strconv.FormatInt(expires, 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// URL returns the path and query of the link.
+func (s *Shares) URL(link ShareLink) string {
+	expires := link.Expires.Unix()
+	query := url.Values{
+		"id":      {link.ID},
+		"expires": {strconv.FormatInt(expires, 10)},
+		"sig":     {shareSignature(s.keys[0], link.ID, link.Webpath, expires)},
+	}
+	return "/share/" + url.PathEscape(link.Webpath) + "?" + query.Encode()
+}
+
+// Create adds a link to the recipe at webpath for owner, expiring at
+// expires.
+func (s *Shares) Create(owner, webpath string, expires time.Time) (ShareLink, error) {
+	link := ShareLink{
+		ID:      hex.EncodeToString(securecookie.GenerateRandomKey(8)),
+		Owner:   owner,
+		Webpath: webpath,
+		Created: time.Now().UTC(),
+		Expires: expires.UTC().Truncate(time.Second),
+	}
+
+	s.mu.Lock()
+	s.links[link.ID] = &link
+	s.mu.Unlock()
+
+	if err := s.save(); err != nil {
+		return ShareLink{}, err
+	}
+	return link, nil
+}
+
+// List returns the unexpired links to the recipe at webpath, newest first.
+func (s *Shares) List(webpath string) []ShareLink {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	links := []ShareLink{}
+	for _, link := range s.links {
+		if link.Webpath == webpath && !link.Expired(now) {
+			links = append(links, *link)
+		}
+	}
+	sort.Slice(links, func(i, j int) bool {
+		return links[i].Created.After(links[j].Created)
+	})
+	return links
+}
+
+// Revoke deletes a link to the recipe at webpath.
+func (s *Shares) Revoke(webpath, id string) error {
+	s.mu.Lock()
+	link, ok := s.links[id]
+	if !ok || link.Webpath != webpath {
+		s.mu.Unlock()
+		return ErrShareNotFound
+	}
+	delete(s.links, id)
+	s.mu.Unlock()
+
+	return s.save()
+}
+
+// Verify returns the link of the id, expires and sig query parameters when
+// it is an unexpired, unrevoked link to the recipe at webpath.  The caller
+// checks that its owner may still share.  It is safe to call on nil Shares,
+// which have no links.
+func (s *Shares) Verify(webpath string, query url.Values) (ShareLink, bool) {
+	if s == nil {
+		return ShareLink{}, false
+	}
+	id := query.Get("id")
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil || !time.Now().Before(time.Unix(expires, 0)) {
+		return ShareLink{}, false
+	}
+	sig := []byte(query.Get("sig"))
+	signed := false
+	for _, key := range s.keys {
+		if hmac.Equal(sig, []byte(shareSignature(key, id, webpath, expires))) {
+			signed = true
+			break
+		}
+	}
+	if !signed {
+		return ShareLink{}, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	link, ok := s.links[id]
+	if !ok || link.Webpath != webpath || link.Expires.Unix() != expires {
+		return ShareLink{}, false
+	}
+	return *link, true
+}
+
+// save writes the share links file without the expired links, readable only
+// by its owner.
+func (s *Shares) save() error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	now := time.Now()
+	s.mu.Lock()
+	links := make([]*ShareLink, 0, len(s.links))
+	for id, link := range s.links {
+		if link.Expired(now) {
+			delete(s.links, id)
+			continue
+		}
+		links = append(links, link)
+	}
+	sort.Slice(links, func(i, j int) bool {
+		return links[i].ID < links[j].ID
+	})
+	b, err := json.MarshalIndent(links, "", "  ")
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
@@ -0,0 +1,105 @@
+package core
+
+import (
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestShares(t *testing.T) {
+	t.Parallel()
+
+	config := Config{}
+	config.Server.SharesPath = filepath.Join(t.TempDir(), ".shares.json")
+	config.Server.SessionSecrets = []string{"0123456789abcdef0123456789abcdef"}
+	shares, err := NewShares(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	link, err := shares.Create("alice", "SquashSoup", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := shares.Create("alice", "SquashSoup", time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := func(link ShareLink) url.Values {
+		u, err := url.Parse(shares.URL(link))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u.Path != "/share/"+link.Webpath {
+			t.Errorf("expected the recipe's share path, got %s", u.Path)
+		}
+		return u.Query()
+	}
+
+	// Links are read back from the file.
+	shares, err = NewShares(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if verified, ok := shares.Verify("SquashSoup", query(link)); !ok || verified.Owner != "alice" {
+		t.Errorf("expected the link to be valid, got %+v", verified)
+	}
+	if _, ok := shares.Verify("Pasta", query(link)); ok {
+		t.Error("expected the link to be rejected for another recipe")
+	}
+	if _, ok := shares.Verify("SquashSoup", query(expired)); ok {
+		t.Error("expected an expired link to be rejected")
+	}
+	tampered := query(link)
+	tampered.Set("expires", "99999999999")
+	if _, ok := shares.Verify("SquashSoup", tampered); ok {
+		t.Error("expected a link with a changed expiry to be rejected")
+	}
+	if _, ok := (*Shares)(nil).Verify("SquashSoup", query(link)); ok {
+		t.Error("expected nil shares to reject every link")
+	}
+
+	// Links signed with another key are rejected.
+	other := config
+	other.Server.ShareSecrets = []string{"fedcba9876543210fedcba9876543210"}
+	otherShares, err := NewShares(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := otherShares.Verify("SquashSoup", query(link)); ok {
+		t.Error("expected a link signed with another key to be rejected")
+	}
+
+	if links := shares.List("SquashSoup"); len(links) != 1 || links[0].ID != link.ID {
+		t.Errorf("expected the unexpired link, got %+v", links)
+	}
+	if err := shares.Revoke("Pasta", link.ID); err != ErrShareNotFound {
+		t.Errorf("expected revoking another recipe's link to fail, got %v", err)
+	}
+	if err := shares.Revoke("SquashSoup", link.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := shares.Verify("SquashSoup", query(link)); ok {
+		t.Error("expected a revoked link to be rejected")
+	}
+}
+
+func TestSharesWithoutSecrets(t *testing.T) {
+	t.Parallel()
+
+	config := Config{}
+	config.Server.SharesPath = filepath.Join(t.TempDir(), "shares.json")
+	shares, err := NewShares(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shares != nil {
+		t.Error("expected share links disabled")
+	}
+	if _, ok := shares.Verify("SquashSoup", url.Values{}); ok {
+		t.Error("expected no links")
+	}
+}
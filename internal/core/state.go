@@ -2,7 +2,15 @@ package core
 
 import (
 	"log"
+	"maps"
 	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"text/template"
+	"time"
+
+	"cookbook/internal/search"
 
 	"github.com/BurntSushi/toml"
 	"github.com/blevesearch/bleve/v2"
@@ -13,36 +21,82 @@ var Version = "dev"
 
 type Config struct {
 	Server struct {
-		Address        string
-		RecipesPath    string
+		Address string
+		BaseURL string
+		// TrustForwardedHeaders uses the X-Forwarded-Proto and
+		// X-Forwarded-Host headers of a proxy for links without BaseURL.
+		TrustForwardedHeaders bool
+		RecipesPath           string
+		DraftsPath            string
+		// StatePath is the folder of the server's own files, like tokens,
+		// kept out of RecipesPath.
+		StatePath      string
+		TokensPath     string
+		SharesPath     string
 		SessionSecrets []string
-		CSRFKey        string
-		Language       string
-		SecureCookies  bool
-		LLM            *string
-	}
-	Google *struct {
-		APIKey *string
-		Model  *string
-	}
-	Ollama *struct {
-		ServerURL *string
-		Model     *string
-	}
-	OpenAI *struct {
-		Token   *string
-		BaseURL *string
-		Model   *string
-	}
-	OIDC *struct {
-		Issuer             string
-		EndSessionEndpoint string
-		ClientID           string
-		ClientSecret       string
-		RedirectURI        string
-		GroupsClaim        *[]string
-	}
-	FormBasedAuthUsers *map[string]string
+		// ShareSecrets sign share links, the first signs new links and the
+		// rest still verify.  They default to keys derived from
+		// SessionSecrets.
+		ShareSecrets  []string
+		CSRFKey       string
+		Language      string
+		Languages     []string
+		SecureCookies bool
+		// RequireLoginToView hides everything but the login page from users
+		// who are not signed in.
+		RequireLoginToView bool
+		LLM                *string
+		LLMFallback        []string
+		SuggestTags        bool
+	}
+	Import struct {
+		Concurrency   int
+		Interval      time.Duration
+		RepairRetries int
+		CrawledPrompt string
+		FetchedPrompt string
+	}
+	Embeddings struct {
+		Provider      string
+		Weight        float64
+		MinSimilarity float64
+		CachePath     string
+	}
+	Search struct {
+		SynonymsPath string
+		Boosts       search.Boosts
+	}
+	Pantry struct {
+		Staples []string
+	}
+	Related struct {
+		Count       int
+		Tags        float64
+		Ingredients float64
+		Terms       float64
+	}
+	Fetcher struct {
+		ConnectTimeout time.Duration
+		Timeout        time.Duration
+		MaxBodySize    int64
+		UserAgent      string
+		Proxy          string
+		// TrustProxy confirms that Proxy refuses private networks, which
+		// the Fetcher cannot check for hosts the proxy resolves.
+		TrustProxy      bool
+		AllowedNetworks []string
+	}
+	Webhook struct {
+		Timeout time.Duration
+		Retries int
+	}
+	Webhooks           []WebhookConfig
+	Google             *LLMProviderConfig
+	Ollama             *LLMProviderConfig
+	OpenAI             *LLMProviderConfig
+	Providers          map[string]LLMProviderConfig
+	OIDC               *OIDCConfig
+	FormBasedAuthUsers *map[string]FormUser
 }
 
 type AuthInfo struct {
@@ -71,17 +125,158 @@ type State struct {
 	SessionStore *sessions.CookieStore
 	Config       Config
 	Auth         Auth
+	BulkImports  *BulkImportJobs
+	Fetcher      *Fetcher
+	Embeddings   *Embeddings
+	Related      *RelatedRecipes
+	Tokens       *Tokens
+	Users        *Users
+	Shares       *Shares
+	Webhooks     *Webhooks
 }
 
 func LoadConfig(path string) Config {
 	config := Config{}
 	config.Server.SecureCookies = true
+	config.Import.Concurrency = 2
+	config.Import.Interval = 2 * time.Second
+	config.Import.RepairRetries = 2
+	config.Embeddings.Weight = 0.5
+	config.Embeddings.MinSimilarity = 0.5
+	config.Search.Boosts = search.DefaultBoosts
+	config.Related.Count = 5
+	config.Related.Tags = 3
+	config.Related.Ingredients = 2
+	config.Related.Terms = 1
+	config.Pantry.Staples = []string{"salt", "pepper", "oil", "water", "sugar", "flour", "butter"}
+	config.Webhook.Timeout = 10 * time.Second
+	config.Webhook.Retries = 5
+	config.Fetcher.ConnectTimeout = 10 * time.Second
+	config.Fetcher.Timeout = 30 * time.Second
+	config.Fetcher.MaxBodySize = 5 << 20
+	config.Fetcher.UserAgent = "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36"
 	_, err := toml.DecodeFile(path, &config)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	for _, prompt := range []string{config.Import.CrawledPrompt, config.Import.FetchedPrompt} {
+		if _, err := template.New("prompt").Parse(prompt); err != nil {
+			log.Fatal("cannot parse Import prompt config: ", err)
+		}
+	}
+
+	if config.OIDC != nil {
+		if config.OIDC.RolesClaim == "" {
+			config.OIDC.RolesClaim = "groups"
+		}
+		// Without a mapping, everyone who may sign in can do everything.
+		if len(config.OIDC.Roles) == 0 && config.OIDC.DefaultRole == "" {
+			config.OIDC.DefaultRole = RoleAdmin
+		}
+		for _, role := range append(slices.Collect(maps.Values(config.OIDC.Roles)), config.OIDC.DefaultRole) {
+			if role != "" && !role.Valid() {
+				log.Fatalf("unknown OIDC role %q", role)
+			}
+		}
+	}
+
+	if config.Server.DraftsPath == "" {
+		config.Server.DraftsPath = filepath.Join(config.Server.RecipesPath, ".drafts")
+	}
+
+	if config.Server.StatePath == "" {
+		config.Server.StatePath = defaultStatePath()
+	}
+
+	if config.Server.TokensPath == "" {
+		config.Server.TokensPath = filepath.Join(config.Server.StatePath, "tokens.json")
+		moveLegacyStateFile(filepath.Join(config.Server.RecipesPath, ".tokens.json"), config.Server.TokensPath)
+	}
+
+	if config.Server.SharesPath == "" {
+		config.Server.SharesPath = filepath.Join(config.Server.StatePath, "shares.json")
+		moveLegacyStateFile(filepath.Join(config.Server.RecipesPath, ".shares.json"), config.Server.SharesPath)
+	}
+
+	if config.Embeddings.CachePath == "" {
+		config.Embeddings.CachePath = filepath.Join(config.Server.RecipesPath, ".cache", "embeddings.json")
+	}
+
+	// The default language is always indexed, and comes first.
+	config.Server.Languages = append([]string{config.Server.Language}, slices.DeleteFunc(config.Server.Languages, func(language string) bool {
+		return language == config.Server.Language
+	})...)
+
+	if config.Search.SynonymsPath == "" {
+		config.Search.SynonymsPath = filepath.Join(config.Server.RecipesPath, "synonyms.txt")
+	}
+
 	// log.Printf("%+v", config)
 
 	return config
 }
+
+// defaultStatePath is $XDG_STATE_HOME/cookbook, or ~/.local/state/cookbook.
+func defaultStatePath() string {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "cookbook")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		log.Fatal("cannot find a folder for Server.StatePath: ", err)
+	}
+	return filepath.Join(home, ".local", "state", "cookbook")
+}
+
+// moveLegacyStateFile moves a file kept inside RecipesPath by earlier
+// versions to its path in StatePath, unless one is there already.
+func moveLegacyStateFile(legacy, path string) {
+	if _, err := os.Stat(legacy); err != nil {
+		return
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		log.Printf("ignoring %s, %s is used instead", legacy, path)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		log.Fatal(err)
+	}
+	if err := os.Rename(legacy, path); err != nil {
+		// Copy across file systems.
+		b, err := os.ReadFile(legacy)
+		if err == nil {
+			err = os.WriteFile(path, b, 0600)
+		}
+		if err == nil {
+			err = os.Remove(legacy)
+		}
+		if err != nil {
+			log.Fatalf("cannot move %s to %s: %v", legacy, path, err)
+		}
+	}
+	log.Printf("moved %s to %s", legacy, path)
+}
+
+// NewIndex creates the search index with the synonyms file, if there is one.
+func NewIndex(config Config) bleve.Index {
+	var synonyms [][]string
+	file, err := os.Open(config.Search.SynonymsPath)
+	if err == nil {
+		defer file.Close()
+		if synonyms, err = search.ParseSynonyms(file); err != nil {
+			log.Fatal("cannot read synonyms: ", err)
+		}
+	} else if !os.IsNotExist(err) {
+		log.Fatal("cannot read synonyms: ", err)
+	}
+	return search.NewIndex(config.Server.Languages, synonyms)
+}
+
+func (s *State) ImportOptions() ImportOptions {
+	return ImportOptions{
+		CrawledPrompt: s.Config.Import.CrawledPrompt,
+		FetchedPrompt: s.Config.Import.FetchedPrompt,
+		RepairRetries: s.Config.Import.RepairRetries,
+	}
+}
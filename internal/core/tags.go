@@ -0,0 +1,149 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"cookbook/internal/markdown"
+	"cookbook/internal/search"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// OtherTag groups recipes without tags, see markdown.ConvertToHtml.
+var OtherTag = "Other"
+
+var maxSuggestedTags = 5
+
+const SUGGEST_TAGS_PROMPT = `
+  Suggest up to %d tags to group this recipe on the index page of a cookbook, ex. the course, main
+  ingredient or cuisine.
+  Prefer these existing tags, only suggest a new tag when none of them fit: %s.
+  <recipe name=%q>
+  %s
+  </recipe>
+  The output should be JSON formatted with the following schema:
+  {
+    "type": "object",
+    "properties": {
+    	"tags": {
+    		"type": "array",
+    		"items": {"type": "string"},
+    		"description": "The suggested tags, most relevant first"
+    	}
+    },
+    "required": ["tags"]
+  }
+`
+
+// SuggestTags asks the LLM for tags for a recipe.  Suggestions matching an
+// existing tag use its spelling and come first.
+func SuggestTags(ctx context.Context, llm llms.Model, existing []string, name, body string) ([]string, error) {
+	existing = slices.DeleteFunc(slices.Clone(existing), func(tag string) bool { return tag == OtherTag })
+
+	prompt := fmt.Sprintf(SUGGEST_TAGS_PROMPT, maxSuggestedTags, strings.Join(existing, ", "), name, body)
+	completion, err := llms.GenerateFromSinglePrompt(ctx, llm, prompt, llms.WithJSONMode())
+	if err != nil {
+		return nil, fmt.Errorf("error generating content: %v", err)
+	}
+
+	slog.Info("LLM", "request", prompt, "response", completion)
+
+	var reply struct {
+		Tags []string `json:"tags"`
+	}
+	if err := json.Unmarshal([]byte(TrimCompletion(completion)), &reply); err != nil {
+		return nil, fmt.Errorf("error parsing response: %v", err)
+	}
+
+	known := []string{}
+	unknown := []string{}
+	seen := map[string]bool{}
+	for _, tag := range reply.Tags {
+		// A comma would split the tag on the tags: line.
+		tag = strings.Join(strings.Fields(strings.ReplaceAll(tag, ",", " ")), " ")
+		if i := slices.IndexFunc(existing, func(e string) bool { return strings.EqualFold(e, tag) }); i >= 0 {
+			tag = existing[i]
+			if !seen[strings.ToLower(tag)] {
+				known = append(known, tag)
+			}
+		} else if tag != "" && !strings.EqualFold(tag, OtherTag) && !seen[strings.ToLower(tag)] {
+			unknown = append(unknown, tag)
+		}
+		seen[strings.ToLower(tag)] = true
+	}
+
+	suggestions := append(known, unknown...)
+	if len(suggestions) > maxSuggestedTags {
+		suggestions = suggestions[:maxSuggestedTags]
+	}
+	return suggestions, nil
+}
+
+// SuggestRecipeTags suggests tags for a recipe using the Server.LLM provider
+// and the tags already in the index.
+func (s *State) SuggestRecipeTags(ctx context.Context, name, body string) ([]string, error) {
+	llm, err := LLMModel(ctx, s.Config)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := search.ListTags(s.Index, false)
+	if err != nil {
+		return nil, err
+	}
+	return SuggestTags(ctx, llm, existing, name, body)
+}
+
+// ProposeTags prints suggested tags for every recipe in the Other group.  When
+// write is true the suggestions are added to the recipe files.
+func (s *State) ProposeTags(ctx context.Context, out io.Writer, write bool) error {
+	webpaths := []string{}
+	for page := 1; ; page++ {
+		results, err := search.SearchRecipes(s.Index, "", search.Options{
+			Filters: search.Filters{Tags: []string{OtherTag}},
+			Page:    page,
+		})
+		if err != nil {
+			return err
+		}
+		for _, hit := range results.Hits {
+			webpaths = append(webpaths, hit.Webpath)
+		}
+		if !results.More {
+			break
+		}
+	}
+
+	for _, webpath := range webpaths {
+		recipe, err := search.GetRecipe(s.Index, webpath)
+		if err != nil {
+			return err
+		}
+		fp := filepath.Join(s.Config.Server.RecipesPath, recipe.Filename)
+		md, err := os.ReadFile(fp)
+		if err != nil {
+			return err
+		}
+
+		tags, err := s.SuggestRecipeTags(ctx, recipe.Name, string(md))
+		if err != nil {
+			fmt.Fprintf(out, "%s: error: %v\n", recipe.Name, err)
+			continue
+		}
+		fmt.Fprintf(out, "%s: %s\n", recipe.Name, strings.Join(tags, ", "))
+
+		if write && len(tags) > 0 {
+			if err := os.WriteFile(fp, []byte(markdown.SetTags(string(md), tags)), 0644); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package core
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/tmc/langchaingo/llms/fake"
+)
+
+func TestSuggestTags(t *testing.T) {
+	t.Parallel()
+
+	llm := fake.NewFakeLLM([]string{
+		"```json\n" + `{"tags": ["soup", "Vegetarian", "Other", "Soup", "Winter, Cozy"]}` + "\n```",
+	})
+	existing := []string{"Main", "Other", "Soup"}
+
+	tags, err := SuggestTags(context.Background(), llm, existing, "Squash Soup", "## Ingredients\n- squash")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"Soup", "Vegetarian", "Winter Cozy"}
+	if !slices.Equal(tags, expected) {
+		t.Errorf("expected %v, got %v", expected, tags)
+	}
+}
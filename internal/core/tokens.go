@@ -0,0 +1,229 @@
+package core
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/securecookie"
+)
+
+// TokenScope is what a personal access token may do.
+type TokenScope string
+
+const (
+	// ScopeRead tokens can only view, whatever the owner's role.
+	ScopeRead  TokenScope = "read"
+	ScopeWrite TokenScope = "write"
+)
+
+// tokenPrefix starts every token, so a leaked token is easy to recognize.
+const tokenPrefix = "cookbook_"
+
+// lastUsedInterval is how often a token's last use is written to the tokens
+// file.
+var lastUsedInterval = time.Minute
+
+var ErrTokenNotFound = errors.New("token not found")
+
+// Token is a personal access token.  Only the hash of the token is kept.
+type Token struct {
+	ID    string     `json:"id"`
+	Owner string     `json:"owner"`
+	Name  string     `json:"name"`
+	Scope TokenScope `json:"scope"`
+	// OwnerRole is the owner's role when the token was created, tokens
+	// created before roles have none.
+	OwnerRole Role `json:"role,omitempty"`
+	// Hash is the SHA-256 of the token.
+	Hash    string    `json:"hash"`
+	Created time.Time `json:"created"`
+	// Expires is zero for a token that does not expire.
+	Expires  time.Time `json:"expires"`
+	LastUsed time.Time `json:"lastUsed"`
+}
+
+func (t Token) Expired(now time.Time) bool {
+	return !t.Expires.IsZero() && !now.Before(t.Expires)
+}
+
+// Role is what requests with the token may do, the owner's role limited by
+// the scope.
+func (t Token) Role() Role {
+	role := cmp.Or(t.OwnerRole, RoleEditor)
+	if t.Scope != ScopeWrite {
+		return role.Min(RoleViewer)
+	}
+	return role
+}
+
+// Tokens are the personal access tokens of all users, kept in a JSON file.
+type Tokens struct {
+	path string
+	// saveMu is held while the file is written, so that saves do not
+	// interleave or replace a newer file with an older one.
+	saveMu sync.Mutex
+
+	mu     sync.Mutex
+	tokens map[string]*Token // by ID
+}
+
+// NewTokens reads the tokens file at path, which need not exist yet.
+func NewTokens(path string) (*Tokens, error) {
+	t := &Tokens{path: path, tokens: map[string]*Token{}}
+
+	b, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		tokens := []*Token{}
+		if err := json.Unmarshal(b, &tokens); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for _, token := range tokens {
+			t.tokens[token.ID] = token
+		}
+	}
+	return t, nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create adds a token for owner, who has role, expiring at expires unless it
+// is zero.  It returns the token, which cannot be shown again.
+func (t *Tokens) Create(owner string, role Role, name string, scope TokenScope, expires time.Time) (string, Token, error) {
+	if scope != ScopeRead && scope != ScopeWrite {
+		return "", Token{}, fmt.Errorf("unknown scope %q", scope)
+	}
+
+	id := hex.EncodeToString(securecookie.GenerateRandomKey(8))
+	secret := tokenPrefix + id + "_" + base64.RawURLEncoding.EncodeToString(securecookie.GenerateRandomKey(32))
+	token := Token{
+		ID:        id,
+		Owner:     owner,
+		Name:      name,
+		Scope:     scope,
+		OwnerRole: role,
+		Hash:      hashToken(secret),
+		Created:   time.Now().UTC(),
+		Expires:   expires,
+	}
+
+	t.mu.Lock()
+	t.tokens[id] = &token
+	t.mu.Unlock()
+
+	if err := t.save(); err != nil {
+		return "", Token{}, err
+	}
+	return secret, token, nil
+}
+
+// List returns the tokens of owner, newest first.
+func (t *Tokens) List(owner string) []Token {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tokens := []Token{}
+	for _, token := range t.tokens {
+		if token.Owner == owner {
+			tokens = append(tokens, *token)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].Created.After(tokens[j].Created)
+	})
+	return tokens
+}
+
+// Revoke deletes a token of owner.
+func (t *Tokens) Revoke(owner, id string) error {
+	t.mu.Lock()
+	token, ok := t.tokens[id]
+	if !ok || token.Owner != owner {
+		t.mu.Unlock()
+		return ErrTokenNotFound
+	}
+	delete(t.tokens, id)
+	t.mu.Unlock()
+
+	return t.save()
+}
+
+// Verify returns the unexpired token matching secret and records its use.
+// It is safe to call on nil Tokens, which have no tokens.
+func (t *Tokens) Verify(secret string) (Token, bool) {
+	if t == nil {
+		return Token{}, false
+	}
+	id, _, found := strings.Cut(strings.TrimPrefix(secret, tokenPrefix), "_")
+	if !found || !strings.HasPrefix(secret, tokenPrefix) {
+		return Token{}, false
+	}
+
+	now := time.Now().UTC()
+
+	t.mu.Lock()
+	token, ok := t.tokens[id]
+	if !ok || subtle.ConstantTimeCompare([]byte(token.Hash), []byte(hashToken(secret))) != 1 || token.Expired(now) {
+		t.mu.Unlock()
+		return Token{}, false
+	}
+	save := now.Sub(token.LastUsed) >= lastUsedInterval
+	token.LastUsed = now
+	verified := *token
+	t.mu.Unlock()
+
+	if save {
+		if err := t.save(); err != nil {
+			slog.Error("saving token last use", "error", err)
+		}
+	}
+	return verified, true
+}
+
+// save writes the tokens file, readable only by its owner.
+func (t *Tokens) save() error {
+	t.saveMu.Lock()
+	defer t.saveMu.Unlock()
+
+	t.mu.Lock()
+	tokens := make([]*Token, 0, len(t.tokens))
+	for _, token := range t.tokens {
+		tokens = append(tokens, token)
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].ID < tokens[j].ID
+	})
+	b, err := json.MarshalIndent(tokens, "", "  ")
+	t.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(t.path), 0755); err != nil {
+		return err
+	}
+	tmp := t.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, t.path)
+}
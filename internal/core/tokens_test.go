@@ -0,0 +1,79 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokens(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), ".tokens.json")
+	tokens, err := NewTokens(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret, created, err := tokens.Create("alice", RoleAdmin, "backup", ScopeRead, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, _, err := tokens.Create("alice", RoleAdmin, "old", ScopeWrite, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := tokens.Create("alice", RoleAdmin, "bad", "admin", time.Time{}); err == nil {
+		t.Error("expected an error for an unknown scope")
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), secret) {
+		t.Error("tokens file contains the token")
+	}
+
+	// Tokens are read back from the file.
+	tokens, err = NewTokens(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, ok := tokens.Verify(secret)
+	if !ok || token.ID != created.ID || token.Scope != ScopeRead || token.LastUsed.IsZero() {
+		t.Errorf("expected the read token with its last use, got %+v, %v", token, ok)
+	}
+	if token.Role() != RoleViewer {
+		t.Errorf("expected a read token to view only, got %s", token.Role())
+	}
+	if _, ok := tokens.Verify(expired); ok {
+		t.Error("expected an expired token to be rejected")
+	}
+	if _, ok := tokens.Verify(secret + "x"); ok {
+		t.Error("expected a wrong token to be rejected")
+	}
+	if _, ok := (*Tokens)(nil).Verify(secret); ok {
+		t.Error("expected nil tokens to reject every token")
+	}
+
+	if list := tokens.List("alice"); len(list) != 2 || list[0].Name != "old" {
+		t.Errorf("expected alice's tokens newest first, got %+v", list)
+	}
+	if list := tokens.List("bob"); len(list) != 0 {
+		t.Errorf("expected no tokens for bob, got %+v", list)
+	}
+
+	if err := tokens.Revoke("bob", created.ID); err != ErrTokenNotFound {
+		t.Errorf("expected another user's token not to be found, got %v", err)
+	}
+	if err := tokens.Revoke("alice", created.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tokens.Verify(secret); ok {
+		t.Error("expected a revoked token to be rejected")
+	}
+}
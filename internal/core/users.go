@@ -0,0 +1,85 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Users keeps the role of each OIDC user at their last sign in, kept in a
+// JSON file, so that their tokens and share links follow a change of role.
+// Form based users' roles are in the config.
+type Users struct {
+	path string
+	// saveMu is held while the file is written, as for Tokens.
+	saveMu sync.Mutex
+
+	mu    sync.Mutex
+	roles map[string]Role // by subject
+}
+
+// NewUsers reads the users file at path, which need not exist yet.
+func NewUsers(path string) (*Users, error) {
+	u := &Users{path: path, roles: map[string]Role{}}
+
+	b, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(b, &u.roles); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return u, nil
+}
+
+// Role returns the role of the user sub at their last sign in, "" when they
+// have none.  It is safe to call on nil Users, which have no users.
+func (u *Users) Role(sub string) Role {
+	if u == nil {
+		return ""
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.roles[sub]
+}
+
+// SetRole records the role of the user sub as they sign in, "" when they may
+// no longer sign in.  Nil Users record nothing.
+func (u *Users) SetRole(sub string, role Role) error {
+	if u == nil {
+		return nil
+	}
+	u.saveMu.Lock()
+	defer u.saveMu.Unlock()
+
+	u.mu.Lock()
+	if u.roles[sub] == role {
+		u.mu.Unlock()
+		return nil
+	}
+	if role == "" {
+		delete(u.roles, sub)
+	} else {
+		u.roles[sub] = role
+	}
+	b, err := json.MarshalIndent(u.roles, "", "  ")
+	u.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(u.path), 0700); err != nil {
+		return err
+	}
+	tmp := u.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, u.path)
+}
@@ -0,0 +1,48 @@
+package core
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestUsers(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "state", "users.json")
+	users, err := NewUsers(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := users.SetRole("alice", RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	if err := users.SetRole("bob", RoleEditor); err != nil {
+		t.Fatal(err)
+	}
+	// Bob was demoted.
+	if err := users.SetRole("bob", RoleViewer); err != nil {
+		t.Fatal(err)
+	}
+
+	// Roles are read back from the file.
+	users, err = NewUsers(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role := users.Role("alice"); role != RoleAdmin {
+		t.Errorf("expected alice to be an admin, got %q", role)
+	}
+	if role := users.Role("bob"); role != RoleViewer {
+		t.Errorf("expected bob's latest role, got %q", role)
+	}
+
+	if err := users.SetRole("bob", ""); err != nil {
+		t.Fatal(err)
+	}
+	if role := users.Role("bob"); role != "" {
+		t.Errorf("expected bob to have no role, got %q", role)
+	}
+	if role := (*Users)(nil).Role("alice"); role != "" {
+		t.Errorf("expected nil users to have no roles, got %q", role)
+	}
+}
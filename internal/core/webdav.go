@@ -0,0 +1,226 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+// recipesFileSystem is the files of RecipesPath for WebDAV.  Only the recipe
+// files directly in RecipesPath are served, the ones the watcher indexes, and
+// other files and dotfiles like .drafts and .cache are hidden.  Changes are indexed
+// right away, as the watcher would.
+type recipesFileSystem struct {
+	state *State
+	dir   webdav.Dir
+}
+
+// RecipesFileSystem serves RecipesPath over WebDAV.
+func (s *State) RecipesFileSystem() webdav.FileSystem {
+	return &recipesFileSystem{state: s, dir: webdav.Dir(s.Config.Server.RecipesPath)}
+}
+
+// filename returns the recipe file in RecipesPath that name refers to, "" for
+// RecipesPath itself, or false when it is not served.
+func (f *recipesFileSystem) filename(name string) (string, bool) {
+	if strings.ContainsRune(name, 0) || strings.Contains(name, "\\") {
+		return "", false
+	}
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		return "", true
+	}
+	if strings.Contains(name, "/") || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, RecipeExt) {
+		return "", false
+	}
+	return name, true
+}
+
+func (f *recipesFileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	return os.ErrPermission
+}
+
+func (f *recipesFileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	filename, ok := f.filename(name)
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	writing := flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0
+	if filename == "" {
+		if writing {
+			return nil, os.ErrPermission
+		}
+		file, err := f.dir.OpenFile(ctx, name, flag, perm)
+		if err != nil {
+			return nil, err
+		}
+		return recipesDir{file}, nil
+	}
+
+	if info, err := f.dir.Stat(ctx, filename); err == nil && info.IsDir() {
+		return nil, os.ErrNotExist
+	}
+	// WebDAV only writes whole files, in PUT, COPY and MOVE, and LOCK
+	// creates missing files the same way.  PROPPATCH opens files for writing
+	// but does not write them.
+	if !writing || flag&os.O_TRUNC == 0 {
+		return f.dir.OpenFile(ctx, filename, os.O_RDONLY, 0)
+	}
+	return &writtenFile{fs: f, filename: filename, perm: perm, modTime: time.Now()}, nil
+}
+
+func (f *recipesFileSystem) RemoveAll(ctx context.Context, name string) error {
+	filename, ok := f.filename(name)
+	if !ok {
+		return os.ErrNotExist
+	}
+	if filename == "" {
+		return os.ErrPermission
+	}
+	RecipeWrites.Lock()
+	defer RecipeWrites.Unlock()
+	if _, err := f.Stat(ctx, filename); err != nil {
+		return err
+	}
+	if err := f.dir.RemoveAll(ctx, filename); err != nil {
+		return err
+	}
+	f.state.recipeFileRemoved(filename)
+	return nil
+}
+
+func (f *recipesFileSystem) Rename(ctx context.Context, oldName, newName string) error {
+	from, ok := f.filename(oldName)
+	to, newOK := f.filename(newName)
+	if !ok || !newOK {
+		return os.ErrNotExist
+	}
+	if from == "" || to == "" {
+		return os.ErrPermission
+	}
+	RecipeWrites.Lock()
+	defer RecipeWrites.Unlock()
+	if _, err := f.Stat(ctx, from); err != nil {
+		return err
+	}
+	if err := f.dir.Rename(ctx, from, to); err != nil {
+		return err
+	}
+	f.state.recipeFileRemoved(from)
+	f.changed(to)
+	return nil
+}
+
+func (f *recipesFileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	filename, ok := f.filename(name)
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	info, err := f.dir.Stat(ctx, filename)
+	if err == nil && filename != "" && info.IsDir() {
+		return nil, os.ErrNotExist
+	}
+	return info, err
+}
+
+func (f *recipesFileSystem) changed(filename string) {
+	if err := f.state.recipeFileChanged(filename); err != nil {
+		slog.Error("error indexing recipe file", "filename", filename, "error", err)
+	}
+}
+
+// recipesDir lists the files of RecipesPath that are served.
+type recipesDir struct {
+	webdav.File
+}
+
+// Readdir keeps to the os.File contract: with a count, it returns some files
+// or an error, io.EOF at the end, so it reads past runs of hidden files.
+func (d recipesDir) Readdir(count int) ([]fs.FileInfo, error) {
+	for {
+		infos, err := d.File.Readdir(count)
+		served := infos[:0]
+		for _, info := range infos {
+			if !info.IsDir() && !strings.HasPrefix(info.Name(), ".") && strings.HasSuffix(info.Name(), RecipeExt) {
+				served = append(served, info)
+			}
+		}
+		if count <= 0 || len(served) > 0 || err != nil {
+			return served, err
+		}
+	}
+}
+
+// errEmptyRecipe is returned when closing a new file with nothing written,
+// which is not created.
+var errEmptyRecipe = errors.New("an empty recipe file is not created")
+
+// writtenFile keeps what is written to a recipe file, and writes and indexes
+// the file when it is closed, holding RecipeWrites, so that the watcher and
+// other writers never see it half written.  A new file with nothing written,
+// as LOCK opens a missing file, is not created at all.
+type writtenFile struct {
+	fs       *recipesFileSystem
+	filename string
+	perm     os.FileMode
+	modTime  time.Time
+	buf      bytes.Buffer
+}
+
+func (w *writtenFile) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *writtenFile) Read(p []byte) (int, error) {
+	return 0, os.ErrPermission
+}
+
+func (w *writtenFile) Seek(offset int64, whence int) (int64, error) {
+	return 0, os.ErrPermission
+}
+
+func (w *writtenFile) Readdir(count int) ([]fs.FileInfo, error) {
+	return nil, os.ErrInvalid
+}
+
+func (w *writtenFile) Stat() (fs.FileInfo, error) {
+	return writtenFileInfo{w}, nil
+}
+
+func (w *writtenFile) Close() error {
+	RecipeWrites.Lock()
+	defer RecipeWrites.Unlock()
+
+	filename := filepath.Join(w.fs.state.Config.Server.RecipesPath, w.filename)
+	if w.buf.Len() == 0 {
+		if _, err := os.Stat(filename); errors.Is(err, fs.ErrNotExist) {
+			return errEmptyRecipe
+		}
+	}
+	if err := os.WriteFile(filename, w.buf.Bytes(), w.perm); err != nil {
+		return err
+	}
+	w.fs.changed(w.filename)
+	return nil
+}
+
+// writtenFileInfo describes a writtenFile before it is closed.
+type writtenFileInfo struct {
+	w *writtenFile
+}
+
+func (i writtenFileInfo) Name() string       { return i.w.filename }
+func (i writtenFileInfo) Size() int64        { return int64(i.w.buf.Len()) }
+func (i writtenFileInfo) Mode() fs.FileMode  { return i.w.perm }
+func (i writtenFileInfo) ModTime() time.Time { return i.w.modTime }
+func (i writtenFileInfo) IsDir() bool        { return false }
+func (i writtenFileInfo) Sys() any           { return nil }
@@ -0,0 +1,163 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cookbook/internal/search"
+)
+
+func TestRecipesFileSystem(t *testing.T) {
+	t.Parallel()
+
+	state := &State{Index: search.NewIndex([]string{"en"}, nil)}
+	defer state.Index.Close()
+	state.Config.Server.RecipesPath = t.TempDir()
+	if err := os.WriteFile(filepath.Join(state.Config.Server.RecipesPath, ".tokens.json"), []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(state.Config.Server.RecipesPath, "notes.txt"), []byte("notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(state.Config.Server.RecipesPath, "folder"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	davFS := state.RecipesFileSystem()
+
+	file, err := davFS.OpenFile(ctx, "/Cake.md", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Write([]byte("# Cake\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if recipe, err := search.GetRecipe(state.Index, "Cake"); err != nil || recipe == nil {
+		t.Fatalf("expected the written recipe to be indexed, got %v, %v", recipe, err)
+	}
+
+	if err := davFS.Rename(ctx, "/Cake.md", "/Torte.md"); err != nil {
+		t.Fatal(err)
+	}
+	if recipe, _ := search.GetRecipe(state.Index, "Cake"); recipe != nil {
+		t.Error("expected the renamed recipe to be removed")
+	}
+	if recipe, _ := search.GetRecipe(state.Index, "Torte"); recipe == nil {
+		t.Error("expected the renamed recipe to be indexed")
+	}
+
+	dir, err := davFS.OpenFile(ctx, "/", os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	infos, err := dir.Readdir(0)
+	dir.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || infos[0].Name() != "Torte.md" {
+		t.Errorf("expected only the recipe to be listed, got %v", infos)
+	}
+
+	// Listing one file at a time skips the hidden files and ends with EOF.
+	dir, err = davFS.OpenFile(ctx, "/", os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for {
+		infos, err := dir.Readdir(1)
+		for _, info := range infos {
+			names = append(names, info.Name())
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(infos) == 0 {
+			t.Fatal("expected a file or an error")
+		}
+	}
+	dir.Close()
+	if len(names) != 1 || names[0] != "Torte.md" {
+		t.Errorf("expected only the recipe to be listed, got %v", names)
+	}
+
+	if err := davFS.Rename(ctx, "/Torte.md", "/Torte.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected a recipe not to be renamed to another extension, got %v", err)
+	}
+
+	for _, name := range []string{"/.tokens.json", "/../.tokens.json", "/folder", "/folder/x.md", "/.drafts/x.md", "/notes.txt", "/new.txt"} {
+		if _, err := davFS.Stat(ctx, name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected %s to be hidden, got %v", name, err)
+		}
+		if _, err := davFS.OpenFile(ctx, name, os.O_RDWR|os.O_CREATE, 0644); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected %s not to be writable, got %v", name, err)
+		}
+	}
+	if err := davFS.Mkdir(ctx, "/new", 0755); err == nil {
+		t.Error("expected folders not to be created")
+	}
+	if err := davFS.RemoveAll(ctx, "/"); err == nil {
+		t.Error("expected the recipes folder not to be removed")
+	}
+
+	// LOCK opens a missing file and closes it without writing.
+	file, err = davFS.OpenFile(ctx, "/Locked.md", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err == nil {
+		t.Error("expected an empty recipe not to be created")
+	}
+	if _, err := os.Stat(filepath.Join(state.Config.Server.RecipesPath, "Locked.md")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected no file for a lock, got %v", err)
+	}
+
+	// Writes wait for the other writers of recipes, and are only seen once
+	// closed.
+	file, err = davFS.OpenFile(ctx, "/Torte.md", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Write([]byte("# Torte\n\n- nuts\n")); err != nil {
+		t.Fatal(err)
+	}
+	if md, err := os.ReadFile(filepath.Join(state.Config.Server.RecipesPath, "Torte.md")); err != nil || string(md) != "# Cake\n" {
+		t.Errorf("expected the file unchanged until closed, got %q, %v", md, err)
+	}
+	RecipeWrites.Lock()
+	closed := make(chan error)
+	go func() { closed <- file.Close() }()
+	select {
+	case <-closed:
+		t.Error("expected the write to wait for the lock")
+	case <-time.After(50 * time.Millisecond):
+	}
+	RecipeWrites.Unlock()
+	if err := <-closed; err != nil {
+		t.Fatal(err)
+	}
+	if md, err := os.ReadFile(filepath.Join(state.Config.Server.RecipesPath, "Torte.md")); err != nil || string(md) != "# Torte\n\n- nuts\n" {
+		t.Errorf("expected the written file, got %q, %v", md, err)
+	}
+
+	if err := davFS.RemoveAll(ctx, "/Torte.md"); err != nil {
+		t.Fatal(err)
+	}
+	if recipe, _ := search.GetRecipe(state.Index, "Torte"); recipe != nil {
+		t.Error("expected the removed recipe to be removed from the index")
+	}
+}
@@ -0,0 +1,505 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"cookbook/internal/search"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/gorilla/securecookie"
+)
+
+// The events webhooks are sent for.
+const (
+	EventCreated         = "created"
+	EventUpdated         = "updated"
+	EventDeleted         = "deleted"
+	EventRenamed         = "renamed"
+	EventImportCompleted = "import-completed"
+)
+
+var WebhookEvents = []string{EventCreated, EventUpdated, EventDeleted, EventRenamed, EventImportCompleted}
+
+var (
+	// webhookDelay groups the file changes of an edit, like the write and
+	// remove of a rename, into events.
+	webhookDelay = time.Second
+	// webhookBackoff is the wait before the first retry of a delivery, and
+	// doubles with each retry.
+	webhookBackoff = 2 * time.Second
+	// webhookRetryTime limits how long a delivery is retried, which holds up
+	// the webhook's later events.
+	webhookRetryTime = 2 * time.Minute
+	webhookLogSize   = 100
+	webhookQueueLen  = 100
+)
+
+type WebhookConfig struct {
+	URL    string
+	Secret string
+	// Events are the events sent, all of them when empty.
+	Events []string
+}
+
+// WebhookRecipe is a recipe in a webhook payload.
+type WebhookRecipe struct {
+	Name    string   `json:"name"`
+	Webpath string   `json:"webpath"`
+	URL     string   `json:"url,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+}
+
+// WebhookImport is a finished bulk import in a webhook payload.
+type WebhookImport struct {
+	ID       string   `json:"id"`
+	Total    int      `json:"total"`
+	Imported int      `json:"imported"`
+	Skipped  int      `json:"skipped"`
+	Failed   int      `json:"failed"`
+	Drafts   []string `json:"drafts,omitempty"`
+}
+
+// WebhookPayload is the JSON body POSTed to webhooks.
+type WebhookPayload struct {
+	ID       string         `json:"id"`
+	Event    string         `json:"event"`
+	Time     time.Time      `json:"time"`
+	Recipe   *WebhookRecipe `json:"recipe,omitempty"`
+	Previous *WebhookRecipe `json:"previous,omitempty"`
+	Import   *WebhookImport `json:"import,omitempty"`
+}
+
+// WebhookDelivery is an entry of the delivery log.
+type WebhookDelivery struct {
+	ID         string
+	Event      string
+	URL        string
+	Time       time.Time
+	Attempts   int
+	StatusCode int
+	Error      string
+	Done       bool
+}
+
+// Delivered reports whether the webhook accepted the delivery.
+func (d WebhookDelivery) Delivered() bool {
+	return d.StatusCode >= 200 && d.StatusCode < 300
+}
+
+// WebhookSignature is the X-Cookbook-Signature header of body.
+func WebhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// recipeChange is the file changes of a recipe since the last events.
+type recipeChange struct {
+	name    string
+	existed bool
+	removed bool
+	hash    [sha256.Size]byte
+	// prevHash is the content before the changes, when it existed.
+	prevHash [sha256.Size]byte
+	at       time.Time
+}
+
+type webhook struct {
+	WebhookConfig
+	queue chan WebhookPayload
+}
+
+// Webhooks POSTs signed events to the configured webhooks.  Recipe events are
+// made from the changes seen by the recipes directory watcher, so edits in the
+// browser and in the directory are alike.
+type Webhooks struct {
+	index   bleve.Index
+	baseURL string
+	hooks   []*webhook
+	client  *http.Client
+	retries int
+
+	mu      sync.Mutex
+	hashes  map[string][sha256.Size]byte
+	changes map[string]*recipeChange
+	renames map[string]string
+	log     []*WebhookDelivery
+	wake    chan struct{}
+}
+
+// NewWebhooks returns nil when no webhooks are configured.
+func NewWebhooks(index bleve.Index, config Config) (*Webhooks, error) {
+	if len(config.Webhooks) == 0 {
+		return nil, nil
+	}
+	w := &Webhooks{
+		index:   index,
+		baseURL: strings.TrimSuffix(config.Server.BaseURL, "/"),
+		client:  &http.Client{Timeout: config.Webhook.Timeout},
+		retries: config.Webhook.Retries,
+		hashes:  map[string][sha256.Size]byte{},
+		changes: map[string]*recipeChange{},
+		renames: map[string]string{},
+		wake:    make(chan struct{}, 1),
+	}
+	for _, hook := range config.Webhooks {
+		if u, err := url.Parse(hook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("webhook url %q is not an http url", hook.URL)
+		}
+		for _, event := range hook.Events {
+			if !slices.Contains(WebhookEvents, event) {
+				return nil, fmt.Errorf("webhook %s: unknown event %q", hook.URL, event)
+			}
+		}
+		w.hooks = append(w.hooks, &webhook{
+			WebhookConfig: hook,
+			queue:         make(chan WebhookPayload, webhookQueueLen),
+		})
+	}
+	return w, nil
+}
+
+// Loaded records the content of a recipe indexed at startup, which is not an
+// event.
+func (w *Webhooks) Loaded(webpath string, md []byte) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.hashes[webpath] = sha256.Sum256(md)
+}
+
+func (w *Webhooks) change(webpath, name string) *recipeChange {
+	c, ok := w.changes[webpath]
+	if !ok {
+		hash, existed := w.hashes[webpath]
+		c = &recipeChange{name: name, existed: existed, prevHash: hash}
+		w.changes[webpath] = c
+	}
+	c.at = time.Now()
+	return c
+}
+
+func (w *Webhooks) wakeUp() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Upserted records that a recipe file was written.
+func (w *Webhooks) Upserted(webpath, name string, md []byte) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	c := w.change(webpath, name)
+	c.name = name
+	c.removed = false
+	c.hash = sha256.Sum256(md)
+	w.hashes[webpath] = c.hash
+	w.mu.Unlock()
+	w.wakeUp()
+}
+
+// Removed records that a recipe file was removed or renamed.
+func (w *Webhooks) Removed(webpath, name string) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	c := w.change(webpath, name)
+	c.removed = true
+	delete(w.hashes, webpath)
+	w.mu.Unlock()
+	w.wakeUp()
+}
+
+// Renaming tells that the recipe at from is about to be saved as to, so the
+// changes are a rename even when the content changes too.
+func (w *Webhooks) Renaming(from, to string) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.renames[from] = to
+}
+
+// ImportCompleted sends the import-completed event of a finished bulk import.
+func (w *Webhooks) ImportCompleted(job *BulkImportJob) {
+	if w == nil {
+		return
+	}
+	results, _ := job.Status()
+	imported := &WebhookImport{ID: job.ID, Total: job.Total}
+	for _, result := range results {
+		switch {
+		case result.Skipped:
+			imported.Skipped++
+		case result.Err != nil:
+			imported.Failed++
+		default:
+			imported.Imported++
+			imported.Drafts = append(imported.Drafts, result.Draft)
+		}
+	}
+	w.send(WebhookPayload{Event: EventImportCompleted, Import: imported})
+}
+
+// events turns the recorded changes into events, oldest first.  A removed
+// recipe and a created one with the same content, or announced by Renaming,
+// are a rename.
+func (w *Webhooks) events() []WebhookPayload {
+	w.mu.Lock()
+	changes, renames := w.changes, w.renames
+	w.changes, w.renames = map[string]*recipeChange{}, map[string]string{}
+	w.mu.Unlock()
+
+	var deleted, created []string
+	for webpath, c := range changes {
+		switch {
+		case c.existed && c.removed:
+			deleted = append(deleted, webpath)
+		case !c.existed && !c.removed:
+			created = append(created, webpath)
+		}
+	}
+	slices.Sort(deleted)
+	slices.Sort(created)
+
+	type event struct {
+		payload WebhookPayload
+		at      time.Time
+	}
+	var events []event
+	for _, from := range deleted {
+		old := changes[from]
+		i := slices.IndexFunc(created, func(to string) bool {
+			return renames[from] == to || changes[to].hash == old.prevHash
+		})
+		if i < 0 {
+			events = append(events, event{WebhookPayload{
+				Event:  EventDeleted,
+				Recipe: &WebhookRecipe{Name: old.name, Webpath: from},
+			}, old.at})
+			continue
+		}
+		to := created[i]
+		created = slices.Delete(created, i, i+1)
+		events = append(events, event{WebhookPayload{
+			Event:    EventRenamed,
+			Recipe:   w.recipe(to, changes[to].name),
+			Previous: &WebhookRecipe{Name: old.name, Webpath: from},
+		}, changes[to].at})
+	}
+	for _, webpath := range created {
+		events = append(events, event{WebhookPayload{
+			Event:  EventCreated,
+			Recipe: w.recipe(webpath, changes[webpath].name),
+		}, changes[webpath].at})
+	}
+	for webpath, c := range changes {
+		if c.existed && !c.removed && c.hash != c.prevHash {
+			events = append(events, event{WebhookPayload{
+				Event:  EventUpdated,
+				Recipe: w.recipe(webpath, c.name),
+			}, c.at})
+		}
+	}
+
+	slices.SortStableFunc(events, func(a, b event) int {
+		return a.at.Compare(b.at)
+	})
+	payloads := make([]WebhookPayload, 0, len(events))
+	for _, e := range events {
+		payloads = append(payloads, e.payload)
+	}
+	return payloads
+}
+
+// recipe describes the indexed recipe at webpath.
+func (w *Webhooks) recipe(webpath, name string) *WebhookRecipe {
+	recipe := &WebhookRecipe{Name: name, Webpath: webpath}
+	if w.baseURL != "" {
+		recipe.URL = w.baseURL + "/recipe/" + url.PathEscape(webpath)
+	}
+	if indexed, err := search.GetRecipe(w.index, webpath); err == nil && indexed != nil {
+		recipe.Tags = indexed.Tags
+	}
+	return recipe
+}
+
+// send queues payload for the webhooks subscribed to its event.
+func (w *Webhooks) send(payload WebhookPayload) {
+	payload.ID = fmt.Sprintf("%x", securecookie.GenerateRandomKey(8))
+	payload.Time = time.Now().UTC()
+	for _, hook := range w.hooks {
+		if len(hook.Events) > 0 && !slices.Contains(hook.Events, payload.Event) {
+			continue
+		}
+		select {
+		case hook.queue <- payload:
+		default:
+			slog.Error("webhook queue is full, dropping event", "url", hook.URL, "event", payload.Event)
+			w.logDelivery(WebhookDelivery{
+				ID:    payload.ID,
+				Event: payload.Event,
+				URL:   hook.URL,
+				Time:  payload.Time,
+				Error: "dropped, too many events waiting",
+				Done:  true,
+			})
+		}
+	}
+}
+
+// Run sends the events of recipe changes, and delivers events to each webhook
+// in order, until ctx is done.
+func (w *Webhooks) Run(ctx context.Context) {
+	for _, hook := range w.hooks {
+		go w.deliverAll(ctx, hook)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.wake:
+		}
+
+		// Wait until the changes settle.
+		for settled := false; !settled; {
+			select {
+			case <-ctx.Done():
+				return
+			case <-w.wake:
+			case <-time.After(webhookDelay):
+				settled = true
+			}
+		}
+
+		for _, payload := range w.events() {
+			w.send(payload)
+		}
+	}
+}
+
+func (w *Webhooks) deliverAll(ctx context.Context, hook *webhook) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case payload := <-hook.queue:
+			w.deliver(ctx, hook, payload)
+		}
+	}
+}
+
+// deliver POSTs payload to hook, retrying with a doubling backoff while the
+// request fails or the webhook answers with a server error or 429, for up to
+// Webhook.Retries retries within webhookRetryTime.
+func (w *Webhooks) deliver(ctx context.Context, hook *webhook, payload WebhookPayload) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		slog.Error("error encoding webhook payload", "error", err)
+		return
+	}
+	delivery := w.logDelivery(WebhookDelivery{
+		ID:    payload.ID,
+		Event: payload.Event,
+		URL:   hook.URL,
+		Time:  payload.Time,
+	})
+
+	backoff := webhookBackoff
+	deadline := time.Now().Add(webhookRetryTime)
+	for attempt := 1; ; attempt++ {
+		status, err := w.post(ctx, hook, payload, body)
+		retry := err != nil || status >= 500 || status == http.StatusTooManyRequests
+		done := !retry || attempt > w.retries || time.Now().Add(backoff).After(deadline)
+
+		w.mu.Lock()
+		delivery.Attempts = attempt
+		delivery.StatusCode = status
+		delivery.Error = ""
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+		delivery.Done = done
+		w.mu.Unlock()
+
+		if done {
+			if retry {
+				slog.Error("webhook delivery failed", "url", hook.URL, "event", payload.Event, "status", status, "error", err)
+			}
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (w *Webhooks) post(ctx context.Context, hook *webhook, payload WebhookPayload, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Cookbook-Webhook/"+Version)
+	req.Header.Set("X-Cookbook-Event", payload.Event)
+	req.Header.Set("X-Cookbook-Delivery", payload.ID)
+	if hook.Secret != "" {
+		req.Header.Set("X-Cookbook-Signature", WebhookSignature(hook.Secret, body))
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func (w *Webhooks) logDelivery(delivery WebhookDelivery) *WebhookDelivery {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	d := &delivery
+	w.log = append(w.log, d)
+	if len(w.log) > webhookLogSize {
+		w.log = w.log[len(w.log)-webhookLogSize:]
+	}
+	return d
+}
+
+// Deliveries returns the most recent deliveries, newest first.
+func (w *Webhooks) Deliveries() []WebhookDelivery {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	deliveries := make([]WebhookDelivery, 0, len(w.log))
+	for i := len(w.log) - 1; i >= 0; i-- {
+		deliveries = append(deliveries, *w.log[i])
+	}
+	return deliveries
+}
@@ -0,0 +1,181 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"cookbook/internal/search"
+)
+
+func TestWebhooks(t *testing.T) {
+	webhookDelay = 10 * time.Millisecond
+	webhookBackoff = time.Millisecond
+
+	var mu sync.Mutex
+	var received []WebhookPayload
+	failures := 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("X-Cookbook-Signature") != WebhookSignature("secret", body) {
+			t.Errorf("bad signature %q", r.Header.Get("X-Cookbook-Signature"))
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var payload WebhookPayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Error(err)
+		}
+		if r.Header.Get("X-Cookbook-Event") != payload.Event {
+			t.Errorf("expected the %s event header, got %q", payload.Event, r.Header.Get("X-Cookbook-Event"))
+		}
+		received = append(received, payload)
+	}))
+	defer server.Close()
+
+	index := search.NewIndex([]string{"en"}, nil)
+	defer index.Close()
+
+	config := Config{Webhooks: []WebhookConfig{{URL: server.URL, Secret: "secret"}}}
+	config.Webhook.Retries = 2
+	config.Webhook.Timeout = time.Second
+	webhooks, err := NewWebhooks(index, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go webhooks.Run(ctx)
+
+	wait := func(count int) []WebhookPayload {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+			mu.Lock()
+			if len(received) >= count {
+				payloads := received
+				received = nil
+				mu.Unlock()
+				return payloads
+			}
+			mu.Unlock()
+		}
+		t.Fatalf("expected %d events, got %+v", count, received)
+		return nil
+	}
+
+	webhooks.Loaded("Pasta", []byte("# Pasta"))
+	webhooks.Loaded("Soup", []byte("# Soup"))
+
+	// A write and a remove with the same content is a rename, and a file
+	// written and removed again is nothing.
+	webhooks.Upserted("Noodles", "Noodles", []byte("# Pasta"))
+	webhooks.Removed("Pasta", "Pasta")
+	webhooks.Upserted("Scratch", "Scratch", []byte("x"))
+	webhooks.Removed("Scratch", "Scratch")
+	payloads := wait(1)
+	if p := payloads[0]; p.Event != EventRenamed || p.Recipe.Webpath != "Noodles" || p.Previous.Webpath != "Pasta" {
+		t.Errorf("expected Pasta renamed to Noodles, got %+v", p)
+	}
+
+	// Renaming makes a rename of changed content too.
+	webhooks.Renaming("Soup", "Stew")
+	webhooks.Upserted("Stew", "Stew", []byte("# Stew"))
+	webhooks.Removed("Soup", "Soup")
+	webhooks.Upserted("Cake", "Cake", []byte("# Cake"))
+	webhooks.Upserted("Cake", "Cake", []byte("# Cake\n\nMore"))
+	payloads = wait(2)
+	if p := payloads[0]; p.Event != EventRenamed || p.Previous.Webpath != "Soup" {
+		t.Errorf("expected Soup renamed, got %+v", p)
+	}
+	if p := payloads[1]; p.Event != EventCreated || p.Recipe.Webpath != "Cake" {
+		t.Errorf("expected Cake created, got %+v", p)
+	}
+
+	// Writing the same content again is not an update.
+	webhooks.Upserted("Stew", "Stew", []byte("# Stew"))
+	webhooks.Upserted("Cake", "Cake", []byte("# Cake"))
+	webhooks.Removed("Noodles", "Noodles")
+	payloads = wait(2)
+	if p := payloads[0]; p.Event != EventUpdated || p.Recipe.Webpath != "Cake" {
+		t.Errorf("expected Cake updated, got %+v", p)
+	}
+	if p := payloads[1]; p.Event != EventDeleted || p.Recipe.Webpath != "Noodles" {
+		t.Errorf("expected Noodles deleted, got %+v", p)
+	}
+
+	job := &BulkImportJob{ID: "job", Total: 2, results: []BulkImportResult{{Draft: "Pie"}, {Skipped: true}}}
+	webhooks.ImportCompleted(job)
+	payloads = wait(1)
+	if p := payloads[0]; p.Event != EventImportCompleted || p.Import.Imported != 1 || p.Import.Skipped != 1 {
+		t.Errorf("expected the import summary, got %+v", p)
+	}
+
+	deliveries := webhooks.Deliveries()
+	if len(deliveries) != 6 {
+		t.Fatalf("expected 6 deliveries, got %+v", deliveries)
+	}
+	if last := deliveries[len(deliveries)-1]; last.Attempts != 2 || !last.Delivered() {
+		t.Errorf("expected the first delivery to be retried, got %+v", last)
+	}
+}
+
+func TestWebhooksConfig(t *testing.T) {
+	t.Parallel()
+
+	if webhooks, err := NewWebhooks(nil, Config{}); webhooks != nil || err != nil {
+		t.Errorf("expected no webhooks, got %v, %v", webhooks, err)
+	}
+	for _, hook := range []WebhookConfig{
+		{URL: "ftp://example.com"},
+		{URL: "https://example.com", Events: []string{"eaten"}},
+	} {
+		if _, err := NewWebhooks(nil, Config{Webhooks: []WebhookConfig{hook}}); err == nil {
+			t.Errorf("expected an error for %+v", hook)
+		}
+	}
+}
+
+func TestWebhooksGiveUp(t *testing.T) {
+	webhookBackoff = time.Millisecond
+	webhookRetryTime = 20 * time.Millisecond
+
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	config := Config{Webhooks: []WebhookConfig{{URL: server.URL}}}
+	config.Webhook.Retries = 1000
+	config.Webhook.Timeout = time.Second
+	webhooks, err := NewWebhooks(nil, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hook := webhooks.hooks[0]
+
+	// Retries stop after webhookRetryTime, whatever Webhook.Retries.
+	webhooks.deliver(context.Background(), hook, WebhookPayload{ID: "1", Event: EventCreated})
+	if attempts < 2 || attempts > 10 {
+		t.Errorf("expected a few attempts, got %d", attempts)
+	}
+
+	// Events for a full queue are dropped and logged.
+	for range webhookQueueLen + 1 {
+		webhooks.send(WebhookPayload{Event: EventDeleted})
+	}
+	if d := webhooks.Deliveries()[0]; !d.Done || d.Error == "" || d.Event != EventDeleted {
+		t.Errorf("expected the dropped event in the delivery log, got %+v", d)
+	}
+}
@@ -0,0 +1,683 @@
+package handlers
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"cookbook/internal/core"
+	"cookbook/internal/search"
+)
+
+// apiMaxBody is the largest request body the API reads.
+var apiMaxBody int64 = 1 << 20
+
+// apiResponse is the JSON body of an API response, or its error as
+// {"error": "..."}.
+type apiResponse struct {
+	response
+	Body any
+	// ETag is the version of the recipe in the body.
+	ETag string
+	// Location is the url of a created resource.
+	Location string
+}
+
+type apiErrorBody struct {
+	Error string `json:"error"`
+}
+
+func apiError(statusCode int, msg string) apiResponse {
+	return apiResponse{response: errorResponse(statusCode, msg)}
+}
+
+func writeAPIResponse(w http.ResponseWriter, resp apiResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	if resp.ETag != "" {
+		w.Header().Set("ETag", `"`+resp.ETag+`"`)
+	}
+	if resp.Location != "" {
+		w.Header().Set("Location", resp.Location)
+	}
+
+	body := resp.Body
+	if resp.Error != "" {
+		body = apiErrorBody{Error: resp.Error}
+	}
+	w.WriteHeader(cmp.Or(resp.StatusCode, http.StatusOK))
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Error(err.Error())
+	}
+}
+
+func makeAPIHandler(state core.State, handle func(core.State, *http.Request) apiResponse) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeAPIResponse(w, handle(state, r))
+	}
+}
+
+// decodeAPIBody reads the JSON request body into v.
+func decodeAPIBody(r *http.Request, v any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(nil, r.Body, apiMaxBody))
+	if err := decoder.Decode(v); err != nil {
+		return errors.New("invalid JSON body: " + err.Error())
+	}
+	return nil
+}
+
+// recipeVersion identifies the content of a recipe file, updates must name
+// the version they change.
+func recipeVersion(md []byte) string {
+	sum := sha256.Sum256(md)
+	return hex.EncodeToString(sum[:8])
+}
+
+// requestedVersion returns the version in the If-Match header, or else the
+// version of the body.
+func requestedVersion(r *http.Request, bodyVersion string) string {
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		return strings.Trim(strings.TrimPrefix(strings.TrimSpace(ifMatch), "W/"), `"`)
+	}
+	return bodyVersion
+}
+
+// emptyIfNil returns s, or an empty slice for nil, so it is encoded as [].
+func emptyIfNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+func apiRecipeURL(webpath string) string {
+	return "/api/v1/recipes/" + url.PathEscape(webpath)
+}
+
+type apiRecipeSummary struct {
+	Name    string `json:"name"`
+	Webpath string `json:"webpath"`
+}
+
+type apiRecipeList struct {
+	Recipes []apiRecipeSummary `json:"recipes"`
+	Total   uint64             `json:"total"`
+	Page    int                `json:"page"`
+	More    bool               `json:"more"`
+}
+
+type apiRecipeMetadata struct {
+	Tags        []string  `json:"tags"`
+	Source      string    `json:"source,omitempty"`
+	Imported    string    `json:"imported,omitempty"`
+	Course      string    `json:"course,omitempty"`
+	Language    string    `json:"language,omitempty"`
+	Visibility  string    `json:"visibility"`
+	Time        *float64  `json:"time,omitempty"`
+	Servings    *float64  `json:"servings,omitempty"`
+	Ingredients []string  `json:"ingredients"`
+	Added       time.Time `json:"added"`
+	Modified    time.Time `json:"modified"`
+}
+
+type apiRecipe struct {
+	Name    string `json:"name"`
+	Webpath string `json:"webpath"`
+	Version string `json:"version"`
+	// Markdown is the recipe file, HTML its rendering.
+	Markdown string            `json:"markdown"`
+	HTML     string            `json:"html"`
+	Metadata apiRecipeMetadata `json:"metadata"`
+}
+
+// apiRecipeInput creates or updates a recipe.  Updates keep the name, or the
+// markdown, when left out.
+type apiRecipeInput struct {
+	Name     string  `json:"name,omitempty"`
+	Markdown *string `json:"markdown,omitempty"`
+	Version  string  `json:"version,omitempty"`
+}
+
+// apiSavedRecipe is the response to a recipe write, the index catches up
+// with the file shortly after.
+type apiSavedRecipe struct {
+	Name    string `json:"name"`
+	Webpath string `json:"webpath"`
+	Version string `json:"version,omitempty"`
+}
+
+type apiSearchHit struct {
+	Name    string `json:"name"`
+	Webpath string `json:"webpath"`
+	// Snippet is HTML with the matching words in <mark> elements.
+	Snippet string `json:"snippet"`
+}
+
+type apiSearchResults struct {
+	Hits      []apiSearchHit `json:"hits"`
+	Total     uint64         `json:"total"`
+	Page      int            `json:"page"`
+	More      bool           `json:"more"`
+	Fuzzy     bool           `json:"fuzzy"`
+	Corrected string         `json:"corrected,omitempty"`
+}
+
+type apiTags struct {
+	Tags []string `json:"tags"`
+}
+
+type apiImportInput struct {
+	URL  string   `json:"url,omitempty"`
+	URLs []string `json:"urls,omitempty"`
+}
+
+type apiImportResult struct {
+	URL     string `json:"url"`
+	Draft   string `json:"draft,omitempty"`
+	Skipped bool   `json:"skipped,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+type apiImport struct {
+	ID      string            `json:"id"`
+	Total   int               `json:"total"`
+	Done    bool              `json:"done"`
+	Results []apiImportResult `json:"results"`
+}
+
+// apiRecipeFile returns the indexed recipe at webpath with its file.
+func apiRecipeFile(state core.State, webpath string) (*search.Recipe, []byte, apiResponse) {
+	recipe, err := search.GetRecipe(state.Index, webpath)
+	if err == search.ErrNotFound {
+		return nil, nil, apiError(http.StatusNotFound, webpath)
+	}
+	if err != nil {
+		slog.Error(err.Error())
+		return nil, nil, apiError(http.StatusInternalServerError, err.Error())
+	}
+
+	md, err := os.ReadFile(filepath.Join(state.Config.Server.RecipesPath, recipe.Filename))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, apiError(http.StatusNotFound, webpath)
+	}
+	if err != nil {
+		slog.Error(err.Error())
+		return nil, nil, apiError(http.StatusInternalServerError, err.Error())
+	}
+	return recipe, md, apiResponse{}
+}
+
+func handleAPIRecipes(state core.State, r *http.Request) apiResponse {
+	switch r.Method {
+	case "GET":
+		params := indexParamsFromQuery(r.URL.Query())
+		results, err := state.SearchRecipes(r.Context(), "", search.Options{
+			Filters: search.Filters{Public: makeStateData(state, r).public()},
+			Sort:    params.Sort,
+			Page:    params.Page,
+		})
+		if err != nil {
+			slog.Error(err.Error())
+			return apiError(http.StatusInternalServerError, err.Error())
+		}
+
+		list := apiRecipeList{Recipes: []apiRecipeSummary{}, Total: results.Total, Page: params.Page, More: results.More}
+		for _, hit := range results.Hits {
+			list.Recipes = append(list.Recipes, apiRecipeSummary{Name: hit.PlainName, Webpath: hit.Webpath})
+		}
+		return apiResponse{Body: list}
+	case "POST":
+		if resp := makeStateData(state, r).require(core.PermissionEdit); resp.Error != "" {
+			return apiResponse{response: resp}
+		}
+
+		var input apiRecipeInput
+		if err := decodeAPIBody(r, &input); err != nil {
+			return apiError(http.StatusBadRequest, err.Error())
+		}
+		md := ""
+		if input.Markdown != nil {
+			md = *input.Markdown
+		}
+
+		core.RecipeWrites.Lock()
+		defer core.RecipeWrites.Unlock()
+
+		webpath, resp := saveRecipe(state, input.Name, md, "")
+		if resp.Error != "" {
+			return apiResponse{response: resp}
+		}
+
+		version := recipeVersion([]byte(md))
+		return apiResponse{
+			response: response{StatusCode: http.StatusCreated},
+			Body:     apiSavedRecipe{Name: recipeName(input.Name), Webpath: webpath, Version: version},
+			ETag:     version,
+			Location: apiRecipeURL(webpath),
+		}
+	default:
+		return apiError(http.StatusMethodNotAllowed, r.Method)
+	}
+}
+
+func handleAPIRecipe(state core.State, r *http.Request) apiResponse {
+	webpath := r.PathValue("path")
+
+	switch r.Method {
+	case "GET":
+		recipe, md, resp := apiRecipeFile(state, webpath)
+		if resp.Error != "" {
+			return resp
+		}
+		if recipe.Private() && makeStateData(state, r).public() {
+			return apiError(http.StatusNotFound, webpath)
+		}
+
+		version := recipeVersion(md)
+		return apiResponse{
+			Body: apiRecipe{
+				Name:     recipe.Name,
+				Webpath:  recipe.Webpath,
+				Version:  version,
+				Markdown: string(md),
+				HTML:     recipe.HTML,
+				Metadata: apiRecipeMetadata{
+					Tags:        emptyIfNil(recipe.Tags),
+					Source:      recipe.Source,
+					Imported:    recipe.Imported,
+					Course:      recipe.Course,
+					Language:    recipe.Language,
+					Visibility:  recipe.Visibility,
+					Time:        recipe.Time,
+					Servings:    recipe.Servings,
+					Ingredients: emptyIfNil(recipe.Ingredients),
+					Added:       recipe.Added,
+					Modified:    recipe.Modified,
+				},
+			},
+			ETag: version,
+		}
+	case "PUT":
+		if resp := makeStateData(state, r).require(core.PermissionEdit); resp.Error != "" {
+			return apiResponse{response: resp}
+		}
+
+		var input apiRecipeInput
+		if err := decodeAPIBody(r, &input); err != nil {
+			return apiError(http.StatusBadRequest, err.Error())
+		}
+
+		core.RecipeWrites.Lock()
+		defer core.RecipeWrites.Unlock()
+
+		recipe, md, resp := apiRecipeFile(state, webpath)
+		if resp.Error != "" {
+			return resp
+		}
+
+		version := requestedVersion(r, input.Version)
+		if version == "" {
+			return apiError(http.StatusPreconditionRequired, "send the version being updated in If-Match or version")
+		}
+		if version != recipeVersion(md) {
+			return apiError(http.StatusPreconditionFailed, "the recipe changed since version "+version)
+		}
+
+		name := cmp.Or(input.Name, recipe.Name)
+		body := string(md)
+		if input.Markdown != nil {
+			body = *input.Markdown
+		}
+
+		newWebpath, saveResp := saveRecipe(state, name, body, recipe.Filename)
+		if saveResp.Error != "" {
+			return apiResponse{response: saveResp}
+		}
+
+		newVersion := recipeVersion([]byte(body))
+		return apiResponse{
+			Body:     apiSavedRecipe{Name: recipeName(name), Webpath: newWebpath, Version: newVersion},
+			ETag:     newVersion,
+			Location: apiRecipeURL(newWebpath),
+		}
+	case "DELETE":
+		if resp := makeStateData(state, r).require(core.PermissionDelete); resp.Error != "" {
+			return apiResponse{response: resp}
+		}
+
+		core.RecipeWrites.Lock()
+		defer core.RecipeWrites.Unlock()
+
+		recipe, md, resp := apiRecipeFile(state, webpath)
+		if resp.Error != "" {
+			return resp
+		}
+
+		// Deletes need not name a version, but must match one if they do.
+		if version := requestedVersion(r, ""); version != "" && version != "*" && version != recipeVersion(md) {
+			return apiError(http.StatusPreconditionFailed, "the recipe changed since version "+version)
+		}
+
+		if deleteResp := deleteRecipe(state, recipe.Filename); deleteResp.Error != "" {
+			return apiResponse{response: deleteResp}
+		}
+		return apiResponse{response: response{StatusCode: http.StatusOK}, Body: apiSavedRecipe{Name: recipe.Name, Webpath: webpath}}
+	default:
+		return apiError(http.StatusMethodNotAllowed, r.Method)
+	}
+}
+
+func handleAPISearch(state core.State, r *http.Request) apiResponse {
+	if r.Method != "GET" {
+		return apiError(http.StatusMethodNotAllowed, r.Method)
+	}
+
+	params := indexParamsFromQuery(r.URL.Query())
+	params.Filters.Public = makeStateData(state, r).public()
+	results, err := state.SearchRecipes(r.Context(), params.Query, search.Options{
+		Filters: params.Filters,
+		Sort:    params.Sort,
+		Page:    params.Page,
+	})
+	var queryErr *search.QueryError
+	if errors.As(err, &queryErr) {
+		return apiError(http.StatusBadRequest, queryErr.Error())
+	}
+	if err != nil {
+		slog.Error(err.Error())
+		return apiError(http.StatusInternalServerError, err.Error())
+	}
+
+	body := apiSearchResults{
+		Hits:      []apiSearchHit{},
+		Total:     results.Total,
+		Page:      params.Page,
+		More:      results.More,
+		Fuzzy:     results.Fuzzy,
+		Corrected: results.Corrected,
+	}
+	for _, hit := range results.Hits {
+		body.Hits = append(body.Hits, apiSearchHit{Name: hit.PlainName, Webpath: hit.Webpath, Snippet: string(hit.Snippet)})
+	}
+	return apiResponse{Body: body}
+}
+
+func handleAPITags(state core.State, r *http.Request) apiResponse {
+	if r.Method != "GET" {
+		return apiError(http.StatusMethodNotAllowed, r.Method)
+	}
+
+	tags, err := search.ListTags(state.Index, makeStateData(state, r).public())
+	if err != nil {
+		slog.Error(err.Error())
+		return apiError(http.StatusInternalServerError, err.Error())
+	}
+	return apiResponse{Body: apiTags{Tags: tags}}
+}
+
+func apiImportStatus(job *core.BulkImportJob) apiImport {
+	results, done := job.Status()
+	status := apiImport{ID: job.ID, Total: job.Total, Done: done, Results: []apiImportResult{}}
+	for _, result := range results {
+		item := apiImportResult{URL: result.URL, Draft: result.Draft, Skipped: result.Skipped}
+		if result.Err != nil {
+			item.Error = result.Err.Error()
+		}
+		status.Results = append(status.Results, item)
+	}
+	return status
+}
+
+// handleAPIImport starts importing the recipes at urls as drafts, like the
+// bulk import page.
+func handleAPIImport(state core.State, r *http.Request) apiResponse {
+	if r.Method != "POST" {
+		return apiError(http.StatusMethodNotAllowed, r.Method)
+	}
+	sd := makeStateData(state, r)
+	if resp := sd.require(core.PermissionImport); resp.Error != "" {
+		return apiResponse{response: resp}
+	}
+	if !sd.HasImport {
+		return apiError(http.StatusForbidden, "import not configured")
+	}
+
+	var input apiImportInput
+	if err := decodeAPIBody(r, &input); err != nil {
+		return apiError(http.StatusBadRequest, err.Error())
+	}
+
+	urls, err := core.ParseURLList(strings.Join(append([]string{input.URL}, input.URLs...), "\n"))
+	if err != nil {
+		return apiError(http.StatusBadRequest, err.Error())
+	}
+	if len(urls) == 0 {
+		return apiError(http.StatusBadRequest, "no urls to import")
+	}
+
+	llm, err := core.LLMModel(r.Context(), state.Config)
+	if err != nil {
+		slog.Error(err.Error())
+		return apiError(http.StatusInternalServerError, err.Error())
+	}
+
+	job := state.StartBulkImport(llm, state.Fetcher.Request, urls)
+	return apiResponse{
+		response: response{StatusCode: http.StatusAccepted},
+		Body:     apiImportStatus(job),
+		Location: "/api/v1/import/" + job.ID,
+	}
+}
+
+func handleAPIImportStatus(state core.State, r *http.Request) apiResponse {
+	if r.Method != "GET" {
+		return apiError(http.StatusMethodNotAllowed, r.Method)
+	}
+	if resp := makeStateData(state, r).require(core.PermissionImport); resp.Error != "" {
+		return apiResponse{response: resp}
+	}
+
+	job := state.BulkImports.Get(r.PathValue("id"))
+	if job == nil {
+		return apiError(http.StatusNotFound, "import not found")
+	}
+	return apiResponse{Body: apiImportStatus(job)}
+}
+
+// apiRoute is a route of the API with the operations of each method it
+// accepts, which the OpenAPI description is generated from.
+type apiRoute struct {
+	Pattern string
+	Handle  func(core.State, *http.Request) apiResponse
+	// Parameters are the path parameters of the pattern.
+	Parameters []apiParameter
+	Operations []apiOperation
+}
+
+type apiParameter struct {
+	// In is "path", "query" or "header".
+	In          string
+	Name        string
+	Description string
+	Array       bool
+}
+
+type apiOperation struct {
+	Method  string
+	Summary string
+	// Parameters are the query and header parameters.
+	Parameters []apiParameter
+	// Request is a value of the type of the JSON request body, nil for none.
+	Request any
+	Status  int
+	// Response is a value of the type of the JSON response body.
+	Response any
+	// ETag and Location are the response headers set.
+	ETag     bool
+	Location bool
+	// Auth is whether the operation needs a session or a token with a role
+	// allowing it.
+	Auth bool
+	// Errors are the status codes of error responses besides 400 for an
+	// invalid body, 401 and 403 for missing authentication or permission, and
+	// 500.
+	Errors []int
+}
+
+var (
+	pageParameter = apiParameter{In: "query", Name: "page", Description: "Page of results, starting at 1."}
+	sortParameter = apiParameter{In: "query", Name: "sort", Description: "Order by name, added, modified or time, or by relevance when empty."}
+	pathParameter = apiParameter{In: "path", Name: "path", Description: "The recipe's webpath, ex. SquashSoup."}
+	ifMatchHeader = apiParameter{In: "header", Name: "If-Match", Description: "The version of the recipe being changed, from its ETag."}
+)
+
+var apiRoutes = []apiRoute{
+	{
+		Pattern: "/api/v1/recipes",
+		Handle:  handleAPIRecipes,
+		Operations: []apiOperation{
+			{
+				Method:     "GET",
+				Summary:    "List recipes by name, a page at a time.",
+				Parameters: []apiParameter{pageParameter, sortParameter},
+				Status:     http.StatusOK,
+				Response:   apiRecipeList{},
+			},
+			{
+				Method:   "POST",
+				Summary:  "Create a recipe.",
+				Request:  apiRecipeInput{},
+				Status:   http.StatusCreated,
+				Response: apiSavedRecipe{},
+				ETag:     true,
+				Location: true,
+				Auth:     true,
+				Errors:   []int{http.StatusConflict},
+			},
+		},
+	},
+	{
+		Pattern:    "/api/v1/recipes/{path}",
+		Handle:     handleAPIRecipe,
+		Parameters: []apiParameter{pathParameter},
+		Operations: []apiOperation{
+			{
+				Method:   "GET",
+				Summary:  "Get a recipe's markdown, rendered HTML, metadata and version.",
+				Status:   http.StatusOK,
+				Response: apiRecipe{},
+				ETag:     true,
+				Errors:   []int{http.StatusNotFound},
+			},
+			{
+				Method:     "PUT",
+				Summary:    "Update or rename a recipe, if it is still at the version in If-Match or the body.",
+				Parameters: []apiParameter{ifMatchHeader},
+				Request:    apiRecipeInput{},
+				Status:     http.StatusOK,
+				Response:   apiSavedRecipe{},
+				ETag:       true,
+				Location:   true,
+				Auth:       true,
+				Errors:     []int{http.StatusNotFound, http.StatusConflict, http.StatusPreconditionFailed, http.StatusPreconditionRequired},
+			},
+			{
+				Method:     "DELETE",
+				Summary:    "Delete a recipe, if it is still at the version in If-Match when given.",
+				Parameters: []apiParameter{ifMatchHeader},
+				Status:     http.StatusOK,
+				Response:   apiSavedRecipe{},
+				Auth:       true,
+				Errors:     []int{http.StatusNotFound, http.StatusPreconditionFailed},
+			},
+		},
+	},
+	{
+		Pattern: "/api/v1/search",
+		Handle:  handleAPISearch,
+		Operations: []apiOperation{
+			{
+				Method:  "GET",
+				Summary: "Search recipes.",
+				Parameters: []apiParameter{
+					{In: "query", Name: "q", Description: "The search, in the query syntax, ex. squash tag:soup."},
+					{In: "query", Name: "tag", Description: "Only recipes with all of the tags.", Array: true},
+					{In: "query", Name: "course", Description: "Only recipes of the course."},
+					{In: "query", Name: "language", Description: "Only recipes in the language, ex. en."},
+					{In: "query", Name: "time", Description: "Only recipes with a cook time in the range 15, 30, 60 or 60+."},
+					sortParameter,
+					pageParameter,
+				},
+				Status:   http.StatusOK,
+				Response: apiSearchResults{},
+				Errors:   []int{http.StatusBadRequest},
+			},
+		},
+	},
+	{
+		Pattern: "/api/v1/tags",
+		Handle:  handleAPITags,
+		Operations: []apiOperation{
+			{
+				Method:   "GET",
+				Summary:  "List the tags of all recipes.",
+				Status:   http.StatusOK,
+				Response: apiTags{},
+			},
+		},
+	},
+	{
+		Pattern: "/api/v1/import",
+		Handle:  handleAPIImport,
+		Operations: []apiOperation{
+			{
+				Method:   "POST",
+				Summary:  "Start importing recipes from urls as drafts.",
+				Request:  apiImportInput{},
+				Status:   http.StatusAccepted,
+				Response: apiImport{},
+				Location: true,
+				Auth:     true,
+			},
+		},
+	},
+	{
+		Pattern:    "/api/v1/import/{id}",
+		Handle:     handleAPIImportStatus,
+		Parameters: []apiParameter{{In: "path", Name: "id", Description: "The import's id."}},
+		Operations: []apiOperation{
+			{
+				Method:   "GET",
+				Summary:  "Get the progress of an import.",
+				Status:   http.StatusOK,
+				Response: apiImport{},
+				Auth:     true,
+				Errors:   []int{http.StatusNotFound},
+			},
+		},
+	},
+}
+
+// handleFuncer registers handlers, ex. http.ServeMux.
+type handleFuncer interface {
+	HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request))
+}
+
+func addAPIHandlers(state core.State, serveMux handleFuncer) {
+	serveMux.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIResponse(w, apiError(http.StatusNotFound, r.URL.Path))
+	})
+	serveMux.HandleFunc("/api/openapi.json", makeHandleOpenAPI())
+	for _, route := range apiRoutes {
+		serveMux.HandleFunc(route.Pattern, makeAPIHandler(state, route.Handle))
+	}
+}
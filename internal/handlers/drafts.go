@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"cookbook/internal/core"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/gorilla/csrf"
+)
+
+type bulkImportTemplateData struct {
+	stateData
+	response
+	CsrfField template.HTML
+	CancelUrl string
+	URLs      string
+	Sitemap   string
+	Pattern   string
+}
+
+func handleBulkImport(state core.State, r *http.Request) bulkImportTemplateData {
+	data := bulkImportTemplateData{stateData: makeStateData(state, r)}
+
+	if resp := data.require(core.PermissionImport); resp.Error != "" {
+		data.response = resp
+		return data
+	}
+
+	if !data.HasImport {
+		data.response = errorResponse(http.StatusForbidden, "import not configured")
+		return data
+	}
+
+	data.Title = "Bulk Import"
+	data.CsrfField = csrf.TemplateField(r)
+	data.CancelUrl = "/import"
+
+	switch r.Method {
+	case "GET":
+	case "POST":
+		if err := r.ParseForm(); err != nil {
+			slog.Error(err.Error())
+			data.response = errorResponse(http.StatusBadRequest, err.Error())
+			return data
+		}
+
+		data.URLs = r.FormValue("urls")
+		data.Sitemap = strings.TrimSpace(r.FormValue("sitemap"))
+		data.Pattern = strings.TrimSpace(r.FormValue("pattern"))
+
+		urls, err := core.ParseURLList(data.URLs)
+		if err != nil {
+			data.response = errorResponse(http.StatusBadRequest, err.Error())
+			return data
+		}
+
+		if data.Sitemap != "" {
+			var pattern *regexp.Regexp
+			if data.Pattern != "" {
+				if pattern, err = regexp.Compile(data.Pattern); err != nil {
+					data.response = errorResponse(http.StatusBadRequest, "invalid pattern: "+err.Error())
+					return data
+				}
+			}
+			sitemapURLs, err := core.SitemapURLs(r.Context(), state.Fetcher.Request, data.Sitemap, pattern)
+			if err != nil {
+				slog.Error(err.Error())
+				data.response = errorResponse(importErrorStatus(err), err.Error())
+				return data
+			}
+			urls = append(urls, sitemapURLs...)
+		}
+
+		if len(urls) == 0 {
+			data.response = errorResponse(http.StatusBadRequest, "no urls to import")
+			return data
+		}
+
+		llm, err := core.LLMModel(r.Context(), state.Config)
+		if err != nil {
+			slog.Error(err.Error())
+			data.response = errorResponse(http.StatusInternalServerError, err.Error())
+			return data
+		}
+
+		job := state.StartBulkImport(llm, state.Fetcher.Request, urls)
+		data.RedirectPath = "/import/bulk/" + job.ID
+	default:
+		data.response = errorResponse(http.StatusMethodNotAllowed, r.Method)
+	}
+
+	return data
+}
+
+func makeHandleBulkImport(state core.State) http.HandlerFunc {
+	bulkImportTemplate := template.Must(template.ParseFiles(
+		"templates/base.html",
+		"templates/bulkImport.html",
+	))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeResponse(w, r, bulkImportTemplate, handleBulkImport(state, r))
+	}
+}
+
+func makeHandleBulkImportStatus(state core.State) http.HandlerFunc {
+	statusTemplate := template.Must(template.ParseFiles(
+		"templates/base.html",
+		"templates/bulkImportStatus.html",
+	))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		sd := makeStateData(state, r)
+		if resp := sd.require(core.PermissionImport); resp.Error != "" {
+			http.Error(w, resp.Error, resp.StatusCode)
+			return
+		}
+
+		job := state.BulkImports.Get(r.PathValue("id"))
+		if job == nil {
+			http.Error(w, "import not found", http.StatusNotFound)
+			return
+		}
+
+		results, done := job.Status()
+		imported := 0
+		for _, result := range results {
+			if !result.Skipped && result.Err == nil {
+				imported++
+			}
+		}
+
+		data := struct {
+			stateData
+			Title    string
+			ID       string
+			Total    int
+			Imported int
+			Results  []core.BulkImportResult
+			Done     bool
+		}{
+			stateData: sd,
+			Title:     "Bulk Import",
+			ID:        job.ID,
+			Total:     job.Total,
+			Imported:  imported,
+			Results:   results,
+			Done:      done,
+		}
+
+		templateName := "base.html"
+		if isHtmx, htmxTarget := htmx(r); isHtmx && htmxTarget == "status" {
+			templateName = "status"
+		}
+
+		w.Header().Set("Vary", "HX-Request")
+
+		if err := statusTemplate.ExecuteTemplate(w, templateName, data); err != nil {
+			slog.Error(err.Error())
+		}
+	}
+}
+
+func makeHandleDrafts(state core.State) http.HandlerFunc {
+	draftsTemplate := template.Must(template.ParseFiles(
+		"templates/base.html",
+		"templates/drafts.html",
+	))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		sd := makeStateData(state, r)
+		if resp := sd.require(core.PermissionImport); resp.Error != "" {
+			http.Error(w, resp.Error, resp.StatusCode)
+			return
+		}
+
+		drafts, err := state.ListDrafts()
+		if err != nil {
+			slog.Error(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		data := struct {
+			stateData
+			Title  string
+			Drafts []core.Draft
+		}{
+			stateData: sd,
+			Title:     "Drafts",
+			Drafts:    drafts,
+		}
+
+		if err := draftsTemplate.Execute(w, data); err != nil {
+			slog.Error(err.Error())
+		}
+	}
+}
+
+func handleDraft(state core.State, r *http.Request) recipeTemplateData {
+	data := recipeTemplateData{stateData: makeStateData(state, r)}
+
+	if resp := data.require(core.PermissionImport); resp.Error != "" {
+		data.response = resp
+		return data
+	}
+
+	name := r.PathValue("name")
+	fp, err := state.DraftPath(name)
+	if err != nil {
+		data.response = errorResponse(http.StatusNotFound, name)
+		return data
+	}
+
+	switch r.Method {
+	case "GET":
+		md, err := os.ReadFile(fp)
+		if os.IsNotExist(err) {
+			data.response = errorResponse(http.StatusNotFound, name)
+			return data
+		}
+		if err != nil {
+			slog.Error(err.Error())
+			data.response = errorResponse(http.StatusInternalServerError, err.Error())
+			return data
+		}
+		data.recipeResponse = recipeResponse{Name: name, Body: string(md)}
+	case "POST":
+		if err := r.ParseForm(); err != nil {
+			slog.Error(err.Error())
+			data.response = errorResponse(http.StatusBadRequest, err.Error())
+			return data
+		}
+
+		if !r.Form.Has("delete") {
+			data.recipeResponse = handleRecipePost(state, r, "")
+			if data.Error != "" || data.Fragment != "" {
+				break
+			}
+		} else {
+			data.RedirectPath = "/drafts"
+		}
+
+		if err := os.Remove(fp); err != nil {
+			slog.Error(err.Error())
+			data.response = errorResponse(http.StatusInternalServerError, err.Error())
+		}
+	default:
+		data.response = errorResponse(http.StatusMethodNotAllowed, r.Method)
+		return data
+	}
+
+	data.Title = "Review " + name
+	data.CsrfField = csrf.TemplateField(r)
+	data.CancelUrl = "/drafts"
+	data.ShowDelete = true
+
+	return data
+}
+
+func makeHandleDraft(state core.State, recipeFormTemplate *template.Template) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeResponse(w, r, recipeFormTemplate, handleDraft(state, r))
+	}
+}
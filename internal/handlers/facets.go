@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"net/url"
+	"slices"
+	"strconv"
+
+	"cookbook/internal/search"
+)
+
+var facetTitles = map[string]string{
+	"tags":   "Tags",
+	"course": "Course",
+	"time":   "Time",
+}
+
+// facetParams maps facet fields to the url parameters filtering them.
+var facetParams = map[string]string{
+	"tags":   "tag",
+	"course": "course",
+	"time":   "time",
+}
+
+type facetLink struct {
+	Label string
+	Count int
+	URL   string
+}
+
+type facetView struct {
+	Title string
+	Links []facetLink
+}
+
+type filterParam struct {
+	Name  string
+	Value string
+	Label string
+	// URL removes the filter.
+	URL string
+}
+
+// indexParams are the url parameters of the index page.
+type indexParams struct {
+	Query   string
+	Filters search.Filters
+	Sort    search.Sort
+	Page    int
+}
+
+func indexParamsFromQuery(values url.Values) indexParams {
+	page, err := strconv.Atoi(values.Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	return indexParams{
+		Query: values.Get("q"),
+		Filters: search.Filters{
+			Tags:     values["tag"],
+			Course:   values.Get("course"),
+			Language: values.Get("language"),
+			Time:     values.Get("time"),
+		},
+		Sort: search.Sort(values.Get("sort")),
+		Page: page,
+	}
+}
+
+// values returns the parameters, except the page, to link to the first page
+// of a refined view.
+func (p indexParams) values() url.Values {
+	query, filters := p.Query, p.Filters
+	values := url.Values{}
+	if query != "" {
+		values.Set("q", query)
+	}
+	if p.Sort != search.SortRelevance {
+		values.Set("sort", string(p.Sort))
+	}
+	for _, tag := range filters.Tags {
+		values.Add("tag", tag)
+	}
+	if filters.Course != "" {
+		values.Set("course", filters.Course)
+	}
+	if filters.Language != "" {
+		values.Set("language", filters.Language)
+	}
+	if filters.Time != "" {
+		values.Set("time", filters.Time)
+	}
+	return values
+}
+
+func indexURL(values url.Values) string {
+	if len(values) == 0 {
+		return "/"
+	}
+	return "/?" + values.Encode()
+}
+
+func timeLabel(key string) string {
+	for _, r := range search.TimeRanges {
+		if r.Key == key {
+			return r.Label
+		}
+	}
+	return key
+}
+
+// nextURL links to the next page.
+func (p indexParams) nextURL() string {
+	values := p.values()
+	values.Set("page", strconv.Itoa(p.Page+1))
+	return indexURL(values)
+}
+
+// activeFilters lists the chosen filters, each with a link removing it.
+func activeFilters(p indexParams) []filterParam {
+	filters := p.Filters
+	params := []filterParam{}
+	for _, tag := range filters.Tags {
+		values := p.values()
+		values["tag"] = slices.DeleteFunc(slices.Clone(filters.Tags), func(t string) bool { return t == tag })
+		params = append(params, filterParam{Name: "tag", Value: tag, Label: tag, URL: indexURL(values)})
+	}
+	if filters.Course != "" {
+		values := p.values()
+		values.Del("course")
+		params = append(params, filterParam{Name: "course", Value: filters.Course, Label: filters.Course, URL: indexURL(values)})
+	}
+	if filters.Time != "" {
+		values := p.values()
+		values.Del("time")
+		params = append(params, filterParam{Name: "time", Value: filters.Time, Label: timeLabel(filters.Time), URL: indexURL(values)})
+	}
+	return params
+}
+
+// facetViews links each facet value not already chosen to the results
+// refined by it.
+func facetViews(p indexParams, facets []search.Facet) []facetView {
+	filters := p.Filters
+	views := []facetView{}
+	for _, facet := range facets {
+		param := facetParams[facet.Field]
+		view := facetView{Title: facetTitles[facet.Field]}
+		for _, value := range facet.Values {
+			values := p.values()
+			if param == "tag" {
+				if slices.Contains(filters.Tags, value.Value) {
+					continue
+				}
+				values.Add(param, value.Value)
+			} else {
+				if values.Get(param) == value.Value {
+					continue
+				}
+				values.Set(param, value.Value)
+			}
+			view.Links = append(view.Links, facetLink{Label: value.Label, Count: value.Count, URL: indexURL(values)})
+		}
+		if len(view.Links) > 0 {
+			views = append(views, view)
+		}
+	}
+	return views
+}
+
+type sortOption struct {
+	Value    search.Sort
+	Label    string
+	Selected bool
+}
+
+func sortOptions(selected search.Sort) []sortOption {
+	options := []sortOption{
+		{Value: search.SortRelevance, Label: "Relevance"},
+		{Value: search.SortName, Label: "Name"},
+		{Value: search.SortAdded, Label: "Recently added"},
+		{Value: search.SortModified, Label: "Recently modified"},
+		{Value: search.SortTime, Label: "Cook time"},
+	}
+	for i := range options {
+		options[i].Selected = options[i].Value == selected
+	}
+	return options
+}
+
+type languageOption struct {
+	Value    string
+	Label    string
+	Selected bool
+}
+
+// languageOptions lists the languages of the recipes to filter by, none when
+// they are all in one language.
+func languageOptions(languages []string, selected string) []languageOption {
+	if len(languages) < 2 {
+		return nil
+	}
+	options := []languageOption{{Value: "", Label: "All languages", Selected: selected == ""}}
+	for _, language := range languages {
+		options = append(options, languageOption{
+			Value:    language,
+			Label:    search.LanguageName(language),
+			Selected: language == selected,
+		})
+	}
+	return options
+}
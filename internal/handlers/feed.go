@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"cookbook/internal/core"
+	"cookbook/internal/search"
+)
+
+// feedSize is the number of recipes in a feed.
+var feedSize = 20
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Link       atomLink       `xml:"link"`
+	Published  string         `xml:"published,omitempty"`
+	Updated    string         `xml:"updated"`
+	Categories []atomCategory `xml:"category"`
+	Content    atomContent    `xml:"content"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	GUID        string   `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+	Categories  []string `xml:"category"`
+	Description string   `xml:"description"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+// baseURL is the Server.BaseURL setting, or else the url the request was
+// sent to, without a trailing slash.  The X-Forwarded-Proto and
+// X-Forwarded-Host headers are only used with Server.TrustForwardedHeaders,
+// when a proxy sets them.
+func baseURL(state core.State, r *http.Request) string {
+	if state.Config.Server.BaseURL != "" {
+		return strings.TrimSuffix(state.Config.Server.BaseURL, "/")
+	}
+	scheme, host := "http", r.Host
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if state.Config.Server.TrustForwardedHeaders {
+		if proto := r.Header.Get("X-Forwarded-Proto"); proto == "https" || proto == "http" {
+			scheme = proto
+		}
+		if forwarded := r.Header.Get("X-Forwarded-Host"); forwarded != "" {
+			host = forwarded
+		}
+	}
+	return scheme + "://" + host
+}
+
+// feed is the recipes of a feed, with its title and the path of its page.
+type feed struct {
+	Title   string
+	Path    string
+	Recipes []search.Recipe
+	Updated time.Time
+}
+
+// recentFeed returns the most recently modified recipes, with tag unless it
+// is "", and only the public ones when public is set.  The tag must be in use.
+func recentFeed(state core.State, tag string, public bool) (*feed, response) {
+	f := &feed{Title: "Cookbook", Path: "/"}
+	if tag != "" {
+		tags, err := search.ListTags(state.Index, public)
+		if err != nil {
+			slog.Error(err.Error())
+			return nil, errorResponse(http.StatusInternalServerError, err.Error())
+		}
+		if !slices.Contains(tags, tag) {
+			return nil, errorResponse(http.StatusNotFound, tag)
+		}
+		f.Title = "Cookbook: " + tag
+		f.Path = "/?" + url.Values{"tag": {tag}}.Encode()
+	}
+
+	recipes, err := search.RecentRecipes(state.Index, tag, feedSize, public)
+	if err != nil {
+		slog.Error(err.Error())
+		return nil, errorResponse(http.StatusInternalServerError, err.Error())
+	}
+	f.Recipes = recipes
+	for _, recipe := range recipes {
+		if recipe.Modified.After(f.Updated) {
+			f.Updated = recipe.Modified
+		}
+	}
+	return f, response{}
+}
+
+func (f *feed) atom(base, self string) atomFeed {
+	result := atomFeed{
+		Title:   f.Title,
+		ID:      base + f.Path,
+		Updated: f.Updated.UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: base + self, Rel: "self", Type: "application/atom+xml"},
+			{Href: base + f.Path, Rel: "alternate", Type: "text/html"},
+		},
+	}
+	for _, recipe := range f.Recipes {
+		link := base + "/recipe/" + url.PathEscape(recipe.Webpath)
+		entry := atomEntry{
+			Title:   recipe.Name,
+			ID:      link,
+			Link:    atomLink{Href: link, Rel: "alternate", Type: "text/html"},
+			Updated: recipe.Modified.UTC().Format(time.RFC3339),
+			Content: atomContent{Type: "html", Body: recipe.HTML},
+		}
+		if !recipe.Added.IsZero() {
+			entry.Published = recipe.Added.UTC().Format(time.RFC3339)
+		}
+		for _, tag := range recipe.Tags {
+			entry.Categories = append(entry.Categories, atomCategory{Term: tag})
+		}
+		result.Entries = append(result.Entries, entry)
+	}
+	return result
+}
+
+func (f *feed) rss(base string) rss {
+	result := rss{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:       f.Title,
+			Link:        base + f.Path,
+			Description: "New and updated recipes",
+		},
+	}
+	if !f.Updated.IsZero() {
+		result.Channel.LastBuildDate = f.Updated.UTC().Format(time.RFC1123Z)
+	}
+	for _, recipe := range f.Recipes {
+		link := base + "/recipe/" + url.PathEscape(recipe.Webpath)
+		result.Channel.Items = append(result.Channel.Items, rssItem{
+			Title:       recipe.Name,
+			Link:        link,
+			GUID:        link,
+			PubDate:     recipe.Modified.UTC().Format(time.RFC1123Z),
+			Categories:  recipe.Tags,
+			Description: recipe.HTML,
+		})
+	}
+	return result
+}
+
+// makeHandleFeed serves the recent recipes, of the tag in the path if there
+// is one, as an Atom feed, or RSS when rss is true.
+func makeHandleFeed(state core.State, rss bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		f, resp := recentFeed(state, r.PathValue("name"), makeStateData(state, r).public())
+		if resp.Error != "" {
+			http.Error(w, resp.Error, resp.StatusCode)
+			return
+		}
+
+		base := baseURL(state, r)
+		var doc any = f.atom(base, r.URL.EscapedPath())
+		contentType := "application/atom+xml; charset=utf-8"
+		if rss {
+			doc = f.rss(base)
+			contentType = "application/rss+xml; charset=utf-8"
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Write([]byte(xml.Header))
+		encoder := xml.NewEncoder(w)
+		encoder.Indent("", "  ")
+		if err := encoder.Encode(doc); err != nil {
+			slog.Error(err.Error())
+		}
+	}
+}
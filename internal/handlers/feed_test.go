@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"cookbook/internal/core"
+)
+
+func TestBaseURL(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		name     string
+		baseURL  string
+		trust    bool
+		expected string
+	}{
+		{name: "configured", baseURL: "https://cookbook.example.com/", expected: "https://cookbook.example.com"},
+		{name: "request host", expected: "http://cookbook.local"},
+		{name: "trusted proxy", trust: true, expected: "https://cookbook.example.com"},
+	} {
+		var state core.State
+		state.Config.Server.BaseURL = test.baseURL
+		state.Config.Server.TrustForwardedHeaders = test.trust
+
+		r := httptest.NewRequest("GET", "http://cookbook.local/feed.atom", nil)
+		r.Header.Set("X-Forwarded-Proto", "https")
+		r.Header.Set("X-Forwarded-Host", "cookbook.example.com")
+		if got := baseURL(state, r); got != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, got)
+		}
+	}
+}
@@ -9,8 +9,11 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 
 	"cookbook/internal/core"
+	"cookbook/internal/markdown"
 )
 
 func htmx(r *http.Request) (bool, string) {
@@ -36,12 +39,16 @@ type response struct {
 	Error        string
 	StatusCode   int
 	RedirectPath string
+	// Fragment is a template rendered in place of the page for htmx
+	// requests, swapped into the element with the same id.
+	Fragment string
 }
 
 type recipeResponse struct {
 	response
-	Name string
-	Body string
+	Name          string
+	Body          string
+	SuggestedTags []string
 }
 
 func errorResponse(statusCode int, msg string) response {
@@ -58,6 +65,15 @@ func errorResponse(statusCode int, msg string) response {
 	}
 }
 
+// importErrorStatus reports failures to fetch the recipe page as a bad gateway.
+func importErrorStatus(err error) int {
+	var fetchErr *core.FetchError
+	if errors.As(err, &fetchErr) {
+		return http.StatusBadGateway
+	}
+	return http.StatusInternalServerError
+}
+
 func handleRecipeGet(state core.State, r *http.Request) recipeResponse {
 	name := ""
 	body := ""
@@ -71,18 +87,36 @@ func handleRecipeGet(state core.State, r *http.Request) recipeResponse {
 				return recipeResponse{response: errorResponse(http.StatusInternalServerError, err.Error())}
 			}
 
-			recipe, err := core.Import(r.Context(), llm, core.HTTPRequest, importURL)
+			recipe, err := core.Import(r.Context(), llm, state.Fetcher.Request, importURL, state.ImportOptions())
 			if err != nil {
 				slog.Error(err.Error())
-				return recipeResponse{response: errorResponse(http.StatusInternalServerError, err.Error())}
+				return recipeResponse{response: errorResponse(importErrorStatus(err), err.Error())}
 			}
 			if recipe != nil {
 				name = recipe.Name
-				body = recipe.Body
+				body = recipe.Markdown()
 			}
 		}
 	}
-	return recipeResponse{Name: name, Body: body}
+	return recipeResponse{Name: name, Body: body, SuggestedTags: suggestTags(state, r, name, body)}
+}
+
+// suggestTags returns tag suggestions for a recipe without tags, when
+// Server.SuggestTags is on.  Failures are logged and give no suggestions.
+func suggestTags(state core.State, r *http.Request, name, body string) []string {
+	if !state.Config.Server.SuggestTags || state.Config.Server.LLM == nil || body == "" {
+		return nil
+	}
+	if _, tags, _, err := markdown.ConvertToHtml([]byte(body)); err != nil || !slices.Equal(tags, []string{core.OtherTag}) {
+		return nil
+	}
+
+	tags, err := state.SuggestRecipeTags(r.Context(), name, body)
+	if err != nil {
+		slog.Error(err.Error())
+		return nil
+	}
+	return tags
 }
 
 func handleRecipePost(s core.State, r *http.Request, prevFilename string) recipeResponse {
@@ -91,22 +125,64 @@ func handleRecipePost(s core.State, r *http.Request, prevFilename string) recipe
 		return recipeResponse{response: errorResponse(http.StatusBadRequest, err.Error())}
 	}
 
-	name := filepath.Base(r.FormValue("name"))
+	name := r.FormValue("name")
 	body := r.FormValue("body")
 	delete := r.Form.Has("delete")
 
-	prevFp := filepath.Join(s.Config.Server.RecipesPath, prevFilename)
-
 	if delete {
-		if err := os.Remove(prevFp); err != nil {
-			slog.Error(err.Error())
-			return recipeResponse{response: errorResponse(http.StatusInternalServerError, err.Error()), Name: name, Body: body}
+		if resp := makeStateData(s, r).require(core.PermissionDelete); resp.Error != "" {
+			return recipeResponse{response: resp, Name: name, Body: body}
+		}
+		if prevFilename == "" {
+			return recipeResponse{response: errorResponse(http.StatusBadRequest, "no recipe to delete"), Name: name, Body: body}
+		}
+		core.RecipeWrites.Lock()
+		defer core.RecipeWrites.Unlock()
+		if resp := deleteRecipe(s, prevFilename); resp.Error != "" {
+			return recipeResponse{response: resp, Name: name, Body: body}
 		}
 		return recipeResponse{response: response{RedirectPath: "/"}}
 	}
 
+	// Offer tag suggestions once before saving a recipe without tags.
+	if !r.Form.Has("tags_reviewed") && recipeName(name) != "" {
+		if tags := suggestTags(s, r, recipeName(name), body); len(tags) > 0 {
+			return recipeResponse{
+				response:      response{Fragment: "tagSuggestions"},
+				Name:          recipeName(name),
+				Body:          body,
+				SuggestedTags: tags,
+			}
+		}
+	}
+
+	core.RecipeWrites.Lock()
+	defer core.RecipeWrites.Unlock()
+	webpath, resp := saveRecipe(s, name, body, prevFilename)
+	if resp.Error != "" {
+		return recipeResponse{response: resp, Name: recipeName(name), Body: body}
+	}
+
+	return recipeResponse{response: response{RedirectPath: "/recipe/" + url.PathEscape(webpath)}}
+}
+
+// recipeName returns the name a recipe named name is saved under, "" when
+// it has none.
+func recipeName(name string) string {
+	name = filepath.Base(name)
 	if name == "." || name == string(filepath.Separator) {
-		return recipeResponse{response: errorResponse(http.StatusBadRequest, "name is required"), Body: body}
+		return ""
+	}
+	return name
+}
+
+// saveRecipe writes the recipe file of a recipe named name, replacing the
+// file prevFilename, "" for a new recipe.  It returns the recipe's webpath,
+// or the error in the response.
+func saveRecipe(s core.State, name, body, prevFilename string) (string, response) {
+	name = recipeName(name)
+	if name == "" {
+		return "", errorResponse(http.StatusBadRequest, "name is required")
 	}
 
 	filename := name + core.RecipeExt
@@ -115,39 +191,37 @@ func handleRecipePost(s core.State, r *http.Request, prevFilename string) recipe
 	writeFn := ExclusiveWriteFile
 	if filename == prevFilename {
 		writeFn = os.WriteFile
+	} else if prevFilename != "" {
+		s.Webhooks.Renaming(
+			core.NameToWebpath(strings.TrimSuffix(prevFilename, core.RecipeExt)),
+			core.NameToWebpath(name),
+		)
 	}
 
 	if err := writeFn(fp, []byte(body), 0644); err != nil {
 		if errors.Is(err, fs.ErrExist) {
-			return recipeResponse{
-				response: errorResponse(http.StatusConflict, "A recipe with the name already exists."),
-				Name:     name,
-				Body:     body,
-			}
-		} else {
-			slog.Error(err.Error())
-			return recipeResponse{
-				response: errorResponse(http.StatusInternalServerError, err.Error()),
-				Name:     name,
-				Body:     body,
-			}
+			return "", errorResponse(http.StatusConflict, "A recipe with the name already exists.")
 		}
+		slog.Error(err.Error())
+		return "", errorResponse(http.StatusInternalServerError, err.Error())
 	}
 
 	if prevFilename != "" && prevFilename != filename {
-		if err := os.Remove(prevFp); err != nil {
-			slog.Error(err.Error())
-			return recipeResponse{
-				response: errorResponse(http.StatusInternalServerError, err.Error()),
-				Name:     name,
-				Body:     body,
-			}
+		if resp := deleteRecipe(s, prevFilename); resp.Error != "" {
+			return "", resp
 		}
 	}
 
-	escapedPath := url.PathEscape(core.NameToWebpath(name))
+	return core.NameToWebpath(name), response{}
+}
 
-	return recipeResponse{response: response{RedirectPath: "/recipe/" + escapedPath}}
+// deleteRecipe removes the recipe file filename.
+func deleteRecipe(s core.State, filename string) response {
+	if err := os.Remove(filepath.Join(s.Config.Server.RecipesPath, filename)); err != nil {
+		slog.Error(err.Error())
+		return errorResponse(http.StatusInternalServerError, err.Error())
+	}
+	return response{}
 }
 
 type responser interface {
@@ -173,6 +247,21 @@ type importTemplateData struct {
 	CancelUrl string
 }
 
+type refreshTemplateData struct {
+	stateData
+	response
+	CsrfField template.HTML
+	CancelUrl string
+	Webpath   string
+	Name      string
+	Source    string
+	// Fetched is whether the recipe was imported again, after the form.
+	Fetched bool
+	Body    string
+	Diff    []core.DiffLine
+	Changed bool
+}
+
 type recipePathDeleteTemplateData struct {
 	stateData
 	response
@@ -194,18 +283,32 @@ func writeResponse(
 	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
 		http.Error(w, resp.Error, resp.StatusCode)
 
-	case isHtmx && resp.Error != "":
+	// htmx navigations (HX-Location) render the page with its error, which
+	// base.html's htmx-config swaps despite the status.
+	case isHtmx && resp.Error != "" && r.Method != "GET":
 		http.Error(w, resp.Error, resp.StatusCode)
 
 	case isHtmx && resp.RedirectPath != "":
 		w.Header().Set("HX-Location", resp.RedirectPath)
 		w.WriteHeader(http.StatusOK)
 
+	case isHtmx && resp.Fragment != "":
+		w.Header().Set("HX-Retarget", "#"+resp.Fragment)
+		w.Header().Set("HX-Reswap", "innerHTML")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := template.ExecuteTemplate(w, resp.Fragment, data); err != nil {
+			slog.Error(err.Error())
+		}
+
 	case !isHtmx && resp.RedirectPath != "":
 		w.Header().Set("Location", resp.RedirectPath)
 		w.WriteHeader(http.StatusSeeOther)
 
 	default:
+		if resp.Error != "" && resp.StatusCode != 0 {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.WriteHeader(resp.StatusCode)
+		}
 		if err := template.Execute(w, data); err != nil {
 			slog.Error(err.Error())
 		}
@@ -3,13 +3,18 @@ package handlers
 import (
 	"cookbook/internal/auth"
 	"cookbook/internal/core"
+	"cookbook/internal/markdown"
 	"cookbook/internal/search"
+	"errors"
 	"html/template"
 	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/gorilla/csrf"
 )
@@ -17,7 +22,9 @@ import (
 type stateData struct {
 	HasAuth         bool
 	HasImport       bool
+	HasSuggestTags  bool
 	IsAuthenticated bool
+	Role            core.Role
 	LoginUrl        string
 	LogoutUrl       string
 }
@@ -25,18 +32,48 @@ type stateData struct {
 func makeStateData(state core.State, r *http.Request) stateData {
 	hasAuth := state.Auth.LoginUrl != "" && state.Auth.LogoutUrl != ""
 	loginUrl := state.Auth.LoginUrl
+	var role core.Role
+	if hasAuth {
+		role = auth.RequestRole(state, r)
+	}
 	if hasAuth && r.URL.Path != "/" {
-		loginUrl = state.Auth.LoginUrl + "?return_to=" + url.QueryEscape(r.URL.Path)
+		loginUrl = state.Auth.LoginUrl + "?return_to=" + url.QueryEscape(r.URL.RequestURI())
 	}
 	return stateData{
 		HasAuth:         hasAuth,
 		HasImport:       hasAuth && state.Config.Server.LLM != nil,
-		IsAuthenticated: hasAuth && auth.IsAuthenticated(state.SessionStore, r),
+		HasSuggestTags:  hasAuth && state.Config.Server.LLM != nil && state.Config.Server.SuggestTags,
+		IsAuthenticated: role != "",
+		Role:            role,
 		LoginUrl:        loginUrl,
 		LogoutUrl:       state.Auth.LogoutUrl,
 	}
 }
 
+// Can reports whether the user has permission, ex. {{if .Can "edit"}} in
+// templates.
+func (d stateData) Can(permission core.Permission) bool {
+	return d.Role.Can(permission)
+}
+
+// public reports whether the user sees only public recipes in lists and
+// searches, when they are not signed in.
+func (d stateData) public() bool {
+	return !d.Can(core.PermissionView)
+}
+
+// require returns the error for users without permission, Unauthorized when
+// they are not signed in.
+func (d stateData) require(permission core.Permission) response {
+	switch {
+	case !d.IsAuthenticated:
+		return errorResponse(http.StatusUnauthorized, "")
+	case !d.Can(permission):
+		return errorResponse(http.StatusForbidden, "requires the "+string(permission)+" permission")
+	}
+	return response{}
+}
+
 func makeHandleIndex(state core.State) http.HandlerFunc {
 	indexTemplate := template.Must(template.ParseFiles(
 		"templates/base.html",
@@ -44,41 +81,92 @@ func makeHandleIndex(state core.State) http.HandlerFunc {
 	))
 
 	return func(w http.ResponseWriter, r *http.Request) {
-		query := r.URL.Query().Get("q")
+		params := indexParamsFromQuery(r.URL.Query())
+		query, filters := params.Query, params.Filters
 
-		if query == "" && r.URL.RawQuery != "" || r.URL.Query().Has("clear") {
+		if len(params.values()) == 0 && r.URL.RawQuery != "" && !r.URL.Query().Has("page") || r.URL.Query().Has("clear") {
 			http.Redirect(w, r, "/", http.StatusSeeOther)
 			return
 		}
 
+		sd := makeStateData(state, r)
+		filters.Public = sd.public()
+
 		data := struct {
 			stateData
-			Recipes []search.SearchResult
-			Tags    []search.RecipesGroupedByTag
-			Title   string
-			Query   string
+			Recipes   []search.SearchResult
+			Tags      []search.RecipesGroupedByTag
+			Title     string
+			Query     string
+			Searching bool
+			Total     uint64
+			Facets    []facetView
+			Filters   []filterParam
+			Sorts     []sortOption
+			Languages []languageOption
+			NextURL   string
+			// Fuzzy results match words similar to the query.
+			Fuzzy        bool
+			Corrected    string
+			CorrectedURL string
+			// QueryError explains a query with invalid syntax.
+			QueryError string
 		}{
-			stateData: makeStateData(state, r),
+			stateData: sd,
 			Title:     "Recipes",
 			Query:     query,
+			Searching: query != "" || !filters.IsEmpty(),
+			Sorts:     sortOptions(params.Sort),
 		}
 
-		if query != "" {
-			recipes, err := search.SearchRecipes(state.Index, query)
-			if err != nil {
+		languages, err := search.ListLanguages(state.Index)
+		if err != nil {
+			slog.Error(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data.Languages = languageOptions(languages, filters.Language)
+
+		more := false
+		if data.Searching {
+			results, err := state.SearchRecipes(r.Context(), query, search.Options{
+				Filters: filters,
+				Sort:    params.Sort,
+				Page:    params.Page,
+			})
+			var queryErr *search.QueryError
+			if errors.As(err, &queryErr) {
+				data.QueryError = queryErr.Error()
+				results = &search.SearchResults{}
+			} else if err != nil {
 				slog.Error(err.Error())
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
-			data.Recipes = recipes
+			data.Recipes = results.Hits
+			data.Total = results.Total
+			data.Facets = facetViews(params, results.Facets)
+			data.Filters = activeFilters(params)
+			data.Fuzzy = results.Fuzzy
+			if results.Corrected != "" {
+				corrected := params
+				corrected.Query = results.Corrected
+				data.Corrected = results.Corrected
+				data.CorrectedURL = indexURL(corrected.values())
+			}
+			more = results.More
 		} else {
-			tags, err := search.GetRecipesGroupedByTag(state.Index)
+			tags, hasMore, err := search.GetRecipesGroupedByTag(state.Index, params.Sort, params.Page, sd.public())
 			if err != nil {
 				slog.Error(err.Error())
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
 			data.Tags = tags
+			more = hasMore
+		}
+		if more {
+			data.NextURL = params.nextURL()
 		}
 
 		isHtmx, htmxTarget := htmx(r)
@@ -91,6 +179,10 @@ func makeHandleIndex(state core.State) http.HandlerFunc {
 			if htmxTarget == "body" {
 				templateName = "body"
 			}
+			// Infinite scroll appends the next page in place of the link.
+			if htmxTarget == "more" {
+				templateName = "page"
+			}
 		}
 
 		w.Header().Set("Vary", "HX-Request")
@@ -101,6 +193,30 @@ func makeHandleIndex(state core.State) http.HandlerFunc {
 	}
 }
 
+type recipePageData struct {
+	stateData
+	Title   string
+	Name    string
+	Webpath string
+	Body    template.HTML
+	Source  string
+	Details []string
+	Related []search.RelatedRecipe
+}
+
+func newRecipePageData(sd stateData, recipe *search.Recipe, related []search.RelatedRecipe) recipePageData {
+	return recipePageData{
+		stateData: sd,
+		Title:     recipe.Name,
+		Name:      recipe.Name,
+		Webpath:   recipe.Webpath,
+		Body:      template.HTML(recipe.HTML),
+		Source:    recipe.Source,
+		Details:   recipeDetails(recipe),
+		Related:   related,
+	}
+}
+
 func makeHandleRecipePath(state core.State) http.HandlerFunc {
 	recipeTemplate := template.Must(template.ParseFiles(
 		"templates/base.html",
@@ -110,26 +226,29 @@ func makeHandleRecipePath(state core.State) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		webpath := r.PathValue("path")
 
-		_, name, html, err := search.GetRecipe(state.Index, webpath)
+		sd := makeStateData(state, r)
+
+		recipe, err := search.GetRecipe(state.Index, webpath)
+		if err == nil && recipe.Private() && sd.public() {
+			// Private recipes are not found by users who cannot sign in.
+			if sd.HasAuth {
+				http.Redirect(w, r, sd.LoginUrl, http.StatusSeeOther)
+				return
+			}
+			err = search.ErrNotFound
+		}
 		switch err {
 		case search.ErrNotFound:
 			slog.Error(err.Error())
 			http.Error(w, err.Error(), http.StatusNotFound)
 		case nil:
-			data := struct {
-				stateData
-				Title   string
-				Name    string
-				Webpath string
-				Body    template.HTML
-			}{
-				stateData: makeStateData(state, r),
-				Title:     name,
-				Name:      name,
-				Webpath:   webpath,
-				Body:      template.HTML(html),
+			related := state.Related.Get(webpath)
+			if sd.public() {
+				related = slices.DeleteFunc(slices.Clone(related), func(r search.RelatedRecipe) bool {
+					return !r.Listed()
+				})
 			}
-			if err := recipeTemplate.Execute(w, data); err != nil {
+			if err := recipeTemplate.Execute(w, newRecipePageData(sd, recipe, related)); err != nil {
 				slog.Error(err.Error())
 			}
 		default:
@@ -138,11 +257,30 @@ func makeHandleRecipePath(state core.State) http.HandlerFunc {
 	}
 }
 
+// recipeDetails describes the time, course, servings and visibility metadata,
+// which the markdown renderer leaves out.
+func recipeDetails(recipe *search.Recipe) []string {
+	details := []string{}
+	if recipe.Time != nil {
+		details = append(details, "Time: "+markdown.FormatMinutes(*recipe.Time))
+	}
+	if recipe.Course != "" {
+		details = append(details, "Course: "+recipe.Course)
+	}
+	if recipe.Servings != nil {
+		details = append(details, "Servings: "+strconv.FormatFloat(*recipe.Servings, 'f', -1, 64))
+	}
+	if !recipe.Listed() {
+		details = append(details, "Visibility: "+recipe.Visibility)
+	}
+	return details
+}
+
 func handleRecipe(state core.State, r *http.Request) recipeTemplateData {
 	data := recipeTemplateData{stateData: makeStateData(state, r)}
 
-	if !data.IsAuthenticated {
-		data.response = errorResponse(http.StatusUnauthorized, "")
+	if resp := data.require(core.PermissionEdit); resp.Error != "" {
+		data.response = resp
 		return data
 	}
 
@@ -171,13 +309,13 @@ func makeHandleRecipe(state core.State, recipeFormTemplate *template.Template) h
 func handleRecipePathEdit(state core.State, r *http.Request) recipeTemplateData {
 	data := recipeTemplateData{stateData: makeStateData(state, r)}
 
-	if !data.IsAuthenticated {
-		data.response = errorResponse(http.StatusUnauthorized, "")
+	if resp := data.require(core.PermissionEdit); resp.Error != "" {
+		data.response = resp
 		return data
 	}
 
 	webpath := r.PathValue("path")
-	filename, name, _, err := search.GetRecipe(state.Index, webpath)
+	recipe, err := search.GetRecipe(state.Index, webpath)
 
 	if err == search.ErrNotFound {
 		data.response = errorResponse(http.StatusNotFound, webpath)
@@ -191,7 +329,7 @@ func handleRecipePathEdit(state core.State, r *http.Request) recipeTemplateData
 
 	switch r.Method {
 	case "GET":
-		fp := filepath.Join(state.Config.Server.RecipesPath, filename)
+		fp := filepath.Join(state.Config.Server.RecipesPath, recipe.Filename)
 		md, err := os.ReadFile(fp)
 		if err != nil {
 			slog.Error(err.Error())
@@ -199,21 +337,22 @@ func handleRecipePathEdit(state core.State, r *http.Request) recipeTemplateData
 			return data
 		} else {
 			data.recipeResponse = recipeResponse{
-				Name: name,
+				Name: recipe.Name,
 				Body: string(md),
 			}
 		}
-		data.Title = "Edit " + name
-		data.CsrfField = csrf.TemplateField(r)
-		data.CancelUrl = "/recipe/" + webpath
-		data.ShowDelete = true
 	case "POST":
-		data.recipeResponse = handleRecipePost(state, r, filename)
+		data.recipeResponse = handleRecipePost(state, r, recipe.Filename)
 	default:
 		data.response = errorResponse(http.StatusMethodNotAllowed, r.Method)
 		return data
 	}
 
+	data.Title = "Edit " + recipe.Name
+	data.CsrfField = csrf.TemplateField(r)
+	data.CancelUrl = "/recipe/" + webpath
+	data.ShowDelete = data.Can(core.PermissionDelete)
+
 	return data
 }
 
@@ -223,11 +362,121 @@ func makeHandleRecipePathEdit(state core.State, recipeFormTemplate *template.Tem
 	}
 }
 
+func handleRecipePathRefresh(state core.State, r *http.Request) refreshTemplateData {
+	data := refreshTemplateData{stateData: makeStateData(state, r)}
+
+	if resp := data.require(core.PermissionEdit); resp.Error != "" {
+		data.response = resp
+		return data
+	}
+
+	if !data.HasImport {
+		data.response = errorResponse(http.StatusForbidden, "import not configured")
+		return data
+	}
+
+	if r.Method != "GET" && r.Method != "POST" {
+		data.response = errorResponse(http.StatusMethodNotAllowed, r.Method)
+		return data
+	}
+
+	webpath := r.PathValue("path")
+	recipe, err := search.GetRecipe(state.Index, webpath)
+	if err == search.ErrNotFound {
+		data.response = errorResponse(http.StatusNotFound, webpath)
+		return data
+	}
+	if err != nil {
+		slog.Error(err.Error())
+		data.response = errorResponse(http.StatusInternalServerError, err.Error())
+		return data
+	}
+	if recipe.Source == "" {
+		data.response = errorResponse(http.StatusBadRequest, "recipe has no source")
+		return data
+	}
+
+	data.Title = "Refresh " + recipe.Name
+	data.CsrfField = csrf.TemplateField(r)
+	data.CancelUrl = "/recipe/" + webpath
+	data.Webpath = webpath
+	data.Name = recipe.Name
+	data.Source = recipe.Source
+
+	// Fetching calls the LLM and the source, only on the CSRF checked POST.
+	if r.Method == "GET" {
+		return data
+	}
+
+	md, err := os.ReadFile(filepath.Join(state.Config.Server.RecipesPath, recipe.Filename))
+	if err != nil {
+		slog.Error(err.Error())
+		data.response = errorResponse(http.StatusInternalServerError, err.Error())
+		return data
+	}
+
+	llm, err := core.LLMModel(r.Context(), state.Config)
+	if err != nil {
+		slog.Error(err.Error())
+		data.response = errorResponse(http.StatusInternalServerError, err.Error())
+		return data
+	}
+
+	imported, err := core.Import(r.Context(), llm, state.Fetcher.Request, recipe.Source, state.ImportOptions())
+	if err != nil {
+		slog.Error(err.Error())
+		data.response = errorResponse(importErrorStatus(err), err.Error())
+		return data
+	}
+	if imported == nil {
+		data.response = errorResponse(http.StatusNotFound, "no recipe found at "+recipe.Source)
+		return data
+	}
+
+	body := imported.Markdown()
+	// Imported recipes are untagged, keep the tags of the current version.
+	if tags := tagsLine(string(md)); tags != "" && tagsLine(body) == "" {
+		body = tags + "\n\n" + body
+	}
+
+	data.Fetched = true
+	data.Body = body
+	data.Diff = core.DiffLines(string(md), body)
+	for _, line := range data.Diff {
+		if line.Op != core.DiffEqual {
+			data.Changed = true
+			break
+		}
+	}
+
+	return data
+}
+
+func tagsLine(md string) string {
+	for _, line := range strings.Split(md, "\n") {
+		if strings.HasPrefix(line, "tags:") {
+			return line
+		}
+	}
+	return ""
+}
+
+func makeHandleRecipePathRefresh(state core.State) http.HandlerFunc {
+	refreshTemplate := template.Must(template.ParseFiles(
+		"templates/base.html",
+		"templates/refresh.html",
+	))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeResponse(w, r, refreshTemplate, handleRecipePathRefresh(state, r))
+	}
+}
+
 func handleImport(state core.State, r *http.Request) importTemplateData {
 	data := importTemplateData{stateData: makeStateData(state, r)}
 
-	if !data.IsAuthenticated {
-		data.response = errorResponse(http.StatusUnauthorized, "")
+	if resp := data.require(core.PermissionImport); resp.Error != "" {
+		data.response = resp
 		return data
 	}
 
@@ -282,5 +531,25 @@ func AddHandlers(state core.State, serveMux *http.ServeMux) {
 	))
 	serveMux.HandleFunc("/recipe", makeHandleRecipe(state, recipeFormTemplate))
 	serveMux.HandleFunc("/recipe/{path}/edit", makeHandleRecipePathEdit(state, recipeFormTemplate))
+	serveMux.HandleFunc("/recipe/{path}/refresh", makeHandleRecipePathRefresh(state))
+	serveMux.HandleFunc("/recipe/{path}/share", makeHandleRecipePathShare(state))
+	serveMux.HandleFunc("/share/{path}", makeHandleShare(state))
 	serveMux.HandleFunc("/import", makeHandleImport(state))
+	serveMux.HandleFunc("/import/bulk", makeHandleBulkImport(state))
+	serveMux.HandleFunc("/import/bulk/{id}", makeHandleBulkImportStatus(state))
+	serveMux.HandleFunc("/drafts", makeHandleDrafts(state))
+	serveMux.HandleFunc("/drafts/{name}", makeHandleDraft(state, recipeFormTemplate))
+	serveMux.HandleFunc("/tags/suggest", makeHandleTagSuggestions(state, recipeFormTemplate))
+	serveMux.HandleFunc("/pantry", makeHandlePantry(state))
+	serveMux.HandleFunc("/pantry.json", makeHandlePantryJSON(state))
+	serveMux.HandleFunc("/suggest", makeHandleSuggest(state))
+	serveMux.HandleFunc("/suggest.json", makeHandleSuggestJSON(state))
+	serveMux.HandleFunc("/settings", makeHandleSettings(state))
+	serveMux.HandleFunc("/feed.atom", makeHandleFeed(state, false))
+	serveMux.HandleFunc("/feed.rss", makeHandleFeed(state, true))
+	serveMux.HandleFunc("/tag/{name}/feed.atom", makeHandleFeed(state, false))
+	serveMux.HandleFunc("/tag/{name}/feed.rss", makeHandleFeed(state, true))
+	serveMux.HandleFunc("/dav/", makeHandleDAV(state))
+
+	addAPIHandlers(state, serveMux)
 }
@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"context"
+	"html/template"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cookbook/internal/auth"
+	"cookbook/internal/core"
+	"cookbook/internal/search"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/fake"
+)
+
+func TestMain(m *testing.M) {
+	// The handlers parse the templates relative to the repository.
+	if err := os.Chdir("../.."); err != nil {
+		log.Fatal(err)
+	}
+
+	core.RegisterLLMProvider("TestTags", func(context.Context, core.LLMProviderConfig) (llms.Model, error) {
+		return fake.NewFakeLLM([]string{`{"tags": ["Soup"]}`}), nil
+	})
+
+	os.Exit(m.Run())
+}
+
+// newTestState returns the state of a cookbook of the recipe files, by name,
+// with the form based users alice, an admin, and bob, a viewer.
+func newTestState(t *testing.T, recipes map[string]string) core.State {
+	t.Helper()
+
+	state := core.State{Index: search.NewIndex([]string{"en"}, nil)}
+	t.Cleanup(func() { state.Index.Close() })
+	state.Config.Server.RecipesPath = t.TempDir()
+	state.Config.Server.Language = "en"
+	state.Config.Server.Languages = []string{"en"}
+	state.Config.FormBasedAuthUsers = &map[string]core.FormUser{
+		"alice": {Role: core.RoleAdmin},
+		"bob":   {Role: core.RoleViewer},
+	}
+	state.Auth = core.Auth{AuthInfo: core.NewAuthInfo("/auth")}
+	state.SessionStore = auth.NewSessionStore([]string{"0123456789abcdef0123456789abcdef"}, false)
+
+	for name, md := range recipes {
+		if err := os.WriteFile(filepath.Join(state.Config.Server.RecipesPath, name+core.RecipeExt), []byte(md), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	state.LoadRecipes()
+	return state
+}
+
+// signIn adds the session cookie of user to r.
+func signIn(t *testing.T, state core.State, r *http.Request, user string) {
+	t.Helper()
+
+	session, err := auth.GetSession(state.SessionStore, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.Values["sub"] = user
+	rec := httptest.NewRecorder()
+	if err := session.Save(r, rec); err != nil {
+		t.Fatal(err)
+	}
+	for _, cookie := range rec.Result().Cookies() {
+		r.AddCookie(cookie)
+	}
+}
+
+func TestRefreshReplacesUntaggedRecipe(t *testing.T) {
+	t.Parallel()
+
+	state := newTestState(t, map[string]string{"Squash Soup": "## Ingredients\n\n- squash\n"})
+	state.Config.Server.SuggestTags = true
+	llm := "TestTags"
+	state.Config.Server.LLM = &llm
+	mux := http.NewServeMux()
+	AddHandlers(state, mux)
+
+	// The form of the refresh page, after importing a changed version.
+	body := "## Ingredients\n\n- squash\n- cream\n"
+	refreshTemplate := template.Must(template.ParseFiles(
+		"templates/base.html",
+		"templates/refresh.html",
+	))
+	rec := httptest.NewRecorder()
+	err := refreshTemplate.Execute(rec, refreshTemplateData{
+		Webpath: "SquashSoup",
+		Name:    "Squash Soup",
+		Source:  "https://example.com/soup",
+		Fetched: true,
+		Body:    body,
+		Changed: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := goquery.NewDocumentFromReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	form := doc.Find(`form[action="/recipe/SquashSoup/edit"]`)
+	if form.Length() != 1 {
+		t.Fatal("expected the form replacing the recipe")
+	}
+	values := url.Values{}
+	form.Find("input").Each(func(_ int, input *goquery.Selection) {
+		name, _ := input.Attr("name")
+		value, _ := input.Attr("value")
+		values.Add(name, value)
+	})
+
+	r := httptest.NewRequest("POST", "/recipe/SquashSoup/edit", strings.NewReader(values.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("HX-Request", "true")
+	signIn(t, state, r, "alice")
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, r)
+
+	if location := rec.Header().Get("HX-Location"); location != "/recipe/SquashSoup" {
+		t.Fatalf("expected the recipe to be saved, got %d %v %s", rec.Code, rec.Header(), rec.Body)
+	}
+	md, err := os.ReadFile(filepath.Join(state.Config.Server.RecipesPath, "Squash Soup"+core.RecipeExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(md) != body {
+		t.Errorf("expected the imported version, got %q", md)
+	}
+}
+
+func TestShareLinkFollowsOwnerRole(t *testing.T) {
+	t.Parallel()
+
+	state := newTestState(t, map[string]string{"Squash Soup": "## Ingredients\n\n- squash\n"})
+	state.Config.Server.SharesPath = filepath.Join(t.TempDir(), "shares.json")
+	state.Config.Server.SessionSecrets = []string{"0123456789abcdef0123456789abcdef"}
+	shares, err := core.NewShares(state.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.Shares = shares
+	mux := http.NewServeMux()
+	AddHandlers(state, mux)
+
+	link, err := shares.Create("alice", "SquashSoup", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users := *state.Config.FormBasedAuthUsers
+	for _, test := range []struct {
+		name     string
+		role     core.Role
+		removed  bool
+		expected int
+	}{
+		{name: "admin", role: core.RoleAdmin, expected: http.StatusOK},
+		{name: "demoted to viewer", role: core.RoleViewer, expected: http.StatusNotFound},
+		{name: "removed", removed: true, expected: http.StatusNotFound},
+	} {
+		if test.removed {
+			delete(users, "alice")
+		} else {
+			users["alice"] = core.FormUser{Role: test.role}
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", shares.URL(link), nil))
+		if rec.Code != test.expected {
+			t.Errorf("%s: expected %d, got %d", test.name, test.expected, rec.Code)
+		}
+	}
+}
+
+func TestPrivateRecipes(t *testing.T) {
+	t.Parallel()
+
+	recipes := map[string]string{
+		"Squash Soup":   "tags: Soup\n\n## Ingredients\n\n- squash\n",
+		"Secret Soup":   "tags: Soup, Secret\nvisibility: private\n\n## Ingredients\n\n- squash\n",
+		"Hidden Squash": "tags: Soup, Hidden\nvisibility: unlisted\n\n## Ingredients\n\n- squash\n",
+	}
+	state := newTestState(t, recipes)
+	mux := http.NewServeMux()
+	AddHandlers(state, mux)
+
+	// Without authentication there is no one to show private recipes to.
+	noAuth := newTestState(t, recipes)
+	noAuth.Auth = core.Auth{}
+	noAuthMux := http.NewServeMux()
+	AddHandlers(noAuth, noAuthMux)
+
+	for _, test := range []struct {
+		name     string
+		mux      *http.ServeMux
+		path     string
+		user     string
+		expected int
+		location string
+	}{
+		{name: "private recipe", mux: mux, path: "/recipe/SecretSoup", expected: http.StatusSeeOther, location: "/auth/login?return_to=%2Frecipe%2FSecretSoup"},
+		{name: "private recipe signed in", mux: mux, path: "/recipe/SecretSoup", user: "bob", expected: http.StatusOK},
+		{name: "private recipe without authentication", mux: noAuthMux, path: "/recipe/SecretSoup", expected: http.StatusNotFound},
+		{name: "private recipe from the API", mux: mux, path: "/api/v1/recipes/SecretSoup", expected: http.StatusNotFound},
+		{name: "private recipe from the API signed in", mux: mux, path: "/api/v1/recipes/SecretSoup", user: "bob", expected: http.StatusOK},
+		{name: "unlisted recipe", mux: mux, path: "/recipe/HiddenSquash", expected: http.StatusOK},
+		{name: "unlisted recipe from the API", mux: mux, path: "/api/v1/recipes/HiddenSquash", expected: http.StatusOK},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", test.path, nil)
+			if test.user != "" {
+				signIn(t, state, r, test.user)
+			}
+			rec := httptest.NewRecorder()
+			test.mux.ServeHTTP(rec, r)
+			if rec.Code != test.expected {
+				t.Fatalf("expected %d, got %d", test.expected, rec.Code)
+			}
+			if location := rec.Header().Get("Location"); location != test.location {
+				t.Errorf("expected to be sent to %q, got %q", test.location, location)
+			}
+		})
+	}
+
+	// Lists show the private and unlisted recipes only to users signed in.
+	for _, path := range []string{
+		"/",
+		"/?q=squash",
+		"/feed.atom",
+		"/feed.rss",
+		"/tag/Soup/feed.atom",
+		"/api/v1/recipes",
+		"/api/v1/search?q=squash",
+		"/api/v1/tags",
+		"/suggest?q=s",
+		"/suggest.json?q=s",
+		"/pantry?have=squash",
+		"/pantry.json?have=squash",
+	} {
+		t.Run(path, func(t *testing.T) {
+			for _, user := range []string{"", "bob"} {
+				r := httptest.NewRequest("GET", path, nil)
+				if user != "" {
+					signIn(t, state, r, user)
+				}
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, r)
+				if rec.Code != http.StatusOK {
+					t.Fatalf("%q: expected 200, got %d", user, rec.Code)
+				}
+				body := rec.Body.String()
+				for _, hidden := range []string{"Secret", "Hidden"} {
+					if shown := strings.Contains(body, hidden); shown != (user != "") {
+						t.Errorf("%q: expected %s shown %v, got %v", user, hidden, user != "", shown)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestShareLinksDisabled(t *testing.T) {
+	t.Parallel()
+
+	state := newTestState(t, map[string]string{"Squash Soup": "## Ingredients\n\n- squash\n"})
+	mux := http.NewServeMux()
+	AddHandlers(state, mux)
+
+	for _, path := range []string{"/recipe/SquashSoup/share", "/share/SquashSoup?id=0123&expires=4102444800&sig=abc"} {
+		r := httptest.NewRequest("GET", path, nil)
+		signIn(t, state, r, "alice")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, r)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", path, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"cookbook/internal/core"
+)
+
+// schemaName names the schema of an API type, ex. apiRecipe is Recipe.
+func schemaName(t reflect.Type) string {
+	return strings.TrimPrefix(t.Name(), "api")
+}
+
+func schemaRef(name string) map[string]any {
+	return map[string]any{"$ref": "#/components/schemas/" + name}
+}
+
+// openAPISchema returns the schema of JSON values encoded from type t.  The
+// schemas of structs are added to schemas and referred to.  Fields are
+// required unless they are omitempty.
+func openAPISchema(t reflect.Type, schemas map[string]any) map[string]any {
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema := openAPISchema(t.Elem(), schemas)
+		if _, ok := schema["$ref"]; !ok {
+			schema["nullable"] = true
+		}
+		return schema
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": openAPISchema(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": openAPISchema(t.Elem(), schemas)}
+	case reflect.Struct:
+		name := schemaName(t)
+		if _, ok := schemas[name]; ok {
+			return schemaRef(name)
+		}
+		// Claim the name first, for types referring to themselves.
+		schemas[name] = nil
+
+		properties := map[string]any{}
+		required := []string{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := field.Tag.Get("json")
+			if !field.IsExported() || tag == "-" {
+				continue
+			}
+			fieldName, options, _ := strings.Cut(tag, ",")
+			if fieldName == "" {
+				fieldName = field.Name
+			}
+			properties[fieldName] = openAPISchema(field.Type, schemas)
+			if !slices.Contains(strings.Split(options, ","), "omitempty") {
+				required = append(required, fieldName)
+			}
+		}
+
+		schema := map[string]any{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		schemas[name] = schema
+		return schemaRef(name)
+	default:
+		return map[string]any{}
+	}
+}
+
+func openAPIParameter(p apiParameter) map[string]any {
+	schema := map[string]any{"type": "string"}
+	if p.Array {
+		schema = map[string]any{"type": "array", "items": schema}
+	}
+	return map[string]any{
+		"in":          p.In,
+		"name":        p.Name,
+		"description": p.Description,
+		"required":    p.In == "path",
+		"schema":      schema,
+	}
+}
+
+// operationID names an operation by its method and path, ex. putRecipesPath.
+func operationID(method, pattern string) string {
+	id := strings.ToLower(method)
+	for _, part := range strings.Split(strings.TrimPrefix(pattern, "/api/v1/"), "/") {
+		part = strings.Trim(part, "{}")
+		id += strings.ToUpper(part[:1]) + part[1:]
+	}
+	return id
+}
+
+func openAPIJSON(schema map[string]any) map[string]any {
+	return map[string]any{"application/json": map[string]any{"schema": schema}}
+}
+
+// openAPIOperation describes an operation with its success and error
+// responses.
+func openAPIOperation(route apiRoute, op apiOperation, schemas map[string]any) map[string]any {
+	parameters := []any{}
+	for _, p := range append(slices.Clone(route.Parameters), op.Parameters...) {
+		parameters = append(parameters, openAPIParameter(p))
+	}
+
+	headers := map[string]any{}
+	if op.ETag {
+		headers["ETag"] = map[string]any{
+			"description": "The version of the recipe, send it in If-Match to change the recipe.",
+			"schema":      map[string]any{"type": "string"},
+		}
+	}
+	if op.Location {
+		headers["Location"] = map[string]any{
+			"description": "The url of the resource.",
+			"schema":      map[string]any{"type": "string"},
+		}
+	}
+	success := map[string]any{
+		"description": http.StatusText(op.Status),
+		"content":     openAPIJSON(openAPISchema(reflect.TypeOf(op.Response), schemas)),
+	}
+	if len(headers) > 0 {
+		success["headers"] = headers
+	}
+	responses := map[string]any{strconv.Itoa(op.Status): success}
+
+	errors := slices.Clone(op.Errors)
+	if op.Request != nil {
+		errors = append(errors, http.StatusBadRequest)
+	}
+	if op.Auth {
+		errors = append(errors, http.StatusUnauthorized, http.StatusForbidden)
+	}
+	errors = append(errors, http.StatusInternalServerError)
+	for _, status := range errors {
+		responses[strconv.Itoa(status)] = map[string]any{
+			"description": http.StatusText(status),
+			"content":     openAPIJSON(openAPISchema(reflect.TypeOf(apiErrorBody{}), schemas)),
+		}
+	}
+
+	operation := map[string]any{
+		"summary":     op.Summary,
+		"operationId": operationID(op.Method, route.Pattern),
+		"parameters":  parameters,
+		"responses":   responses,
+	}
+	if op.Request != nil {
+		operation["requestBody"] = map[string]any{
+			"required": true,
+			"content":  openAPIJSON(openAPISchema(reflect.TypeOf(op.Request), schemas)),
+		}
+	}
+	if op.Auth {
+		operation["security"] = []any{
+			map[string]any{"bearerAuth": []string{}},
+			map[string]any{"sessionAuth": []string{}},
+		}
+	}
+	return operation
+}
+
+// openAPISpec is the OpenAPI 3 description of apiRoutes.
+func openAPISpec() map[string]any {
+	schemas := map[string]any{}
+	paths := map[string]any{}
+	for _, route := range apiRoutes {
+		operations := map[string]any{}
+		for _, op := range route.Operations {
+			operations[strings.ToLower(op.Method)] = openAPIOperation(route, op, schemas)
+		}
+		paths[route.Pattern] = operations
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "Cookbook API",
+			"version":     core.Version,
+			"description": "Errors are {\"error\": \"...\"}.  Writes need a write scoped token or a session with a CSRF token, of a user whose role allows them.",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": schemas,
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "A personal access token from the Settings page.",
+				},
+				"sessionAuth": map[string]any{
+					"type": "apiKey",
+					"in":   "cookie",
+					"name": "session",
+				},
+			},
+		},
+	}
+}
+
+func makeHandleOpenAPI() http.HandlerFunc {
+	spec, err := json.MarshalIndent(openAPISpec(), "", "  ")
+	if err != nil {
+		panic(err)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			writeAPIResponse(w, apiError(http.StatusMethodNotAllowed, r.Method))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write(spec); err != nil {
+			slog.Error(err.Error())
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"cookbook/internal/core"
+	"cookbook/internal/search"
+)
+
+// routeRecorder records the patterns registered on a ServeMux.
+type routeRecorder struct {
+	*http.ServeMux
+	patterns []string
+}
+
+func (r *routeRecorder) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	r.patterns = append(r.patterns, pattern)
+	r.ServeMux.HandleFunc(pattern, handler)
+}
+
+var pathParameterPattern = regexp.MustCompile(`\{\w+\}`)
+
+// refs returns the $ref values in a decoded JSON document.
+func refs(v any) []string {
+	result := []string{}
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if ref, ok := value.(string); ok && key == "$ref" {
+				result = append(result, ref)
+			}
+			result = append(result, refs(value)...)
+		}
+	case []any:
+		for _, value := range v {
+			result = append(result, refs(value)...)
+		}
+	}
+	return result
+}
+
+func TestOpenAPICoversRoutes(t *testing.T) {
+	t.Parallel()
+
+	state := core.State{Index: search.NewIndex([]string{"en"}, nil)}
+	state.Config.Server.RecipesPath = t.TempDir()
+	defer state.Index.Close()
+
+	mux := &routeRecorder{ServeMux: http.NewServeMux()}
+	addAPIHandlers(state, mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/api/openapi.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected the spec, got %d %s", rec.Code, rec.Body)
+	}
+	var spec struct {
+		OpenAPI    string                               `json:"openapi"`
+		Paths      map[string]map[string]map[string]any `json:"paths"`
+		Components struct {
+			Schemas map[string]any `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &spec); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(spec.OpenAPI, "3.") {
+		t.Errorf("expected OpenAPI 3, got %q", spec.OpenAPI)
+	}
+
+	// Every method a route accepts is described, and only those.
+	routes := 0
+	for _, pattern := range mux.patterns {
+		if !strings.HasPrefix(pattern, "/api/v1/") {
+			continue
+		}
+		routes++
+		operations, ok := spec.Paths[pattern]
+		if !ok {
+			t.Errorf("route %s is missing from the spec", pattern)
+			continue
+		}
+
+		url := pathParameterPattern.ReplaceAllString(pattern, "test")
+		for _, method := range []string{"GET", "POST", "PUT", "PATCH", "DELETE"} {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(method, url, strings.NewReader("{}")))
+
+			var body map[string]any
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Errorf("%s %s: expected a JSON response, got %s", method, url, rec.Body)
+			}
+			if rec.Code >= 400 && body["error"] == nil {
+				t.Errorf("%s %s: expected an error, got %s", method, url, rec.Body)
+			}
+
+			_, described := operations[strings.ToLower(method)]
+			accepted := rec.Code != http.StatusMethodNotAllowed
+			if accepted && !described {
+				t.Errorf("%s %s is missing from the spec", method, pattern)
+			}
+			if described && !accepted {
+				t.Errorf("%s %s is in the spec but not allowed", method, pattern)
+			}
+			if described {
+				if responses, _ := operations[strings.ToLower(method)]["responses"].(map[string]any); responses["500"] == nil {
+					t.Errorf("%s %s has no error responses in the spec", method, pattern)
+				}
+			}
+		}
+	}
+	if routes != len(spec.Paths) {
+		t.Errorf("expected a path in the spec for each of %d routes, got %d", routes, len(spec.Paths))
+	}
+
+	var document any
+	if err := json.Unmarshal(rec.Body.Bytes(), &document); err != nil {
+		t.Fatal(err)
+	}
+	for _, ref := range refs(document) {
+		name := strings.TrimPrefix(ref, "#/components/schemas/")
+		if _, ok := spec.Components.Schemas[name]; !ok {
+			t.Errorf("%s does not refer to a schema", ref)
+		}
+	}
+	for _, name := range []string{"Recipe", "RecipeMetadata", "RecipeInput", "SearchResults", "ErrorBody"} {
+		if _, ok := spec.Components.Schemas[name]; !ok {
+			t.Errorf("expected the %s schema", name)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"cookbook/internal/core"
+	"cookbook/internal/search"
+)
+
+type pantryData struct {
+	stateData
+	Title          string
+	Have           string
+	IncludeStaples bool
+	Staples        []string
+	Results        []search.PantryResult
+	Searched       bool
+}
+
+// pantryItems reads the ingredients on hand from the have parameters, which
+// may be comma or line separated.
+func pantryItems(r *http.Request) []string {
+	items := []string{}
+	for _, have := range r.URL.Query()["have"] {
+		for _, item := range strings.FieldsFunc(have, func(r rune) bool { return r == ',' || r == '\n' }) {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+func pantry(state core.State, r *http.Request) ([]search.PantryResult, error) {
+	staples := state.Config.Pantry.Staples
+	if r.URL.Query().Get("staples") == "include" {
+		staples = nil
+	}
+	return search.Pantry(state.Index, pantryItems(r), staples, makeStateData(state, r).public())
+}
+
+func makeHandlePantry(state core.State) http.HandlerFunc {
+	pantryTemplate := template.Must(template.ParseFiles(
+		"templates/base.html",
+		"templates/pantry.html",
+	))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := pantryData{
+			stateData:      makeStateData(state, r),
+			Title:          "What can I cook?",
+			Have:           strings.Join(pantryItems(r), ", "),
+			IncludeStaples: r.URL.Query().Get("staples") == "include",
+			Staples:        state.Config.Pantry.Staples,
+			Searched:       r.URL.Query().Has("have"),
+		}
+
+		results, err := pantry(state, r)
+		if err != nil {
+			slog.Error(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data.Results = results
+
+		isHtmx, htmxTarget := htmx(r)
+
+		templateName := "base.html"
+		if isHtmx && htmxTarget == "pantry-results" {
+			templateName = "pantryResults"
+		}
+
+		w.Header().Set("Vary", "HX-Request")
+
+		if err := pantryTemplate.ExecuteTemplate(w, templateName, data); err != nil {
+			slog.Error(err.Error())
+		}
+	}
+}
+
+func makeHandlePantryJSON(state core.State) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		results, err := pantry(state, r)
+		if err != nil {
+			slog.Error(err.Error())
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(map[string]any{"results": results}); err != nil {
+			slog.Error(err.Error())
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"errors"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cookbook/internal/auth"
+	"cookbook/internal/core"
+
+	"github.com/gorilla/csrf"
+)
+
+type tokenExpiry struct {
+	Value string
+	Label string
+	// Days is 0 for tokens that do not expire.
+	Days int
+}
+
+// tokenExpiries are the choices of how long a new token lasts, the first is
+// the default.
+var tokenExpiries = []tokenExpiry{
+	{Value: "30", Label: "30 days", Days: 30},
+	{Value: "90", Label: "90 days", Days: 90},
+	{Value: "365", Label: "1 year", Days: 365},
+	{Value: "never", Label: "Never"},
+}
+
+type settingsTemplateData struct {
+	stateData
+	response
+	CsrfField template.HTML
+	Tokens    []core.Token
+	Expiries  []tokenExpiry
+	Now       time.Time
+	// NewToken is shown once, after it is created.
+	NewToken string
+	Name     string
+	// Webhooks is whether webhooks are configured, with their recent
+	// deliveries, for admins.
+	Webhooks   bool
+	Deliveries []core.WebhookDelivery
+}
+
+func handleSettings(state core.State, r *http.Request) settingsTemplateData {
+	data := settingsTemplateData{stateData: makeStateData(state, r)}
+
+	// Tokens are managed from a signed in browser, not with another token.
+	owner := auth.Subject(state.SessionStore, r)
+	if !data.IsAuthenticated || owner == "" || auth.BearerToken(r) != "" {
+		data.response = errorResponse(http.StatusUnauthorized, "")
+		return data
+	}
+
+	switch r.Method {
+	case "GET":
+	case "POST":
+		if err := r.ParseForm(); err != nil {
+			slog.Error(err.Error())
+			data.response = errorResponse(http.StatusBadRequest, err.Error())
+			return data
+		}
+
+		if id := r.FormValue("revoke"); id != "" {
+			err := state.Tokens.Revoke(owner, id)
+			if errors.Is(err, core.ErrTokenNotFound) {
+				data.response = errorResponse(http.StatusNotFound, err.Error())
+				return data
+			}
+			if err != nil {
+				slog.Error(err.Error())
+				data.response = errorResponse(http.StatusInternalServerError, err.Error())
+				return data
+			}
+			data.RedirectPath = "/settings"
+			return data
+		}
+
+		data.NewToken, data.response = createToken(state, r, owner, data.Role)
+		if data.Error != "" {
+			data.Name = r.FormValue("name")
+		}
+	default:
+		data.response = errorResponse(http.StatusMethodNotAllowed, r.Method)
+		return data
+	}
+
+	data.Title = "Settings"
+	data.CsrfField = csrf.TemplateField(r)
+	data.Expiries = tokenExpiries
+	data.Tokens = state.Tokens.List(owner)
+	data.Now = time.Now()
+	if data.Can(core.PermissionAdmin) {
+		data.Webhooks = state.Webhooks != nil
+		data.Deliveries = state.Webhooks.Deliveries()
+	}
+	return data
+}
+
+// createToken creates the token described by the form for owner, who has
+// role, returning it or the error in the response.
+func createToken(state core.State, r *http.Request, owner string, role core.Role) (string, response) {
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" {
+		return "", errorResponse(http.StatusBadRequest, "name is required")
+	}
+
+	scope := core.TokenScope(r.FormValue("scope"))
+	if scope != core.ScopeRead && scope != core.ScopeWrite {
+		return "", errorResponse(http.StatusBadRequest, "scope must be read or write")
+	}
+	if scope == core.ScopeWrite && !role.Can(core.PermissionEdit) {
+		return "", errorResponse(http.StatusForbidden, "viewers can only create read tokens")
+	}
+
+	var expires time.Time
+	found := false
+	for _, expiry := range tokenExpiries {
+		if expiry.Value == r.FormValue("expires") {
+			if expiry.Days > 0 {
+				expires = time.Now().UTC().AddDate(0, 0, expiry.Days)
+			}
+			found = true
+		}
+	}
+	if !found {
+		return "", errorResponse(http.StatusBadRequest, "unknown expiry "+strconv.Quote(r.FormValue("expires")))
+	}
+
+	secret, _, err := state.Tokens.Create(owner, role, name, scope, expires)
+	if err != nil {
+		slog.Error(err.Error())
+		return "", errorResponse(http.StatusInternalServerError, err.Error())
+	}
+	return secret, response{}
+}
+
+func makeHandleSettings(state core.State) http.HandlerFunc {
+	settingsTemplate := template.Must(template.ParseFiles(
+		"templates/base.html",
+		"templates/settings.html",
+	))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeResponse(w, r, settingsTemplate, handleSettings(state, r))
+	}
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"errors"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cookbook/internal/auth"
+	"cookbook/internal/core"
+	"cookbook/internal/search"
+
+	"github.com/gorilla/csrf"
+)
+
+type shareExpiry struct {
+	Value string
+	Label string
+	Days  int
+}
+
+// shareExpiries are the choices of how long a new share link lasts, the first
+// is the default.  Share links always expire.
+var shareExpiries = []shareExpiry{
+	{Value: "7", Label: "7 days", Days: 7},
+	{Value: "1", Label: "1 day", Days: 1},
+	{Value: "30", Label: "30 days", Days: 30},
+}
+
+type shareLinkView struct {
+	core.ShareLink
+	URL string
+}
+
+type shareTemplateData struct {
+	stateData
+	response
+	CsrfField template.HTML
+	Name      string
+	Webpath   string
+	Expiries  []shareExpiry
+	Links     []shareLinkView
+	// NewLink is the URL of the link just created.
+	NewLink string
+}
+
+func handleRecipePathShare(state core.State, r *http.Request) shareTemplateData {
+	data := shareTemplateData{stateData: makeStateData(state, r)}
+
+	if resp := data.require(core.PermissionShare); resp.Error != "" {
+		data.response = resp
+		return data
+	}
+	if state.Shares == nil {
+		data.response = errorResponse(http.StatusNotFound, "share links are disabled")
+		return data
+	}
+
+	// Links are shared from a signed in browser, not with a token.
+	owner := auth.Subject(state.SessionStore, r)
+	if owner == "" || auth.BearerToken(r) != "" {
+		data.response = errorResponse(http.StatusUnauthorized, "")
+		return data
+	}
+
+	webpath := r.PathValue("path")
+	recipe, err := search.GetRecipe(state.Index, webpath)
+	if err == search.ErrNotFound {
+		data.response = errorResponse(http.StatusNotFound, webpath)
+		return data
+	}
+	if err != nil {
+		slog.Error(err.Error())
+		data.response = errorResponse(http.StatusInternalServerError, err.Error())
+		return data
+	}
+
+	switch r.Method {
+	case "GET":
+	case "POST":
+		if err := r.ParseForm(); err != nil {
+			slog.Error(err.Error())
+			data.response = errorResponse(http.StatusBadRequest, err.Error())
+			return data
+		}
+
+		if id := r.FormValue("revoke"); id != "" {
+			err := state.Shares.Revoke(webpath, id)
+			if errors.Is(err, core.ErrShareNotFound) {
+				data.response = errorResponse(http.StatusNotFound, err.Error())
+				return data
+			}
+			if err != nil {
+				slog.Error(err.Error())
+				data.response = errorResponse(http.StatusInternalServerError, err.Error())
+				return data
+			}
+			data.RedirectPath = "/recipe/" + webpath + "/share"
+			return data
+		}
+
+		days := 0
+		for _, expiry := range shareExpiries {
+			if expiry.Value == r.FormValue("expires") {
+				days = expiry.Days
+			}
+		}
+		if days == 0 {
+			data.response = errorResponse(http.StatusBadRequest, "unknown expiry "+strconv.Quote(r.FormValue("expires")))
+			break
+		}
+
+		link, err := state.Shares.Create(owner, webpath, time.Now().AddDate(0, 0, days))
+		if err != nil {
+			slog.Error(err.Error())
+			data.response = errorResponse(http.StatusInternalServerError, err.Error())
+			return data
+		}
+		data.NewLink = baseURL(state, r) + state.Shares.URL(link)
+	default:
+		data.response = errorResponse(http.StatusMethodNotAllowed, r.Method)
+		return data
+	}
+
+	data.Title = "Share " + recipe.Name
+	data.CsrfField = csrf.TemplateField(r)
+	data.Name = recipe.Name
+	data.Webpath = webpath
+	data.Expiries = shareExpiries
+	for _, link := range state.Shares.List(webpath) {
+		data.Links = append(data.Links, shareLinkView{ShareLink: link, URL: baseURL(state, r) + state.Shares.URL(link)})
+	}
+	return data
+}
+
+func makeHandleRecipePathShare(state core.State) http.HandlerFunc {
+	shareTemplate := template.Must(template.ParseFiles(
+		"templates/base.html",
+		"templates/share.html",
+	))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeResponse(w, r, shareTemplate, handleRecipePathShare(state, r))
+	}
+}
+
+// makeHandleShare shows the recipe of a share link to anyone with the link,
+// without a session and read only.
+func makeHandleShare(state core.State) http.HandlerFunc {
+	recipeTemplate := template.Must(template.ParseFiles(
+		"templates/base.html",
+		"templates/recipe.html",
+	))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "HEAD" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		webpath := r.PathValue("path")
+		// Links stop working when their owner can no longer share.
+		link, ok := state.Shares.Verify(webpath, r.URL.Query())
+		if !ok || !auth.UserRole(state, link.Owner).Can(core.PermissionShare) {
+			http.Error(w, http.StatusText(http.StatusNotFound)+": the share link is invalid, expired or revoked", http.StatusNotFound)
+			return
+		}
+
+		recipe, err := search.GetRecipe(state.Index, webpath)
+		if err == search.ErrNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			slog.Error(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Keep the link out of caches, search engines and the Referer header
+		// of the recipe's links.
+		w.Header().Set("Cache-Control", "private, no-store")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		w.Header().Set("X-Robots-Tag", "noindex")
+
+		if err := recipeTemplate.Execute(w, newRecipePageData(stateData{}, recipe, nil)); err != nil {
+			slog.Error(err.Error())
+		}
+	}
+}
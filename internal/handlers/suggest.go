@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"encoding/json"
+	"html/template"
+	"log/slog"
+	"net/http"
+
+	"cookbook/internal/core"
+	"cookbook/internal/search"
+)
+
+// suggestionsLimit is the number of names, tags and ingredients suggested.
+var suggestionsLimit = 5
+
+// makeHandleSuggest returns the suggestions for the q parameter as the
+// options of the search box's datalist.
+func makeHandleSuggest(state core.State) http.HandlerFunc {
+	indexTemplate := template.Must(template.ParseFiles(
+		"templates/base.html",
+		"templates/index.html",
+	))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		suggestions, err := search.Suggest(state.Index, r.URL.Query().Get("q"), suggestionsLimit, makeStateData(state, r).public())
+		if err != nil {
+			slog.Error(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := indexTemplate.ExecuteTemplate(w, "suggestions", suggestions); err != nil {
+			slog.Error(err.Error())
+		}
+	}
+}
+
+func makeHandleSuggestJSON(state core.State) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		suggestions, err := search.Suggest(state.Index, r.URL.Query().Get("q"), suggestionsLimit, makeStateData(state, r).public())
+		if err != nil {
+			slog.Error(err.Error())
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(suggestions); err != nil {
+			slog.Error(err.Error())
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"html/template"
+	"log/slog"
+	"net/http"
+
+	"cookbook/internal/core"
+
+	"github.com/gorilla/csrf"
+)
+
+func handleTagSuggestions(state core.State, r *http.Request) recipeTemplateData {
+	data := recipeTemplateData{stateData: makeStateData(state, r)}
+
+	if resp := data.require(core.PermissionEdit); resp.Error != "" {
+		data.response = resp
+		return data
+	}
+
+	if !data.HasSuggestTags {
+		data.response = errorResponse(http.StatusForbidden, "tag suggestions not configured")
+		return data
+	}
+
+	if r.Method != "POST" {
+		data.response = errorResponse(http.StatusMethodNotAllowed, r.Method)
+		return data
+	}
+
+	if err := r.ParseForm(); err != nil {
+		slog.Error(err.Error())
+		data.response = errorResponse(http.StatusBadRequest, err.Error())
+		return data
+	}
+
+	name := r.FormValue("name")
+	body := r.FormValue("body")
+
+	tags, err := state.SuggestRecipeTags(r.Context(), name, body)
+	if err != nil {
+		slog.Error(err.Error())
+		data.response = errorResponse(http.StatusInternalServerError, err.Error())
+		return data
+	}
+
+	data.recipeResponse = recipeResponse{
+		response:      response{Title: "Suggest Tags", Fragment: "tagSuggestions"},
+		Name:          name,
+		Body:          body,
+		SuggestedTags: tags,
+	}
+	data.CsrfField = csrf.TemplateField(r)
+	return data
+}
+
+func makeHandleTagSuggestions(state core.State, recipeFormTemplate *template.Template) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeResponse(w, r, recipeFormTemplate, handleTagSuggestions(state, r))
+	}
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"cmp"
+	"log/slog"
+	"net/http"
+
+	"cookbook/internal/auth"
+	"cookbook/internal/core"
+
+	"golang.org/x/net/webdav"
+)
+
+// davPermissions are the permissions WebDAV methods need, edit when they are
+// not listed.
+var davPermissions = map[string]core.Permission{
+	"GET":      core.PermissionView,
+	"HEAD":     core.PermissionView,
+	"OPTIONS":  core.PermissionView,
+	"PROPFIND": core.PermissionView,
+	"DELETE":   core.PermissionDelete,
+}
+
+// makeHandleDAV serves RecipesPath over WebDAV to clients with Basic
+// credentials or a token.  It is not served without authentication.
+func makeHandleDAV(state core.State) http.HandlerFunc {
+	basic := auth.NewBasic(state)
+	dav := &webdav.Handler{
+		Prefix:     "/dav",
+		FileSystem: state.RecipesFileSystem(),
+		LockSystem: webdav.NewMemLS(),
+		Logger: func(r *http.Request, err error) {
+			if err != nil {
+				slog.Error("webdav", "method", r.Method, "path", r.URL.Path, "error", err)
+			}
+		},
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if state.Auth.LoginUrl == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		role := basic.Role(r)
+		if role == "" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="Cookbook", charset="UTF-8"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		permission := cmp.Or(davPermissions[r.Method], core.PermissionEdit)
+		if !role.Can(permission) {
+			http.Error(w, http.StatusText(http.StatusForbidden)+": requires the "+string(permission)+" permission", http.StatusForbidden)
+			return
+		}
+		dav.ServeHTTP(w, r)
+	}
+}
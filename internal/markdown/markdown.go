@@ -11,16 +11,16 @@ import (
 
 func New() goldmark.Markdown {
 	return goldmark.New(
-		goldmark.WithExtensions(extension.GFM, Tags),
+		goldmark.WithExtensions(extension.GFM, Tags, MetadataExtension),
 		goldmark.WithRendererOptions(html.WithHardWraps()),
 	)
 }
 
-func ConvertToHtml(md []byte) (string, []string, error) {
+func ConvertToHtml(md []byte) (string, []string, Metadata, error) {
 	var html bytes.Buffer
 	pc := parser.NewContext()
 	if err := New().Convert(md, &html, parser.WithContext(pc)); err != nil {
-		return "", nil, err
+		return "", nil, nil, err
 	}
 
 	tags := []string{}
@@ -32,5 +32,10 @@ func ConvertToHtml(md []byte) (string, []string, error) {
 		tags = []string{"Other"}
 	}
 
-	return html.String(), tags, nil
+	metadata := Metadata{}
+	if m := pc.Get(MetadataContextKey); m != nil {
+		metadata = m.(Metadata)
+	}
+
+	return html.String(), tags, metadata, nil
 }
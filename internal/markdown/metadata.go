@@ -0,0 +1,271 @@
+package markdown
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Metadata holds the values of lines starting with one of MetadataKeys
+// followed by a colon, ex. `source: https://example.com/recipe`.  Metadata
+// lines are only recognized in a paragraph of their own, so that a line of
+// the directions starting with "time:" is not taken for one.
+type Metadata map[string]string
+
+// MetadataKeys are the keys recognized at the start of a line.  Tags are
+// parsed separately, see TagsNode.
+var MetadataKeys = []string{"source", "imported", "method", "time", "course", "servings", "language", "visibility"}
+
+type MetadataNode struct {
+	ast.BaseInline
+	Key   string
+	Value string
+}
+
+var KindMetadataNode = ast.NewNodeKind("MetadataNode")
+
+func (n *MetadataNode) Kind() ast.NodeKind {
+	return KindMetadataNode
+}
+
+func (n *MetadataNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Key": n.Key, "Value": n.Value}, nil)
+}
+
+type metadataParser struct{}
+
+func NewMetadataParser() parser.InlineParser {
+	return &metadataParser{}
+}
+
+func (m *metadataParser) Trigger() []byte {
+	return []byte{' '}
+}
+
+var MetadataContextKey = parser.NewContextKey()
+
+func metadataKey(line []byte) string {
+	for _, key := range MetadataKeys {
+		if bytes.HasPrefix(line, []byte(key+":")) {
+			return key
+		}
+	}
+	return ""
+}
+
+// isMetadataLine reports whether line is a metadata or tags line.
+func isMetadataLine(line []byte) bool {
+	return metadataKey(line) != "" || bytes.HasPrefix(line, []byte("tags:"))
+}
+
+// isMetadataBlock reports whether the lines of a paragraph are all metadata
+// and tags lines.
+func isMetadataBlock(lines []string) bool {
+	for _, line := range lines {
+		if !isMetadataLine([]byte(line)) {
+			return false
+		}
+	}
+	return true
+}
+
+// inMetadataBlock reports whether parent is a top level paragraph of only
+// metadata and tags lines.
+func inMetadataBlock(parent ast.Node, source []byte) bool {
+	if _, ok := parent.(*ast.Paragraph); !ok || parent.Parent() == nil || parent.Parent().Kind() != ast.KindDocument {
+		return false
+	}
+	lines := parent.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		segment := lines.At(i)
+		if !isMetadataLine(segment.Value(source)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *metadataParser) Parse(parent ast.Node, reader text.Reader, pc parser.Context) ast.Node {
+	line, _ := reader.PeekLine()
+
+	key := metadataKey(line)
+	if parent == nil || key == "" || !inMetadataBlock(parent, reader.Source()) {
+		return nil
+	}
+
+	reader.AdvanceLine()
+
+	value := strings.TrimSpace(string(line[len(key)+1:]))
+
+	metadata, _ := pc.Get(MetadataContextKey).(Metadata)
+	if metadata == nil {
+		metadata = Metadata{}
+		pc.Set(MetadataContextKey, metadata)
+	}
+	metadata[key] = value
+
+	return &MetadataNode{
+		BaseInline: ast.BaseInline{},
+		Key:        key,
+		Value:      value,
+	}
+}
+
+// MetadataRenderer renders nothing, metadata is shown by the recipe page.
+type MetadataRenderer struct{}
+
+func NewMetadataRenderer() renderer.NodeRenderer {
+	return &MetadataRenderer{}
+}
+
+func (r *MetadataRenderer) renderMetadata(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	return ast.WalkSkipChildren, nil
+}
+
+func (r *MetadataRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindMetadataNode, r.renderMetadata)
+}
+
+type metadata struct{}
+
+var MetadataExtension = &metadata{}
+
+func (e *metadata) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithInlineParsers(util.Prioritized(NewMetadataParser(), 100)),
+	)
+	m.Renderer().AddOptions(
+		renderer.WithNodeRenderers(util.Prioritized(NewMetadataRenderer(), 100)),
+	)
+}
+
+// FormatMetadata returns metadata lines for the given keys and values, in the
+// order of MetadataKeys, skipping empty values.
+func FormatMetadata(metadata Metadata) string {
+	var b strings.Builder
+	for _, key := range MetadataKeys {
+		if value := strings.TrimSpace(metadata[key]); value != "" {
+			b.WriteString(key + ": " + value + "\n")
+		}
+	}
+	return b.String()
+}
+
+// SetMetadata returns md with the metadata lines for the given keys replaced,
+// lines for keys not already present are appended in their own paragraph.
+func SetMetadata(md string, metadata Metadata) string {
+	lines := strings.Split(md, "\n")
+	set := map[string]bool{}
+	// Only paragraphs of metadata lines, as in inMetadataBlock.
+	trailing := false
+	for start := 0; start < len(lines); {
+		end := start
+		for end < len(lines) && strings.TrimSpace(lines[end]) != "" {
+			end++
+		}
+		if end > start {
+			trailing = isMetadataBlock(lines[start:end])
+		}
+		for i := start; i < end && trailing; i++ {
+			key := metadataKey([]byte(lines[i]))
+			if _, ok := metadata[key]; key == "" || !ok {
+				continue
+			}
+			set[key] = true
+			lines[i] = key + ": " + metadata[key]
+		}
+		start = end + 1
+	}
+
+	remaining := Metadata{}
+	for key, value := range metadata {
+		if !set[key] {
+			remaining[key] = value
+		}
+	}
+
+	md = strings.TrimRight(strings.Join(lines, "\n"), "\n")
+	extra := FormatMetadata(remaining)
+	if extra == "" {
+		return md + "\n"
+	}
+
+	// Continue a trailing block of metadata lines rather than starting another.
+	separator := "\n\n"
+	if trailing {
+		separator = "\n"
+	}
+	return md + separator + extra
+}
+
+var (
+	// Only hours need telling apart, numbers without a unit are minutes.
+	durationPart = regexp.MustCompile(`(\d+(?:\.\d+)?)\s*(h)?`)
+	// Ranges of numbers, ex. "30-40" or "1 to 2".
+	numberRange    = regexp.MustCompile(`\d+(?:\.\d+)?\s*(?:-|–|—|to)\s*(\d+(?:\.\d+)?)`)
+	rangeSeparator = regexp.MustCompile(`\s*(?:-|–|—|\bto\b)\s*`)
+	clockTime      = regexp.MustCompile(`^(\d+):(\d{2})$`)
+	number         = regexp.MustCompile(`\d+(?:\.\d+)?`)
+)
+
+// ParseMinutes reads a time metadata value in minutes, ex. "45", "30 min",
+// "1 hour 15 minutes", "1h30m", "1:30" or "PT1H30M".  Ranges, ex. "30-40 min"
+// or "45 min to 1 hour", are read as their upper bound.
+func ParseMinutes(value string) (float64, bool) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	value = numberRange.ReplaceAllString(value, "$1")
+	if parts := rangeSeparator.Split(value, -1); len(parts) > 1 {
+		value = parts[len(parts)-1]
+	}
+	if m := clockTime.FindStringSubmatch(value); m != nil {
+		hours, _ := strconv.ParseFloat(m[1], 64)
+		minutes, _ := strconv.ParseFloat(m[2], 64)
+		return hours*60 + minutes, true
+	}
+
+	// ISO 8601 durations as found in recipe schema markup.
+	value = strings.TrimPrefix(value, "pt")
+
+	parts := durationPart.FindAllStringSubmatch(value, -1)
+	if parts == nil {
+		return 0, false
+	}
+	total := 0.0
+	for _, part := range parts {
+		n, _ := strconv.ParseFloat(part[1], 64)
+		if part[2] == "h" {
+			n *= 60
+		}
+		total += n
+	}
+	return total, true
+}
+
+// FormatMinutes formats minutes for display, ex. "1 hr 15 min".
+func FormatMinutes(minutes float64) string {
+	hours, rest := int(minutes)/60, int(minutes)%60
+	switch {
+	case hours == 0:
+		return fmt.Sprintf("%d min", rest)
+	case rest == 0:
+		return fmt.Sprintf("%d hr", hours)
+	default:
+		return fmt.Sprintf("%d hr %d min", hours, rest)
+	}
+}
+
+// ParseServings reads the first number of a servings metadata value, ex. "4"
+// or "Serves 4-6".
+func ParseServings(value string) (float64, bool) {
+	n, err := strconv.ParseFloat(number.FindString(value), 64)
+	return n, err == nil
+}
@@ -0,0 +1,51 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseMinutes(t *testing.T) {
+	t.Parallel()
+
+	for value, expected := range map[string]float64{
+		"45":                45,
+		"30 min":            30,
+		"1 hour 15 minutes": 75,
+		"1h30m":             90,
+		"1:30":              90,
+		"PT1H30M":           90,
+		"2 hrs":             120,
+		"30-40 min":         40,
+		"1 to 2 hours":      120,
+		"45 min - 1 hour":   60,
+		"1 hr 15–20 min":    80,
+	} {
+		if minutes, ok := ParseMinutes(value); !ok || minutes != expected {
+			t.Errorf("%q: expected %v, got %v", value, expected, minutes)
+		}
+	}
+
+	if _, ok := ParseMinutes("overnight"); ok {
+		t.Error("expected no minutes without a number")
+	}
+}
+
+func TestMetadataBlock(t *testing.T) {
+	t.Parallel()
+
+	md := "tags: Soup\n\n## Directions\n\n1. Simmer.\ntime: until soft\n\nservings: see below\nfor four\n\nsource: https://example.com\ntime: 30 min\n"
+	_, _, metadata, err := ConvertToHtml([]byte(md))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Metadata{"source": "https://example.com", "time": "30 min"}
+	if len(metadata) != len(expected) || metadata["source"] != expected["source"] || metadata["time"] != expected["time"] {
+		t.Errorf("expected %v, got %v", expected, metadata)
+	}
+
+	set := SetMetadata(md, Metadata{"time": "45 min", "servings": "4"})
+	if !strings.Contains(set, "time: until soft") || !strings.Contains(set, "time: 45 min") || !strings.HasSuffix(set, "time: 45 min\nservings: 4\n") {
+		t.Errorf("expected only the metadata block changed, got %q", set)
+	}
+}
@@ -0,0 +1,98 @@
+package markdown
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+var (
+	ingredientsHeading = regexp.MustCompile(`(?i)ingredient`)
+	stepsHeading       = regexp.MustCompile(`(?i)direction|instruction|step|method|preparation|procedure`)
+)
+
+// Sections holds the list items found in a recipe's ingredient and step lists.
+type Sections struct {
+	Ingredients []string
+	Steps       []string
+}
+
+func nodeText(n ast.Node, source []byte) string {
+	var b bytes.Buffer
+	_ = ast.Walk(n, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.Text:
+			b.Write(n.Segment.Value(source))
+			if n.SoftLineBreak() || n.HardLineBreak() {
+				b.WriteByte(' ')
+			}
+		case *ast.String:
+			b.Write(n.Value)
+		case *TagsNode, *MetadataNode:
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+func listItems(list *ast.List, source []byte) []string {
+	items := []string{}
+	for item := list.FirstChild(); item != nil; item = item.NextSibling() {
+		if t := nodeText(item, source); t != "" {
+			items = append(items, t)
+		}
+	}
+	return items
+}
+
+// ParseSections finds the ingredient and step lists of a recipe.  Lists are
+// assigned by the heading above them, ex. "Ingredients" or "Directions".  When
+// there are no such headings the first unordered list is taken as the
+// ingredients and the first ordered list as the steps.  Paragraphs under a
+// steps heading are steps too.
+func ParseSections(md []byte) Sections {
+	doc := New().Parser().Parse(text.NewReader(md))
+
+	var sections Sections
+	var firstUnordered, firstOrdered []string
+	heading := ""
+
+	for n := doc.FirstChild(); n != nil; n = n.NextSibling() {
+		switch n := n.(type) {
+		case *ast.Heading:
+			heading = nodeText(n, md)
+		case *ast.List:
+			items := listItems(n, md)
+			switch {
+			case ingredientsHeading.MatchString(heading):
+				sections.Ingredients = append(sections.Ingredients, items...)
+			case stepsHeading.MatchString(heading):
+				sections.Steps = append(sections.Steps, items...)
+			case n.IsOrdered() && firstOrdered == nil:
+				firstOrdered = items
+			case !n.IsOrdered() && firstUnordered == nil:
+				firstUnordered = items
+			}
+		case *ast.Paragraph:
+			// Steps are often written as paragraphs rather than a list.
+			if t := nodeText(n, md); t != "" && stepsHeading.MatchString(heading) {
+				sections.Steps = append(sections.Steps, t)
+			}
+		}
+	}
+
+	if sections.Ingredients == nil {
+		sections.Ingredients = firstUnordered
+	}
+	if sections.Steps == nil {
+		sections.Steps = firstOrdered
+	}
+	return sections
+}
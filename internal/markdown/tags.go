@@ -100,3 +100,16 @@ func (e *tags) Extend(m goldmark.Markdown) {
 		renderer.WithNodeRenderers(util.Prioritized(NewTagRenderer(), 100)),
 	)
 }
+
+// SetTags replaces the tags line of a recipe, or adds one at the top.
+func SetTags(md string, tags []string) string {
+	line := "tags: " + strings.Join(tags, ", ")
+	lines := strings.Split(md, "\n")
+	for i := range lines {
+		if strings.HasPrefix(lines[i], "tags:") {
+			lines[i] = line
+			return strings.Join(lines, "\n")
+		}
+	}
+	return line + "\n\n" + md
+}
@@ -0,0 +1,141 @@
+package search
+
+import (
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+func minutes(n float64) *float64 {
+	return &n
+}
+
+type TimeRange struct {
+	Key      string
+	Label    string
+	Min, Max *float64
+}
+
+// TimeRanges group cook times for the time facet and filter.
+var TimeRanges = []TimeRange{
+	{Key: "15", Label: "Under 15 min", Max: minutes(15)},
+	{Key: "30", Label: "15 to 30 min", Min: minutes(15), Max: minutes(30)},
+	{Key: "60", Label: "30 min to 1 hour", Min: minutes(30), Max: minutes(60)},
+	{Key: "60+", Label: "Over 1 hour", Min: minutes(60)},
+}
+
+var tagsFacetSize = 20
+
+// Filters narrow a search to recipes with all of Tags, the Course, the
+// Language, and a cook time in the TimeRanges entry with the Time key.
+// Public narrows it to the public recipes, for users who are not signed in.
+type Filters struct {
+	Tags     []string
+	Course   string
+	Language string
+	Time     string
+	Public   bool
+}
+
+// IsEmpty reports whether the filters chosen by the user are empty, Public is
+// not one of them.
+func (f Filters) IsEmpty() bool {
+	return len(f.Tags) == 0 && f.Course == "" && f.Language == "" && f.Time == ""
+}
+
+func (f Filters) queries() []query.Query {
+	queries := []query.Query{}
+	for _, tag := range f.Tags {
+		q := bleve.NewTermQuery(tag)
+		q.SetField("tags")
+		queries = append(queries, q)
+	}
+	if f.Course != "" {
+		q := bleve.NewTermQuery(f.Course)
+		q.SetField("course")
+		queries = append(queries, q)
+	}
+	if f.Language != "" {
+		q := bleve.NewTermQuery(f.Language)
+		q.SetField("language")
+		queries = append(queries, q)
+	}
+	for _, r := range TimeRanges {
+		if r.Key == f.Time {
+			q := bleve.NewNumericRangeQuery(r.Min, r.Max)
+			q.SetField("time")
+			queries = append(queries, q)
+		}
+	}
+	if f.Public {
+		q := bleve.NewTermQuery(VisibilityPublic)
+		q.SetField("visibility")
+		queries = append(queries, q)
+	}
+	return queries
+}
+
+// apply narrows q to the recipes passing the filters.
+func (f Filters) apply(q query.Query) query.Query {
+	if f.IsEmpty() && !f.Public {
+		return q
+	}
+	return bleve.NewConjunctionQuery(append([]query.Query{q}, f.queries()...)...)
+}
+
+type FacetValue struct {
+	Value string
+	Label string
+	Count int
+}
+
+// Facet counts the search results by the values of a field.
+type Facet struct {
+	Field  string
+	Values []FacetValue
+}
+
+func addFacets(searchRequest *bleve.SearchRequest) {
+	searchRequest.AddFacet("tags", bleve.NewFacetRequest("tags", tagsFacetSize))
+	searchRequest.AddFacet("course", bleve.NewFacetRequest("course", tagsFacetSize))
+
+	timeFacet := bleve.NewFacetRequest("time", len(TimeRanges))
+	for _, r := range TimeRanges {
+		timeFacet.AddNumericRange(r.Key, r.Min, r.Max)
+	}
+	searchRequest.AddFacet("time", timeFacet)
+}
+
+func facets(results search.FacetResults) []Facet {
+	facets := []Facet{}
+	for _, field := range []string{"tags", "course"} {
+		result, ok := results[field]
+		if !ok || result.Terms == nil {
+			continue
+		}
+		facet := Facet{Field: field}
+		for _, term := range result.Terms.Terms() {
+			facet.Values = append(facet.Values, FacetValue{Value: term.Term, Label: term.Term, Count: term.Count})
+		}
+		if len(facet.Values) > 0 {
+			facets = append(facets, facet)
+		}
+	}
+
+	if result, ok := results["time"]; ok {
+		counts := map[string]int{}
+		for _, r := range result.NumericRanges {
+			counts[r.Name] = r.Count
+		}
+		facet := Facet{Field: "time"}
+		for _, r := range TimeRanges {
+			if counts[r.Key] > 0 {
+				facet.Values = append(facet.Values, FacetValue{Value: r.Key, Label: r.Label, Count: counts[r.Key]})
+			}
+		}
+		if len(facet.Values) > 0 {
+			facets = append(facets, facet)
+		}
+	}
+	return facets
+}
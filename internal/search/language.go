@@ -0,0 +1,176 @@
+package search
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/analysis"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/registry"
+
+	// Register the analyzers recipes can be indexed with.  Polish is left out,
+	// its stemmer needs another module.
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/ar"
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/cjk"
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/ckb"
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/da"
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/de"
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/en"
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/es"
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/fa"
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/fi"
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/fr"
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/hi"
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/hr"
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/hu"
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/it"
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/nl"
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/no"
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/pt"
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/ro"
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/ru"
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/sv"
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/tr"
+)
+
+// LanguageNames label the languages in the language filter.
+var LanguageNames = map[string]string{
+	"ar":  "العربية",
+	"cjk": "中文 / 日本語 / 한국어",
+	"ckb": "کوردی",
+	"da":  "Dansk",
+	"de":  "Deutsch",
+	"en":  "English",
+	"es":  "Español",
+	"fa":  "فارسی",
+	"fi":  "Suomi",
+	"fr":  "Français",
+	"hi":  "हिन्दी",
+	"hr":  "Hrvatski",
+	"hu":  "Magyar",
+	"it":  "Italiano",
+	"nl":  "Nederlands",
+	"no":  "Norsk",
+	"pt":  "Português",
+	"ro":  "Română",
+	"ru":  "Русский",
+	"sv":  "Svenska",
+	"tr":  "Türkçe",
+}
+
+// LanguageName returns the name of a language for display, or its code.
+func LanguageName(language string) string {
+	if name, ok := LanguageNames[language]; ok {
+		return name
+	}
+	return language
+}
+
+var (
+	stopWordsMutex sync.Mutex
+	stopWordsCache = registry.NewCache()
+)
+
+func stopWords(language string) analysis.TokenMap {
+	stopWordsMutex.Lock()
+	defer stopWordsMutex.Unlock()
+	words, err := stopWordsCache.TokenMapNamed("stop_" + language)
+	if err != nil {
+		return nil
+	}
+	return words
+}
+
+// minStopWords is the least number of a language's stop words in a text for
+// it to be detected.
+var minStopWords = 3
+
+// DetectLanguage returns the one of languages with the most stop words in
+// text, or "" when there are too few to tell.
+func DetectLanguage(text string, languages []string) string {
+	counts := map[string]int{}
+	for _, word := range words(text) {
+		for _, language := range languages {
+			if stopWords(language)[word] {
+				counts[language]++
+			}
+		}
+	}
+
+	detected, most := "", minStopWords-1
+	for _, language := range languages {
+		if counts[language] > most {
+			detected, most = language, counts[language]
+		}
+	}
+	return detected
+}
+
+// recipeTypeFor is the document mapping of recipes in a language.
+func recipeTypeFor(language string) string {
+	return recipeType + "_" + language
+}
+
+// analyzers returns the text analyzers of each language in the index, so a
+// query is analyzed the way each recipe was.
+func analyzers(idx bleve.Index) []string {
+	set := map[string]bool{}
+	if m, ok := idx.Mapping().(*mapping.IndexMappingImpl); ok {
+		for _, documentMapping := range m.TypeMapping {
+			set[documentMapping.DefaultAnalyzer] = true
+		}
+	}
+	result := make([]string, 0, len(set))
+	for analyzer := range set {
+		result = append(result, analyzer)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// analyzerNameFor returns the name of the text analyzer of recipes in a
+// language.
+func analyzerNameFor(idx bleve.Index, language string) string {
+	m, ok := idx.Mapping().(*mapping.IndexMappingImpl)
+	if !ok {
+		return idx.Mapping().AnalyzerNameForPath("markdown")
+	}
+	documentMapping, ok := m.TypeMapping[recipeTypeFor(language)]
+	if !ok {
+		documentMapping = m.DefaultMapping
+	}
+	return documentMapping.DefaultAnalyzer
+}
+
+// analyzerFor returns the text analyzer of recipes in a language.
+func analyzerFor(idx bleve.Index, language string) analysis.Analyzer {
+	return idx.Mapping().AnalyzerNamed(analyzerNameFor(idx, language))
+}
+
+// ListLanguages returns the distinct languages of all recipes in sorted order.
+func ListLanguages(idx bleve.Index) ([]string, error) {
+	dict, err := idx.FieldDict("language")
+	if err != nil {
+		return nil, err
+	}
+	defer dict.Close()
+
+	languages := []string{}
+	for {
+		entry, err := dict.Next()
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			break
+		}
+		// Skip the languages of deleted recipes, which stay with no count.
+		if entry.Count == 0 {
+			continue
+		}
+		languages = append(languages, entry.Term)
+	}
+	sort.Strings(languages)
+	return languages, nil
+}
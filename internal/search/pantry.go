@@ -0,0 +1,205 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/analysis"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+type PantryResult struct {
+	Name    string   `json:"name"`
+	Webpath string   `json:"webpath"`
+	Have    []string `json:"have"`
+	Missing []string `json:"missing"`
+	// Total is the number of ingredients, not counting ignored staples.
+	Total int `json:"total"`
+}
+
+// terms analyzes text the way the ingredients field is indexed, so "Onions"
+// matches "onion".
+func terms(analyzer analysis.Analyzer, text string) map[string]bool {
+	set := map[string]bool{}
+	for _, token := range analyzer.Analyze([]byte(text)) {
+		set[string(token.Term)] = true
+	}
+	return set
+}
+
+// containsAny reports whether every term of one of items is in line.
+func containsAny(line map[string]bool, items []map[string]bool) bool {
+	for _, item := range items {
+		if len(item) == 0 {
+			continue
+		}
+		found := true
+		for term := range item {
+			if !line[term] {
+				found = false
+				break
+			}
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+// pantryUnits are the measures left out of an ingredient's name, so that
+// "1 tsp salt" is the staple salt.
+var pantryUnits = []string{
+	"cup", "cups", "tbsp", "tablespoon", "tablespoons", "tsp", "teaspoon", "teaspoons",
+	"g", "gram", "grams", "kg", "ml", "l", "liter", "litre", "dl", "cl",
+	"oz", "ounce", "ounces", "lb", "lbs", "pound", "pounds",
+	"pinch", "dash", "handful", "splash", "drizzle",
+	"el", "tl", "prise", "schuss", "msp",
+}
+
+// ingredientName returns the analyzed words of an ingredient without its
+// amount, units and notes after a comma or in parentheses, so that
+// "2 tbsp olive oil, divided" is named olive oil.
+func ingredientName(analyzer analysis.Analyzer, ingredient string, units map[string]bool) string {
+	ingredient, _, _ = strings.Cut(ingredient, ",")
+	for {
+		start := strings.Index(ingredient, "(")
+		end := strings.Index(ingredient, ")")
+		if start < 0 || end < start {
+			break
+		}
+		ingredient = ingredient[:start] + " " + ingredient[end+1:]
+	}
+
+	words := []string{}
+	for _, token := range analyzer.Analyze([]byte(ingredient)) {
+		term := string(token.Term)
+		if first, _ := utf8.DecodeRuneInString(term); unicode.IsNumber(first) || units[term] {
+			continue
+		}
+		words = append(words, term)
+	}
+	return strings.Join(words, " ")
+}
+
+func fieldStrings(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, s := range v {
+			values = append(values, s.(string))
+		}
+		return values
+	}
+	return nil
+}
+
+// Pantry ranks the recipes using any of the ingredients on hand by the share
+// of their ingredients on hand, only the public ones when public is set.
+// Ingredients matching a staple are ignored.
+func Pantry(idx bleve.Index, have []string, staples []string, public bool) ([]PantryResult, error) {
+	queries := []query.Query{}
+	for _, item := range have {
+		for _, analyzer := range analyzers(idx) {
+			q := bleve.NewMatchQuery(item)
+			q.SetField("ingredients")
+			q.Analyzer = analyzer
+			queries = append(queries, q)
+		}
+	}
+	if len(queries) == 0 {
+		return []PantryResult{}, nil
+	}
+
+	// The terms on hand and names of staples in each recipe language.
+	type itemTerms struct {
+		have    []map[string]bool
+		staples map[string]bool
+		units   map[string]bool
+	}
+	termsByLanguage := map[string]itemTerms{}
+	termsFor := func(language string) (itemTerms, analysis.Analyzer) {
+		analyzer := analyzerFor(idx, language)
+		if t, ok := termsByLanguage[language]; ok {
+			return t, analyzer
+		}
+		t := itemTerms{staples: map[string]bool{}, units: map[string]bool{}}
+		for _, item := range have {
+			if itemTerms := terms(analyzer, item); len(itemTerms) > 0 {
+				t.have = append(t.have, itemTerms)
+			}
+		}
+		for _, unit := range pantryUnits {
+			for term := range terms(analyzer, unit) {
+				t.units[term] = true
+			}
+		}
+		// Staples match whole ingredient names, salt is not salted butter.
+		for _, staple := range staples {
+			if name := ingredientName(analyzer, staple, t.units); name != "" {
+				t.staples[name] = true
+			}
+		}
+		termsByLanguage[language] = t
+		return t, analyzer
+	}
+
+	count, err := idx.DocCount()
+	if err != nil {
+		return nil, err
+	}
+
+	searchRequest := bleve.NewSearchRequest(Filters{Public: public}.apply(bleve.NewDisjunctionQuery(queries...)))
+	searchRequest.Fields = []string{"name", "webpath", "language", "ingredients"}
+	searchRequest.Size = int(count)
+
+	searchResults, err := idx.Search(searchRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []PantryResult{}
+	for _, hit := range searchResults.Hits {
+		result := PantryResult{
+			Name:    hit.Fields["name"].(string),
+			Webpath: hit.Fields["webpath"].(string),
+			Have:    []string{},
+			Missing: []string{},
+		}
+		language, _ := hit.Fields["language"].(string)
+		itemTerms, analyzer := termsFor(language)
+		for _, ingredient := range fieldStrings(hit.Fields["ingredients"]) {
+			line := terms(analyzer, ingredient)
+			switch {
+			case len(line) == 0 || itemTerms.staples[ingredientName(analyzer, ingredient, itemTerms.units)]:
+			case containsAny(line, itemTerms.have):
+				result.Have = append(result.Have, ingredient)
+			default:
+				result.Missing = append(result.Missing, ingredient)
+			}
+		}
+		result.Total = len(result.Have) + len(result.Missing)
+		if len(result.Have) > 0 {
+			results = append(results, result)
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		// Compare the share on hand, a.Have/a.Total > b.Have/b.Total.
+		if len(a.Have)*b.Total != len(b.Have)*a.Total {
+			return len(a.Have)*b.Total > len(b.Have)*a.Total
+		}
+		if len(a.Missing) != len(b.Missing) {
+			return len(a.Missing) < len(b.Missing)
+		}
+		return a.Name < b.Name
+	})
+
+	return results, nil
+}
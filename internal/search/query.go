@@ -0,0 +1,334 @@
+package search
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"cookbook/internal/markdown"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+// QueryError describes a query that does not follow the query syntax.
+type QueryError struct {
+	Message string
+}
+
+func (e *QueryError) Error() string {
+	return e.Message
+}
+
+func queryErrorf(format string, a ...any) error {
+	return &QueryError{Message: fmt.Sprintf(format, a...)}
+}
+
+// queryFields maps the fields of the query syntax to the recipe fields they
+// search.
+var queryFields = map[string]string{
+	"name":        "name",
+	"tag":         "tags",
+	"tags":        "tags",
+	"ingredient":  "ingredients",
+	"ingredients": "ingredients",
+	"time":        "time",
+	"servings":    "servings",
+	"source":      "source",
+	"course":      "course",
+	"language":    "language",
+}
+
+const queryFieldNames = "name, tag, ingredient, time, servings, source, course or language"
+
+// clause is one term of a query, ex. -tag:meat.
+type clause struct {
+	negated  bool
+	required bool
+	// field is "" for words of the text.
+	field  string
+	value  string
+	quoted bool
+}
+
+// Query is a search in the query syntax.  Words are searched for in the name,
+// tags and body, "quoted words" as a phrase.  A field:value term narrows the
+// results to recipes with the value in a field, ex. tag:dessert,
+// ingredient:"brown butter", time:<30, servings:>=6 or source:nytimes.com.
+// Terms starting with - exclude recipes, OR between field terms matches either.
+type Query struct {
+	// Text is the words searched for.
+	Text string
+	// groups are the clauses besides the words, the clauses of a group are
+	// joined by OR.
+	groups [][]clause
+}
+
+var fieldPattern = regexp.MustCompile(`^([a-zA-Z]+):`)
+
+// tokens splits q at spaces outside of quotes.
+func tokens(q string) ([]string, error) {
+	tokens := []string{}
+	var token strings.Builder
+	inQuote := false
+	for _, r := range q {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+			token.WriteRune(r)
+		case unicode.IsSpace(r) && !inQuote:
+			if token.Len() > 0 {
+				tokens = append(tokens, token.String())
+				token.Reset()
+			}
+		default:
+			token.WriteRune(r)
+		}
+	}
+	if inQuote {
+		return nil, queryErrorf("missing closing quote in %s", token.String())
+	}
+	if token.Len() > 0 {
+		tokens = append(tokens, token.String())
+	}
+	return tokens, nil
+}
+
+func parseClause(token string) (clause, error) {
+	original := token
+	c := clause{}
+	switch {
+	case strings.HasPrefix(token, "-"):
+		c.negated = true
+		token = token[1:]
+	case strings.HasPrefix(token, "+"):
+		c.required = true
+		token = token[1:]
+	}
+
+	name := ""
+	if m := fieldPattern.FindStringSubmatch(token); m != nil {
+		field, ok := queryFields[strings.ToLower(m[1])]
+		if !ok {
+			return c, queryErrorf("unknown field %q in %s, search by %s", m[1], original, queryFieldNames)
+		}
+		name, c.field = m[1], field
+		token = token[len(m[0]):]
+	}
+
+	if len(token) >= 2 && strings.HasPrefix(token, `"`) && strings.HasSuffix(token, `"`) {
+		c.quoted = true
+		token = token[1 : len(token)-1]
+	}
+	c.value = strings.TrimSpace(token)
+	if c.value == "" {
+		if c.field != "" {
+			return c, queryErrorf("missing value after %s:", name)
+		}
+		return c, queryErrorf("missing search term in %s", original)
+	}
+	return c, nil
+}
+
+// ParseQuery reads a query in the query syntax, see Query.
+func ParseQuery(q string) (*Query, error) {
+	tokens, err := tokens(q)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed := &Query{groups: [][]clause{}}
+	text := []string{}
+	or := false
+	// plain is the last term was a word of the text.
+	plain := false
+	for i, token := range tokens {
+		if token == "OR" {
+			if i == 0 || i == len(tokens)-1 || or {
+				return nil, queryErrorf("OR needs a search term on both sides, ex. tag:soup OR tag:stew")
+			}
+			or = true
+			continue
+		}
+
+		c, err := parseClause(token)
+		if err != nil {
+			return nil, err
+		}
+		isPlain := c.field == "" && !c.quoted && !c.negated && !c.required
+
+		switch {
+		case or && isPlain && plain:
+			// Words of the text already match any of them.
+		case or && (isPlain || plain):
+			return nil, queryErrorf("OR must join two words or two field terms, ex. tag:soup OR tag:stew")
+		case or && (c.negated || parsed.groups[len(parsed.groups)-1][0].negated):
+			return nil, queryErrorf("OR cannot join excluded terms, exclude each of them instead")
+		case or:
+			last := len(parsed.groups) - 1
+			parsed.groups[last] = append(parsed.groups[last], c)
+		case isPlain:
+		default:
+			parsed.groups = append(parsed.groups, []clause{c})
+		}
+		if isPlain {
+			text = append(text, c.value)
+		}
+		or, plain = false, isPlain
+	}
+	parsed.Text = strings.Join(text, " ")
+
+	// Check the values now rather than when searching.
+	for _, group := range parsed.groups {
+		for _, c := range group {
+			if _, err := c.query(nil, DefaultBoosts); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return parsed, nil
+}
+
+// IsPlain reports whether the query is only words, without any other terms.
+func (q *Query) IsPlain() bool {
+	return len(q.groups) == 0
+}
+
+// bleveQuery translates the query, with words analyzed by each of analyzers
+// and weighed by boosts.  Without words or required terms it matches every
+// recipe but the excluded ones.
+func (q *Query) bleveQuery(analyzers []string, boosts Boosts) (query.Query, error) {
+	must := []query.Query{}
+	mustNot := []query.Query{}
+	if q.Text != "" {
+		must = append(must, boosts.query(q.Text, analyzers))
+	}
+	for _, group := range q.groups {
+		queries := []query.Query{}
+		for _, c := range group {
+			cq, err := c.query(analyzers, boosts)
+			if err != nil {
+				return nil, err
+			}
+			queries = append(queries, cq)
+		}
+		var groupQuery query.Query = bleve.NewDisjunctionQuery(queries...)
+		if len(queries) == 1 {
+			groupQuery = queries[0]
+		}
+		if group[0].negated {
+			mustNot = append(mustNot, groupQuery)
+		} else {
+			must = append(must, groupQuery)
+		}
+	}
+	if len(must) == 0 {
+		must = append(must, bleve.NewMatchAllQuery())
+	}
+	if len(mustNot) == 0 {
+		return bleve.NewConjunctionQuery(must...), nil
+	}
+	booleanQuery := bleve.NewBooleanQuery()
+	booleanQuery.AddMust(must...)
+	booleanQuery.AddMustNot(mustNot...)
+	return booleanQuery, nil
+}
+
+// query translates a clause.
+func (c clause) query(analyzers []string, boosts Boosts) (query.Query, error) {
+	switch c.field {
+	case "":
+		if c.quoted {
+			return phraseQuery(c.value, analyzers, "name", "markdown"), nil
+		}
+		return boosts.query(c.value, analyzers), nil
+	case "name", "tags", "ingredients":
+		field := c.field
+		if field == "tags" {
+			field = tagsTextField
+		}
+		// Tags are short, match all their words rather than a phrase.
+		if c.quoted && field != tagsTextField {
+			return phraseQuery(c.value, analyzers, field), nil
+		}
+		queries := []query.Query{}
+		for _, analyzer := range analyzers {
+			match := bleve.NewMatchQuery(c.value)
+			match.SetField(field)
+			match.SetOperator(query.MatchQueryOperatorAnd)
+			match.Analyzer = analyzer
+			queries = append(queries, match)
+		}
+		return bleve.NewDisjunctionQuery(queries...), nil
+	case "time", "servings":
+		return c.rangeQuery()
+	case "language":
+		q := bleve.NewTermQuery(strings.ToLower(c.value))
+		q.SetField(c.field)
+		return q, nil
+	default:
+		// Source urls and courses are matched by part, ignoring case.
+		q := bleve.NewRegexpQuery("(?i).*" + regexp.QuoteMeta(c.value) + ".*")
+		q.SetField(c.field)
+		return q, nil
+	}
+}
+
+func phraseQuery(phrase string, analyzers []string, fields ...string) query.Query {
+	queries := []query.Query{}
+	for _, field := range fields {
+		for _, analyzer := range analyzers {
+			match := bleve.NewMatchPhraseQuery(phrase)
+			match.SetField(field)
+			match.Analyzer = analyzer
+			queries = append(queries, match)
+		}
+	}
+	return bleve.NewDisjunctionQuery(queries...)
+}
+
+var comparison = regexp.MustCompile(`^(<=|>=|<|>|=)?\s*(.*)$`)
+
+// rangeQuery translates a comparison such as time:<30 or servings:>=6.  Times
+// may have units, ex. time:<=1h.
+func (c clause) rangeQuery() (query.Query, error) {
+	m := comparison.FindStringSubmatch(c.value)
+	op, value := m[1], m[2]
+
+	var n float64
+	var err error
+	if c.field == "time" {
+		var ok bool
+		if n, ok = markdown.ParseMinutes(value); !ok {
+			err = fmt.Errorf("not a time")
+		}
+	} else {
+		n, err = strconv.ParseFloat(value, 64)
+	}
+	if err != nil || value == "" {
+		example := "servings:>=6"
+		if c.field == "time" {
+			example = "time:<30"
+		}
+		return nil, queryErrorf("%s:%s is not a number, compare with <, <=, >, >= or =, ex. %s", c.field, c.value, example)
+	}
+
+	inclusive, exclusive := true, false
+	var q *query.NumericRangeQuery
+	switch op {
+	case "<":
+		q = bleve.NewNumericRangeInclusiveQuery(nil, &n, nil, &exclusive)
+	case "<=":
+		q = bleve.NewNumericRangeInclusiveQuery(nil, &n, nil, &inclusive)
+	case ">":
+		q = bleve.NewNumericRangeInclusiveQuery(&n, nil, &exclusive, nil)
+	case ">=":
+		q = bleve.NewNumericRangeInclusiveQuery(&n, nil, &inclusive, nil)
+	default:
+		q = bleve.NewNumericRangeInclusiveQuery(&n, &n, &inclusive, &inclusive)
+	}
+	q.SetField(c.field)
+	return q, nil
+}
@@ -0,0 +1,78 @@
+package search
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSearchRecipesQuerySyntax(t *testing.T) {
+	t.Parallel()
+
+	idx := NewIndex([]string{"en"}, nil)
+	defer idx.Close()
+
+	for _, r := range []Recipe{
+		{Name: "Brown Butter Cookies", Webpath: "Cookies", Tags: []string{"Dessert"}, Course: "Dessert", Time: minutes(25), Servings: minutes(24), Source: "https://cooking.nytimes.com/recipes/1", Ingredients: []string{"1 cup brown butter", "2 cups flour"}},
+		{Name: "Butter Chicken", Webpath: "ButterChicken", Tags: []string{"Meat"}, Course: "Dinner", Time: minutes(60), Servings: minutes(6), Ingredients: []string{"1 lb chicken", "butter"}},
+		{Name: "Pound Cake", Webpath: "PoundCake", Tags: []string{"Dessert", "Baking"}, Time: minutes(90), Servings: minutes(8), Ingredients: []string{"brown sugar", "1 cup butter"}},
+	} {
+		r.Markdown = strings.Join(r.Ingredients, "\n")
+		if err := UpsertRecipe(idx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for q, expected := range map[string][]string{
+		"tag:dessert":                      {"Cookies", "PoundCake"},
+		`ingredient:"brown butter"`:        {"Cookies"},
+		"butter time:<30":                  {"Cookies"},
+		"time:<=1h":                        {"ButterChicken", "Cookies"},
+		"servings:>=6 -tag:meat":           {"Cookies", "PoundCake"},
+		"source:nytimes.com":               {"Cookies"},
+		"tag:meat OR tag:baking":           {"ButterChicken", "PoundCake"},
+		"course:dinner":                    {"ButterChicken"},
+		`-ingredient:chicken "pound cake"`: {"PoundCake"},
+	} {
+		results, err := SearchRecipes(idx, q, Options{Sort: SortName})
+		if err != nil {
+			t.Errorf("%s: %v", q, err)
+			continue
+		}
+		webpaths := []string{}
+		for _, hit := range results.Hits {
+			webpaths = append(webpaths, hit.Webpath)
+		}
+		slices.Sort(webpaths)
+		if !slices.Equal(webpaths, expected) {
+			t.Errorf("%s: expected %v, got %v", q, expected, webpaths)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	t.Parallel()
+
+	for q, expected := range map[string]string{
+		"color:red":         `unknown field "color"`,
+		"tag:":              "missing value after tag:",
+		`ingredient:"brown`: "missing closing quote",
+		"time:<soon":        "time:<soon is not a number",
+		"servings:>=many":   "servings:>=many is not a number",
+		"OR tag:soup":       "OR needs a search term on both sides",
+		"soup OR tag:stew":  "OR must join two words or two field terms",
+		"-tag:a OR tag:b":   "OR cannot join excluded terms",
+	} {
+		_, err := ParseQuery(q)
+		var queryErr *QueryError
+		if !errors.As(err, &queryErr) || !strings.Contains(queryErr.Message, expected) {
+			t.Errorf("%s: expected an error containing %q, got %v", q, expected, err)
+		}
+	}
+
+	parsed, err := ParseQuery("soup OR stew")
+	if err != nil || parsed.Text != "soup stew" || !parsed.IsPlain() {
+		t.Errorf("expected plain words, got %+v, %v", parsed, err)
+	}
+}
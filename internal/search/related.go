@@ -0,0 +1,127 @@
+package search
+
+import (
+	"unicode/utf8"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+// RelatedWeights weigh shared tags, shared ingredients and similar text in
+// finding related recipes.
+type RelatedWeights struct {
+	Tags        float64
+	Ingredients float64
+	Terms       float64
+}
+
+type RelatedRecipe struct {
+	Name       string
+	Webpath    string
+	Visibility string
+}
+
+// Listed reports whether the related recipe is listed for users who are not
+// signed in.
+func (r RelatedRecipe) Listed() bool {
+	return Recipe{Visibility: r.Visibility}.Listed()
+}
+
+// maxRelatedText limits the recipe text compared for term similarity.
+var maxRelatedText = 4000
+
+// Related returns up to count recipes most like the recipe at webpath by the
+// tags and ingredients they share and the similarity of their text.
+func Related(idx bleve.Index, webpath string, weights RelatedWeights, count int) ([]RelatedRecipe, error) {
+	recipe, err := GetRecipe(idx, webpath)
+	if err != nil {
+		return nil, err
+	}
+
+	queries := []query.Query{}
+	if weights.Tags > 0 {
+		for _, tag := range recipe.Tags {
+			// Other is the tag of recipes without tags, not a likeness.
+			if tag == "Other" {
+				continue
+			}
+			q := bleve.NewTermQuery(tag)
+			q.SetField("tags")
+			q.SetBoost(weights.Tags)
+			queries = append(queries, q)
+		}
+	}
+
+	analyzer := analyzerNameFor(idx, recipe.Language)
+	if weights.Ingredients > 0 {
+		for _, ingredient := range recipe.Ingredients {
+			q := bleve.NewMatchQuery(ingredient)
+			q.SetField("ingredients")
+			q.Analyzer = analyzer
+			q.SetBoost(weights.Ingredients)
+			queries = append(queries, q)
+		}
+	}
+	if weights.Terms > 0 {
+		text := recipe.Name + "\n" + recipe.Markdown
+		if len(text) > maxRelatedText {
+			// Cut at the start of a rune, not in the middle of one.
+			end := maxRelatedText
+			for end > 0 && !utf8.RuneStart(text[end]) {
+				end--
+			}
+			text = text[:end]
+		}
+		q := bleve.NewMatchQuery(text)
+		q.SetField("markdown")
+		q.Analyzer = analyzer
+		q.SetBoost(weights.Terms)
+		queries = append(queries, q)
+	}
+	if len(queries) == 0 || count <= 0 {
+		return []RelatedRecipe{}, nil
+	}
+
+	relatedQuery := bleve.NewBooleanQuery()
+	relatedQuery.AddShould(queries...)
+	relatedQuery.AddMustNot(bleve.NewDocIDQuery([]string{webpath}))
+
+	searchRequest := bleve.NewSearchRequest(relatedQuery)
+	searchRequest.Fields = []string{"name", "webpath", "visibility"}
+	searchRequest.Size = count
+
+	results, err := idx.Search(searchRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	related := make([]RelatedRecipe, 0, len(results.Hits))
+	for _, hit := range results.Hits {
+		visibility, _ := hit.Fields["visibility"].(string)
+		related = append(related, RelatedRecipe{
+			Name:       hit.Fields["name"].(string),
+			Webpath:    hit.Fields["webpath"].(string),
+			Visibility: visibility,
+		})
+	}
+	return related, nil
+}
+
+// Webpaths returns the webpaths of all recipes.
+func Webpaths(idx bleve.Index) ([]string, error) {
+	count, err := idx.DocCount()
+	if err != nil {
+		return nil, err
+	}
+	searchRequest := bleve.NewSearchRequest(bleve.NewMatchAllQuery())
+	searchRequest.Size = int(count)
+	results, err := idx.Search(searchRequest)
+	if err != nil {
+		return nil, err
+	}
+	webpaths := make([]string, 0, len(results.Hits))
+	for _, hit := range results.Hits {
+		webpaths = append(webpaths, hit.ID)
+	}
+	return webpaths, nil
+}
@@ -2,58 +2,197 @@ package search
 
 import (
 	"errors"
+	"fmt"
 	"html/template"
 	"log"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/simple"
+	"github.com/blevesearch/bleve/v2/mapping"
 	"github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/search/query"
 
 	index "github.com/blevesearch/bleve_index_api"
 )
 
-func NewIndex(language string) bleve.Index {
+// NewIndex creates the recipe index with the groups of synonyms.  Recipes are
+// analyzed in their language, one of languages, or the first language when it
+// is not one of them.
+func NewIndex(languages []string, synonyms [][]string) bleve.Index {
+	mapping := bleve.NewIndexMapping()
+
+	for i, language := range languages {
+		analyzer := language
+		if len(synonyms) > 0 {
+			analyzer = synonymsAnalyzerType + "_" + language
+			err := mapping.AddCustomAnalyzer(analyzer, map[string]interface{}{
+				"type":     synonymsAnalyzerType,
+				"analyzer": language,
+				"synonyms": synonyms,
+			})
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		recipeMapping := newRecipeMapping(analyzer)
+		mapping.AddDocumentMapping(recipeTypeFor(language), recipeMapping)
+		if i == 0 {
+			mapping.AddDocumentMapping(recipeType, recipeMapping)
+			mapping.DefaultMapping = recipeMapping
+			mapping.DefaultAnalyzer = analyzer
+		}
+	}
+
+	idx, err := bleve.NewMemOnly(mapping)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return idx
+}
+
+// newRecipeMapping maps the fields of recipes with text analyzed by analyzer.
+func newRecipeMapping(analyzer string) *mapping.DocumentMapping {
 	recipeMapping := bleve.NewDocumentMapping()
+	recipeMapping.DefaultAnalyzer = analyzer
 
 	keywordMapping := bleve.NewKeywordFieldMapping()
 	recipeMapping.AddFieldMappingsAt("filename", keywordMapping)
 	recipeMapping.AddFieldMappingsAt("webpath", keywordMapping)
-	recipeMapping.AddFieldMappingsAt("html", keywordMapping)
-	recipeMapping.AddFieldMappingsAt("tags", keywordMapping)
 
-	englishMapping := bleve.NewTextFieldMapping()
-	englishMapping.Analyzer = language
-	recipeMapping.AddFieldMappingsAt("name", englishMapping)
-	recipeMapping.AddFieldMappingsAt("markdown", englishMapping)
+	// Tags are also searched as text.
+	tagsTextMapping := bleve.NewTextFieldMapping()
+	tagsTextMapping.Name = tagsTextField
+	tagsTextMapping.Analyzer = analyzer
+	tagsTextMapping.Store = false
+	tagsTextMapping.IncludeInAll = false
+	tagsTextMapping.IncludeTermVectors = false
+	recipeMapping.AddFieldMappingsAt("tags", keywordMapping, tagsTextMapping)
 
-	mapping := bleve.NewIndexMapping()
-	mapping.AddDocumentMapping("recipe", recipeMapping)
+	recipeMapping.AddFieldMappingsAt("source", keywordMapping)
+	recipeMapping.AddFieldMappingsAt("imported", keywordMapping)
+	recipeMapping.AddFieldMappingsAt("method", keywordMapping)
+	recipeMapping.AddFieldMappingsAt("course", keywordMapping)
+	recipeMapping.AddFieldMappingsAt("language", keywordMapping)
+	recipeMapping.AddFieldMappingsAt("visibility", keywordMapping)
 
-	idx, err := bleve.NewMemOnly(mapping)
-	if err != nil {
-		log.Fatal(err)
+	numericMapping := bleve.NewNumericFieldMapping()
+	recipeMapping.AddFieldMappingsAt("time", numericMapping)
+	recipeMapping.AddFieldMappingsAt("servings", numericMapping)
+
+	dateMapping := bleve.NewDateTimeFieldMapping()
+	recipeMapping.AddFieldMappingsAt("added", dateMapping)
+	recipeMapping.AddFieldMappingsAt("modified", dateMapping)
+
+	storedMapping := bleve.NewTextFieldMapping()
+	storedMapping.Index = false
+	storedMapping.IncludeInAll = false
+	storedMapping.IncludeTermVectors = false
+	recipeMapping.AddFieldMappingsAt("html", storedMapping)
+
+	textMapping := bleve.NewTextFieldMapping()
+	textMapping.Analyzer = analyzer
+
+	// The words as typed, without stemming, for suggestions and corrections.
+	spellingMapping := bleve.NewTextFieldMapping()
+	spellingMapping.Name = spellingField
+	spellingMapping.Analyzer = simple.Name
+	spellingMapping.Store = false
+	spellingMapping.IncludeInAll = false
+	spellingMapping.IncludeTermVectors = false
+
+	recipeMapping.AddFieldMappingsAt("name", textMapping, spellingMapping)
+	recipeMapping.AddFieldMappingsAt("markdown", textMapping, spellingMapping)
+
+	// Ingredients repeat the markdown, keep them out of the default search.
+	ingredientsMapping := bleve.NewTextFieldMapping()
+	ingredientsMapping.Analyzer = analyzer
+	ingredientsMapping.IncludeInAll = false
+	recipeMapping.AddFieldMappingsAt("ingredients", ingredientsMapping)
+
+	return recipeMapping
+}
+
+var recipeType = "recipe"
+
+const tagsTextField = "tags_text"
+
+// Visibilities of recipes.  Public recipes are listed for everyone, unlisted
+// recipes only for signed in users though anyone with the link may open them,
+// and private recipes are only shown to signed in users.
+const (
+	VisibilityPublic   = "public"
+	VisibilityUnlisted = "unlisted"
+	VisibilityPrivate  = "private"
+)
+
+// ParseVisibility returns the visibility of the recipe metadata value, public
+// when it is empty.
+func ParseVisibility(value string) (string, error) {
+	switch v := strings.ToLower(strings.TrimSpace(value)); v {
+	case "":
+		return VisibilityPublic, nil
+	case VisibilityPublic, VisibilityUnlisted, VisibilityPrivate:
+		return v, nil
 	}
-	return idx
+	return "", fmt.Errorf("unknown visibility %q", value)
+}
+
+// Recipe is the document indexed for each recipe file.
+type Recipe struct {
+	Filename string   `json:"filename"`
+	Name     string   `json:"name"`
+	Webpath  string   `json:"webpath"`
+	HTML     string   `json:"html"`
+	Markdown string   `json:"markdown"`
+	Tags     []string `json:"tags"`
+	Source   string   `json:"source"`
+	Imported string   `json:"imported"`
+	Method   string   `json:"method"`
+	Course   string   `json:"course"`
+	// Language is the code of the language analyzer, ex. "en".
+	Language string `json:"language"`
+	// Time is the cook time in minutes, nil when unknown.
+	Time     *float64 `json:"time"`
+	Servings *float64 `json:"servings"`
+	// Added and Modified are the recipe file's creation and modification
+	// times.
+	Added    time.Time `json:"added"`
+	Modified time.Time `json:"modified"`
+	// Ingredients are the items of the recipe's ingredient list.
+	Ingredients []string `json:"ingredients"`
+	// Visibility is one of the Visibility constants, public when "".
+	Visibility string `json:"visibility"`
+}
+
+// Listed reports whether the recipe is listed for users who are not signed
+// in.
+func (r Recipe) Listed() bool {
+	return r.Visibility == VisibilityPublic || r.Visibility == ""
+}
+
+// Private reports whether the recipe is only shown to signed in users.
+func (r Recipe) Private() bool {
+	return r.Visibility == VisibilityPrivate
 }
 
-func UpsertRecipe(index bleve.Index, filename, name, webpath, html, markdown string, tags []string) error {
-	recipe := struct {
-		Filename string   `json:"filename"`
-		Name     string   `json:"name"`
-		Webpath  string   `json:"webpath"`
-		HTML     string   `json:"html"`
-		Markdown string   `json:"markdown"`
-		Tags     []string `json:"tags"`
-	}{
-		Filename: filename,
-		Name:     name,
-		Webpath:  webpath,
-		HTML:     html,
-		Markdown: markdown,
-		Tags:     tags,
+// Type selects the recipe document mapping of its language, see bleve's
+// Classifier.
+func (r Recipe) Type() string {
+	if r.Language == "" {
+		return recipeType
 	}
-	return index.Index(webpath, recipe)
+	return recipeTypeFor(r.Language)
+}
+
+func UpsertRecipe(index bleve.Index, recipe Recipe) error {
+	if recipe.Visibility == "" {
+		recipe.Visibility = VisibilityPublic
+	}
+	return index.Index(recipe.Webpath, recipe)
 }
 
 func DeleteRecipe(index bleve.Index, webpath string) error {
@@ -62,29 +201,82 @@ func DeleteRecipe(index bleve.Index, webpath string) error {
 
 var ErrNotFound = errors.New("recipe not found")
 
-func GetRecipe(idx bleve.Index, webpath string) (string, string, string, error) {
+func GetRecipe(idx bleve.Index, webpath string) (*Recipe, error) {
 	doc, err := idx.Document(webpath)
 	if err != nil {
-		return "", "", "", err
+		return nil, err
 	}
 	if doc == nil {
-		return "", "", "", ErrNotFound
+		return nil, ErrNotFound
 	}
 
-	var filename, name, html string
+	recipe := Recipe{Webpath: webpath}
 
 	doc.VisitFields(func(field index.Field) {
+		value := string(field.Value())
 		switch field.Name() {
 		case "filename":
-			filename = string(field.Value())
+			recipe.Filename = value
 		case "name":
-			name = string(field.Value())
+			recipe.Name = value
 		case "html":
-			html = string(field.Value())
+			recipe.HTML = value
+		case "markdown":
+			recipe.Markdown = value
+		case "tags":
+			recipe.Tags = append(recipe.Tags, value)
+		case "source":
+			recipe.Source = value
+		case "imported":
+			recipe.Imported = value
+		case "method":
+			recipe.Method = value
+		case "course":
+			recipe.Course = value
+		case "language":
+			recipe.Language = value
+		case "visibility":
+			recipe.Visibility = value
+		case "time", "servings":
+			if f, ok := field.(index.NumericField); ok {
+				if n, err := f.Number(); err == nil {
+					if field.Name() == "time" {
+						recipe.Time = &n
+					} else {
+						recipe.Servings = &n
+					}
+				}
+			}
+		case "added", "modified":
+			if f, ok := field.(index.DateTimeField); ok {
+				if t, _, err := f.DateTime(); err == nil {
+					if field.Name() == "added" {
+						recipe.Added = t
+					} else {
+						recipe.Modified = t
+					}
+				}
+			}
+		case "ingredients":
+			recipe.Ingredients = append(recipe.Ingredients, value)
 		}
 	})
 
-	return filename, name, html, nil
+	return &recipe, nil
+}
+
+// HasSource reports whether a recipe was imported from the source url.
+func HasSource(idx bleve.Index, source string) (bool, error) {
+	query := bleve.NewTermQuery(source)
+	query.SetField("source")
+	searchRequest := bleve.NewSearchRequest(query)
+	searchRequest.Size = 0
+
+	searchResults, err := idx.Search(searchRequest)
+	if err != nil {
+		return false, err
+	}
+	return searchResults.Total > 0, nil
 }
 
 type RecipesGroupedByTag struct {
@@ -92,78 +284,246 @@ type RecipesGroupedByTag struct {
 	Recipes []map[string]string
 }
 
-func GetRecipesGroupedByTag(index bleve.Index) ([]RecipesGroupedByTag, error) {
-	query := bleve.NewMatchAllQuery()
-	searchRequest := bleve.NewSearchRequest(query)
-	searchRequest.Fields = []string{"name", "webpath", "tags"}
-	searchRequest.SortBy([]string{"webpath"})
-	searchRequest.Size = 1000
+// TagsPerPage is the number of tag groups on each page of the index.
+var TagsPerPage = 10
 
-	searchResults, err := index.Search(searchRequest)
+// GetRecipesGroupedByTag returns a page, starting at 1, of the tags in order
+// with their recipes, only the public ones when public is set.  It also
+// reports whether there are more pages.
+func GetRecipesGroupedByTag(index bleve.Index, order Sort, page int, public bool) ([]RecipesGroupedByTag, bool, error) {
+	tags, err := tagCounts(index, public)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
-	// Group recipes by tags
-	tagMap := make(map[string][]map[string]string)
-	addTag := func(hit *search.DocumentMatch, tag string) {
-		tagName := strings.TrimSpace(tag)
-		recipe := map[string]string{
-			"Name":    hit.Fields["name"].(string),
-			"Webpath": hit.Fields["webpath"].(string),
-		}
-		tagMap[tagName] = append(tagMap[tagName], recipe)
-	}
+	from := min((max(page, 1)-1)*TagsPerPage, len(tags))
+	to := min(from+TagsPerPage, len(tags))
 
-	for _, hit := range searchResults.Hits {
-		switch tags := hit.Fields["tags"].(type) {
-		case string:
-			addTag(hit, tags)
-		case []interface{}:
-			for _, tag := range tags {
-				addTag(hit, tag.(string))
-			}
+	result := []RecipesGroupedByTag{}
+	for _, tag := range tags[from:to] {
+		query := bleve.NewTermQuery(tag.Term)
+		query.SetField("tags")
+		searchRequest := bleve.NewSearchRequest(Filters{Public: public}.apply(query))
+		searchRequest.Fields = []string{"name", "webpath"}
+		searchRequest.SortBy(order.fields(false))
+		searchRequest.Size = int(tag.Count)
+
+		searchResults, err := index.Search(searchRequest)
+		if err != nil {
+			return nil, false, err
 		}
-	}
 
-	// Convert map to slice and sort
-	var result []RecipesGroupedByTag
-	for tag, recipes := range tagMap {
+		recipes := make([]map[string]string, 0, len(searchResults.Hits))
+		for _, hit := range searchResults.Hits {
+			recipes = append(recipes, map[string]string{
+				"Name":    hit.Fields["name"].(string),
+				"Webpath": hit.Fields["webpath"].(string),
+			})
+		}
 		result = append(result, RecipesGroupedByTag{
-			TagName: tag,
+			TagName: tag.Term,
 			Recipes: recipes,
 		})
 	}
-	sort.Slice(result, func(i, j int) bool {
-		return result[i].TagName < result[j].TagName
-	})
 
-	return result, nil
+	return result, to < len(tags), nil
+}
+
+// RecentRecipes returns up to count recipes, most recently modified first,
+// only those with tag unless it is "", and only public ones when public is
+// set.
+func RecentRecipes(idx bleve.Index, tag string, count int, public bool) ([]Recipe, error) {
+	var q query.Query = bleve.NewMatchAllQuery()
+	if tag != "" {
+		tagQuery := bleve.NewTermQuery(tag)
+		tagQuery.SetField("tags")
+		q = tagQuery
+	}
+	searchRequest := bleve.NewSearchRequest(Filters{Public: public}.apply(q))
+	searchRequest.SortBy(SortModified.fields(false))
+	searchRequest.Size = count
+
+	results, err := idx.Search(searchRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	recipes := make([]Recipe, 0, len(results.Hits))
+	for _, hit := range results.Hits {
+		recipe, err := GetRecipe(idx, hit.ID)
+		if err != nil {
+			return nil, err
+		}
+		recipes = append(recipes, *recipe)
+	}
+	return recipes, nil
 }
 
 type SearchResult struct {
-	Name    template.HTML
-	Webpath string
-	Snippet template.HTML
+	// Name is highlighted where it matches the query.
+	Name template.HTML
+	// PlainName is the name without highlighting.
+	PlainName string
+	Webpath   string
+	Snippet   template.HTML
 }
 
-func SearchRecipes(index bleve.Index, query string) ([]SearchResult, error) {
-	searchQuery := bleve.NewQueryStringQuery(query)
-	searchRequest := bleve.NewSearchRequest(searchQuery)
+// Semantic blends the similarity of recipe embeddings to the query's
+// embedding into the text ranking.
+type Semantic struct {
+	Vectors *Vectors
+	Query   []float32
+	// Weight is the share of vector similarity in the score, from 0 to 1.
+	Weight float64
+	// MinSimilarity is the least similarity for a recipe without matching
+	// text to be included.
+	MinSimilarity float64
+}
+
+// searchCandidates is the number of recipes most similar to the query ranked
+// along with the text hits.
+var searchCandidates = 50
+
+// PageSize is the number of search results on each page.
+var PageSize = 20
+
+// Boosts weigh the matches of a query in each field.
+type Boosts struct {
+	Name float64
+	Tags float64
+	Body float64
+}
+
+// DefaultBoosts rank matches in the name above tags above the body.
+var DefaultBoosts = Boosts{Name: 3, Tags: 2, Body: 1}
+
+// query matches q in the name, tags or markdown, analyzed with each of
+// analyzers, scored by the boost of the fields matching.
+func (b Boosts) query(q string, analyzers []string) query.Query {
+	fields := []struct {
+		name  string
+		boost float64
+	}{{"name", b.Name}, {tagsTextField, b.Tags}, {"markdown", b.Body}}
+
+	queries := []query.Query{}
+	for _, field := range fields {
+		if field.boost > 0 {
+			for _, analyzer := range analyzers {
+				match := bleve.NewMatchQuery(q)
+				match.SetField(field.name)
+				match.Analyzer = analyzer
+				match.SetBoost(field.boost)
+				queries = append(queries, match)
+			}
+		}
+	}
+	return bleve.NewDisjunctionQuery(queries...)
+}
+
+type Options struct {
+	Filters Filters
+	// Boosts default to DefaultBoosts.
+	Boosts Boosts
+	Sort   Sort
+	// Page starts at 1.
+	Page int
+	// Semantic only applies to the relevance sort.
+	Semantic *Semantic
+}
+
+type SearchResults struct {
+	Hits   []SearchResult
+	Total  uint64
+	Facets []Facet
+	// More reports whether there is a next page.
+	More bool
+	// Fuzzy reports whether nothing matched the query exactly and the hits
+	// match words similar to it.
+	Fuzzy bool
+	// Corrected is the query with misspelled words corrected, set when
+	// nothing matched the query exactly.
+	Corrected string
+}
+
+// SearchRecipes searches for a query string, or every recipe when it is
+// empty, narrowed by filters.  The results are counted by tags, course and
+// cook time.
+func SearchRecipes(index bleve.Index, q string, options Options) (*SearchResults, error) {
+	parsed, err := ParseQuery(q)
+	if err != nil {
+		return nil, err
+	}
+
+	filters := options.Filters
+	semantic := options.Semantic
+	if options.Sort != SortRelevance || parsed.Text == "" {
+		semantic = nil
+	}
+	from := (max(options.Page, 1) - 1) * PageSize
+
+	boosts := options.Boosts
+	if boosts == (Boosts{}) {
+		boosts = DefaultBoosts
+	}
+
+	searchQuery, err := parsed.bleveQuery(analyzers(index), boosts)
+	if err != nil {
+		return nil, err
+	}
+
+	searchRequest := bleve.NewSearchRequest(filters.apply(searchQuery))
 	searchRequest.Fields = []string{"name", "webpath", "markdown"}
 	highlight := bleve.NewHighlight()
 	highlight.AddField("name")
 	highlight.AddField("markdown")
 
-	searchRequest.Highlight = highlight
+	if q != "" {
+		searchRequest.Highlight = highlight
+	}
+	searchRequest.SortBy(options.Sort.fields(q != ""))
+	addFacets(searchRequest)
+
+	if semantic != nil {
+		// Rank every candidate up to the page, then take the page.
+		searchRequest.Size = from + PageSize + searchCandidates
+	} else {
+		searchRequest.From = from
+		searchRequest.Size = PageSize
+	}
 
 	results, err := index.Search(searchRequest)
 	if err != nil {
 		return nil, err
 	}
 
-	searchResults := make([]SearchResult, 0, len(results.Hits))
-	for _, hit := range results.Hits {
+	// Fall back to similar words when nothing matches.
+	fuzzy, corrected := false, ""
+	if results.Total == 0 && parsed.Text != "" && parsed.IsPlain() {
+		if corrected, err = Correct(index, q, filters.Public); err != nil {
+			return nil, err
+		}
+		if fuzzyQuery := fuzzyQuery(parsed.Text); fuzzyQuery != nil {
+			searchRequest.Query = filters.apply(fuzzyQuery)
+			if results, err = index.Search(searchRequest); err != nil {
+				return nil, err
+			}
+			fuzzy = results.Total > 0
+		}
+	}
+
+	hits := results.Hits
+	total := results.Total
+	if semantic != nil {
+		ranked, added, err := rankHybrid(index, results, filters, semantic)
+		if err != nil {
+			return nil, err
+		}
+		total += uint64(added)
+		hits = ranked[min(from, len(ranked)):min(from+PageSize, len(ranked))]
+	}
+
+	searchResults := make([]SearchResult, 0, len(hits))
+	for _, hit := range hits {
 		name := hit.Fields["name"].(string)
 		if fragments, exists := hit.Fragments["name"]; exists && len(fragments) > 0 {
 			name = fragments[0]
@@ -175,11 +535,157 @@ func SearchRecipes(index bleve.Index, query string) ([]SearchResult, error) {
 		}
 
 		searchResults = append(searchResults, SearchResult{
-			Name:    template.HTML(name),
-			Webpath: hit.Fields["webpath"].(string),
-			Snippet: template.HTML(snippet),
+			Name:      template.HTML(name),
+			PlainName: hit.Fields["name"].(string),
+			Webpath:   hit.Fields["webpath"].(string),
+			Snippet:   template.HTML(snippet),
 		})
 	}
 
-	return searchResults, nil
+	return &SearchResults{
+		Hits:      searchResults,
+		Total:     total,
+		Facets:    facets(results.Facets),
+		More:      uint64(from+len(hits)) < total,
+		Fuzzy:     fuzzy,
+		Corrected: corrected,
+	}, nil
+}
+
+// rankHybrid scores the text hits and the recipes most similar to the query
+// by Weight * similarity + (1 - Weight) * text score, with text scores
+// normalized to the best hit.  It also returns the number of recipes found
+// only by similarity.
+func rankHybrid(index bleve.Index, results *bleve.SearchResult, filters Filters, semantic *Semantic) (search.DocumentMatchCollection, int, error) {
+	similarities := semantic.Vectors.Similarities(semantic.Query)
+
+	scores := map[string]float64{}
+	hits := map[string]*search.DocumentMatch{}
+	for _, hit := range results.Hits {
+		textScore := 0.0
+		if results.MaxScore > 0 {
+			textScore = hit.Score / results.MaxScore
+		}
+		scores[hit.ID] = (1-semantic.Weight)*textScore + semantic.Weight*similarities[hit.ID]
+		hits[hit.ID] = hit
+	}
+
+	similar := make([]string, 0, len(similarities))
+	for webpath, similarity := range similarities {
+		if similarity >= semantic.MinSimilarity {
+			similar = append(similar, webpath)
+		}
+	}
+	sort.Slice(similar, func(i, j int) bool {
+		return similarities[similar[i]] > similarities[similar[j]]
+	})
+	if len(similar) > searchCandidates {
+		similar = similar[:searchCandidates]
+	}
+
+	missing := []string{}
+	for _, webpath := range similar {
+		if _, ok := scores[webpath]; !ok {
+			scores[webpath] = semantic.Weight * similarities[webpath]
+			missing = append(missing, webpath)
+		}
+	}
+
+	// Load the fields of recipes found only by similarity, if they pass the
+	// filters.
+	if len(missing) > 0 {
+		searchRequest := bleve.NewSearchRequest(filters.apply(bleve.NewDocIDQuery(missing)))
+		searchRequest.Fields = []string{"name", "webpath"}
+		searchRequest.Size = len(missing)
+		missingResults, err := index.Search(searchRequest)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, hit := range missingResults.Hits {
+			hits[hit.ID] = hit
+		}
+	}
+
+	added := len(hits) - len(results.Hits)
+	ranked := make(search.DocumentMatchCollection, 0, len(hits))
+	for _, hit := range hits {
+		ranked = append(ranked, hit)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if scores[ranked[i].ID] != scores[ranked[j].ID] {
+			return scores[ranked[i].ID] > scores[ranked[j].ID]
+		}
+		return ranked[i].ID < ranked[j].ID
+	})
+	return ranked, added, nil
+}
+
+// tagCounts returns each tag in order with the number of recipes using it,
+// counting only the public recipes when public is set.
+func tagCounts(idx bleve.Index, public bool) ([]index.DictEntry, error) {
+	dict, err := idx.FieldDict("tags")
+	if err != nil {
+		return nil, err
+	}
+	defer dict.Close()
+
+	tags := []index.DictEntry{}
+	for {
+		entry, err := dict.Next()
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			break
+		}
+		// The dictionary keeps tags no recipe uses any more, with no count.
+		if entry.Count == 0 {
+			continue
+		}
+		tags = append(tags, *entry)
+	}
+	if public {
+		var err error
+		if tags, err = publicTagCounts(idx, len(tags)); err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].Term < tags[j].Term
+	})
+	return tags, nil
+}
+
+// publicTagCounts counts the public recipes of up to size tags.  The tags
+// dictionary counts every recipe, so these are counted by a facet.
+func publicTagCounts(idx bleve.Index, size int) ([]index.DictEntry, error) {
+	searchRequest := bleve.NewSearchRequest(Filters{Public: true}.apply(bleve.NewMatchAllQuery()))
+	searchRequest.Size = 0
+	searchRequest.AddFacet("tags", bleve.NewFacetRequest("tags", max(size, 1)))
+
+	results, err := idx.Search(searchRequest)
+	if err != nil {
+		return nil, err
+	}
+	tags := []index.DictEntry{}
+	if result, ok := results.Facets["tags"]; ok && result.Terms != nil {
+		for _, term := range result.Terms.Terms() {
+			tags = append(tags, index.DictEntry{Term: term.Term, Count: uint64(term.Count)})
+		}
+	}
+	return tags, nil
+}
+
+// ListTags returns the distinct tags of all recipes in sorted order, only of
+// the public ones when public is set.
+func ListTags(idx bleve.Index, public bool) ([]string, error) {
+	entries, err := tagCounts(idx, public)
+	if err != nil {
+		return nil, err
+	}
+	tags := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		tags = append(tags, entry.Term)
+	}
+	return tags, nil
 }
@@ -0,0 +1,639 @@
+package search
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSearchRecipesHybrid(t *testing.T) {
+	t.Parallel()
+
+	idx := NewIndex([]string{"en"}, nil)
+	defer idx.Close()
+
+	vectors := NewVectors()
+	recipes := []struct {
+		recipe Recipe
+		vector []float32
+	}{
+		{Recipe{Name: "Squash Soup", Webpath: "SquashSoup", Markdown: "butternut squash, onion"}, []float32{1, 0}},
+		{Recipe{Name: "Chili", Webpath: "Chili", Markdown: "beans, peppers"}, []float32{0.9, 0.1}},
+		{Recipe{Name: "Lemonade", Webpath: "Lemonade", Markdown: "lemons, squash drink"}, []float32{0, 1}},
+	}
+	for _, r := range recipes {
+		if err := UpsertRecipe(idx, r.recipe); err != nil {
+			t.Fatal(err)
+		}
+		vectors.Set(r.recipe.Webpath, r.vector)
+	}
+
+	results, err := SearchRecipes(idx, "squash", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results.Hits) != 2 {
+		t.Fatalf("expected 2 text results, got %d", len(results.Hits))
+	}
+
+	results, err = SearchRecipes(idx, "squash", Options{Semantic: &Semantic{
+		Vectors:       vectors,
+		Query:         []float32{1, 0},
+		Weight:        0.5,
+		MinSimilarity: 0.5,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	webpaths := []string{}
+	for _, r := range results.Hits {
+		webpaths = append(webpaths, r.Webpath)
+	}
+	// Chili has no text match but is similar, Lemonade matches the text only.
+	expected := []string{"SquashSoup", "Chili", "Lemonade"}
+	if !slices.Equal(webpaths, expected) {
+		t.Errorf("expected %v, got %v", expected, webpaths)
+	}
+}
+
+func TestPantry(t *testing.T) {
+	t.Parallel()
+
+	idx := NewIndex([]string{"en"}, nil)
+	defer idx.Close()
+
+	for _, r := range []Recipe{
+		{Name: "Squash Soup", Webpath: "SquashSoup", Ingredients: []string{"2 cups butternut squash", "1 onion", "salt"}},
+		{Name: "Roast Squash", Webpath: "RoastSquash", Ingredients: []string{"1 squash", "2 tbsp oil (any neutral oil)"}},
+		{Name: "Pasta", Webpath: "Pasta", Ingredients: []string{"pasta", "salt"}},
+		{Name: "Squash Toast", Webpath: "SquashToast", Ingredients: []string{"1 squash", "1 tbsp olive oil", "2 tbsp salted butter", "1 tsp salt, to taste"}},
+	} {
+		if err := UpsertRecipe(idx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results, err := Pantry(idx, []string{"Squash", "onions"}, []string{"salt", "oil"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %+v", results)
+	}
+	if results[0].Webpath != "RoastSquash" || results[0].Total != 1 {
+		t.Errorf("expected Roast Squash with the oil ignored first, got %+v", results[0])
+	}
+	if results[1].Webpath != "SquashSoup" || len(results[1].Have) != 2 || len(results[1].Missing) != 0 {
+		t.Errorf("expected Squash Soup with squash and onion on hand, got %+v", results[1])
+	}
+	// Staples match whole ingredients, not ones containing their words.
+	if results[2].Webpath != "SquashToast" || !slices.Equal(results[2].Missing, []string{"1 tbsp olive oil", "2 tbsp salted butter"}) {
+		t.Errorf("expected olive oil and salted butter missing from Squash Toast, got %+v", results[2])
+	}
+
+	results, err = Pantry(idx, []string{"squash"}, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := slices.IndexFunc(results, func(r PantryResult) bool { return r.Webpath == "SquashSoup" })
+	if i < 0 || !slices.Equal(results[i].Missing, []string{"1 onion", "salt"}) {
+		t.Errorf("expected the missing ingredients listed, got %+v", results)
+	}
+}
+
+func TestSearchRecipesFacets(t *testing.T) {
+	t.Parallel()
+
+	idx := NewIndex([]string{"en"}, nil)
+	defer idx.Close()
+
+	quick, slow := 20.0, 90.0
+	for _, r := range []Recipe{
+		{Name: "Squash Soup", Webpath: "SquashSoup", Tags: []string{"Soup", "Vegetable"}, Course: "Dinner", Time: &slow},
+		{Name: "Miso Soup", Webpath: "MisoSoup", Tags: []string{"Soup"}, Course: "Lunch", Time: &quick},
+		{Name: "Salad", Webpath: "Salad", Tags: []string{"Vegetable"}},
+	} {
+		if err := UpsertRecipe(idx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results, err := SearchRecipes(idx, "", Options{Filters: Filters{Tags: []string{"Soup"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results.Total != 2 {
+		t.Fatalf("expected 2 soups, got %d", results.Total)
+	}
+
+	counts := map[string]int{}
+	for _, facet := range results.Facets {
+		for _, value := range facet.Values {
+			counts[facet.Field+":"+value.Value] = value.Count
+		}
+	}
+	expected := map[string]int{
+		"tags:Soup": 2, "tags:Vegetable": 1,
+		"course:Dinner": 1, "course:Lunch": 1,
+		"time:30": 1, "time:60+": 1,
+	}
+	for key, count := range expected {
+		if counts[key] != count {
+			t.Errorf("expected %s count %d, got %d", key, count, counts[key])
+		}
+	}
+
+	results, err = SearchRecipes(idx, "soup", Options{Filters: Filters{Time: "30"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results.Hits) != 1 || results.Hits[0].Webpath != "MisoSoup" {
+		t.Errorf("expected Miso Soup within 30 minutes, got %+v", results.Hits)
+	}
+}
+
+func TestSearchRecipesPages(t *testing.T) {
+	t.Parallel()
+
+	idx := NewIndex([]string{"en"}, nil)
+	defer idx.Close()
+
+	pageSize := PageSize
+	for i := range pageSize + 5 {
+		name := fmt.Sprintf("Soup %02d", i)
+		recipe := Recipe{Name: name, Webpath: strings.ReplaceAll(name, " ", ""), Tags: []string{"Soup"}}
+		if err := UpsertRecipe(idx, recipe); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	first, err := SearchRecipes(idx, "soup", Options{Sort: SortName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first.Hits) != pageSize || !first.More || first.Hits[0].Webpath != "Soup00" {
+		t.Fatalf("unexpected first page: %d hits, more %v", len(first.Hits), first.More)
+	}
+
+	second, err := SearchRecipes(idx, "soup", Options{Sort: SortName, Page: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(second.Hits) != 5 || second.More || second.Hits[0].Webpath != fmt.Sprintf("Soup%02d", pageSize) {
+		t.Errorf("unexpected second page: %d hits, more %v", len(second.Hits), second.More)
+	}
+
+	groups, more, err := GetRecipesGroupedByTag(idx, SortName, 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 || len(groups[0].Recipes) != pageSize+5 || more {
+		t.Errorf("expected every soup in one group, got %d groups, more %v", len(groups), more)
+	}
+}
+
+func TestSearchRecipesFuzzy(t *testing.T) {
+	t.Parallel()
+
+	idx := NewIndex([]string{"en"}, nil)
+	defer idx.Close()
+
+	for _, r := range []Recipe{
+		{Name: "Sweet Lasagna", Webpath: "SweetLasagna", Markdown: "noodles, ricotta"},
+		{Name: "Squash Soup", Webpath: "SquashSoup", Markdown: "butternut squash, onion"},
+	} {
+		if err := UpsertRecipe(idx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results, err := SearchRecipes(idx, "lasagne", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !results.Fuzzy || len(results.Hits) != 1 || results.Hits[0].Webpath != "SweetLasagna" {
+		t.Errorf("expected a fuzzy match of SweetLasagna, got %+v", results)
+	}
+	if results.Corrected != "lasagna" {
+		t.Errorf("expected the correction lasagna, got %q", results.Corrected)
+	}
+
+	results, err = SearchRecipes(idx, "squash", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results.Fuzzy || results.Corrected != "" {
+		t.Errorf("expected an exact match, got %+v", results)
+	}
+
+	// The words of deleted recipes are neither known nor suggested.
+	if err := UpsertRecipe(idx, Recipe{Name: "Pumpkin Squish", Webpath: "PumpkinSquish", Markdown: "pumpkin"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteRecipe(idx, "PumpkinSquish"); err != nil {
+		t.Fatal(err)
+	}
+	for q, expected := range map[string]string{"squish": "squash", "pumpkn": ""} {
+		corrected, err := Correct(idx, q, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if corrected != expected {
+			t.Errorf("expected %q corrected to %q, got %q", q, expected, corrected)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	t.Parallel()
+
+	idx := NewIndex([]string{"en"}, nil)
+	defer idx.Close()
+
+	for _, r := range []Recipe{
+		{Name: "Squash Soup", Webpath: "SquashSoup", Tags: []string{"Soup"}, Ingredients: []string{"2 cups butternut squash", "1 onion"}},
+		{Name: "Split Pea Soup", Webpath: "SplitPeaSoup", Tags: []string{"Soup"}, Ingredients: []string{"1 lb split peas"}},
+		{Name: "Pasta", Webpath: "Pasta", Tags: []string{"Pasta"}, Ingredients: []string{"spaghetti"}},
+	} {
+		r.Markdown = "## Ingredients\n\n- " + strings.Join(r.Ingredients, "\n- ")
+		if err := UpsertRecipe(idx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	suggestions, err := Suggest(idx, "s", 5, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"Split Pea Soup", "Squash Soup"}; !slices.Equal(suggestions.Names, expected) {
+		t.Errorf("expected names %v, got %v", expected, suggestions.Names)
+	}
+	if expected := []string{"Soup"}; !slices.Equal(suggestions.Tags, expected) {
+		t.Errorf("expected tags %v, got %v", expected, suggestions.Tags)
+	}
+	if expected := []string{"spaghetti", "split", "squash"}; !slices.Equal(suggestions.Ingredients, expected) {
+		t.Errorf("expected ingredients %v, got %v", expected, suggestions.Ingredients)
+	}
+
+	suggestions, err = Suggest(idx, "butternut sq", 5, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"butternut squash"}; !slices.Equal(suggestions.Ingredients, expected) {
+		t.Errorf("expected ingredients %v, got %v", expected, suggestions.Ingredients)
+	}
+}
+
+func TestSynonyms(t *testing.T) {
+	t.Parallel()
+
+	synonyms, err := ParseSynonyms(strings.NewReader("# Family words\neggplant, aubergine\n\nscallion, green onion\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := NewIndex([]string{"en"}, synonyms)
+	defer idx.Close()
+
+	for _, r := range []Recipe{
+		{Name: "Aubergine Curry", Webpath: "AubergineCurry", Markdown: "aubergines, rice"},
+		{Name: "Fried Rice", Webpath: "FriedRice", Markdown: "rice, sliced scallions"},
+	} {
+		if err := UpsertRecipe(idx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for query, expected := range map[string]string{
+		"eggplant":     "AubergineCurry",
+		"green onions": "FriedRice",
+	} {
+		results, err := SearchRecipes(idx, query, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results.Hits) != 1 || results.Hits[0].Webpath != expected {
+			t.Errorf("expected %q to find %s, got %+v", query, expected, results.Hits)
+		}
+	}
+}
+
+func TestSearchRecipesBoosts(t *testing.T) {
+	t.Parallel()
+
+	idx := NewIndex([]string{"en"}, nil)
+	defer idx.Close()
+
+	for _, r := range []Recipe{
+		{Name: "Soup", Webpath: "Body", Markdown: "squash, squash and more squash"},
+		{Name: "Soup", Webpath: "Tag", Tags: []string{"Squash"}, Markdown: "soup"},
+		{Name: "Squash", Webpath: "Name", Markdown: "soup"},
+	} {
+		if err := UpsertRecipe(idx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	webpaths := func(boosts Boosts) []string {
+		results, err := SearchRecipes(idx, "squash", Options{Boosts: boosts})
+		if err != nil {
+			t.Fatal(err)
+		}
+		webpaths := []string{}
+		for _, r := range results.Hits {
+			webpaths = append(webpaths, r.Webpath)
+		}
+		return webpaths
+	}
+
+	if expected, got := []string{"Name", "Tag", "Body"}, webpaths(Boosts{}); !slices.Equal(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	if expected, got := []string{"Body", "Tag", "Name"}, webpaths(Boosts{Name: 1, Tags: 5, Body: 25}); !slices.Equal(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestLanguages(t *testing.T) {
+	t.Parallel()
+
+	languages := []string{"en", "de", "it"}
+	idx := NewIndex(languages, nil)
+	defer idx.Close()
+
+	recipes := []struct {
+		name, markdown, language string
+	}{
+		{"Potato Salad", "Boil the potatoes and toss them with the dressing.", "en"},
+		{"Kartoffelsalat", "Die Kartoffeln kochen und mit dem Dressing mischen.", "de"},
+		{"Insalata di patate", "Cuocere le patate e condirle con il condimento.", "it"},
+	}
+	for _, r := range recipes {
+		if detected := DetectLanguage(r.markdown, languages); detected != r.language {
+			t.Errorf("expected %s to be detected as %s, got %q", r.name, r.language, detected)
+		}
+		if err := UpsertRecipe(idx, Recipe{Name: r.name, Webpath: r.name, Markdown: r.markdown, Language: r.language}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Each query is stemmed the way the recipes in its language were.
+	for query, expected := range map[string]string{
+		"potato":    "Potato Salad",
+		"kartoffel": "Kartoffelsalat",
+		"patata":    "Insalata di patate",
+	} {
+		results, err := SearchRecipes(idx, query, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results.Hits) != 1 || results.Hits[0].Webpath != expected {
+			t.Errorf("expected %q to find %s, got %+v", query, expected, results.Hits)
+		}
+	}
+
+	results, err := SearchRecipes(idx, "", Options{Filters: Filters{Language: "de"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results.Hits) != 1 || results.Hits[0].Webpath != "Kartoffelsalat" {
+		t.Errorf("expected the German recipe, got %+v", results.Hits)
+	}
+
+	if got, _ := ListLanguages(idx); !slices.Equal(got, []string{"de", "en", "it"}) {
+		t.Errorf("expected languages de, en, it, got %v", got)
+	}
+
+	if err := DeleteRecipe(idx, "Insalata di patate"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ListLanguages(idx); !slices.Equal(got, []string{"de", "en"}) {
+		t.Errorf("expected the deleted recipe's language gone, got %v", got)
+	}
+}
+
+func TestRelated(t *testing.T) {
+	t.Parallel()
+
+	idx := NewIndex([]string{"en"}, nil)
+	defer idx.Close()
+
+	for _, r := range []Recipe{
+		{Name: "Squash Soup", Webpath: "SquashSoup", Tags: []string{"Soup"}, Ingredients: []string{"butternut squash", "onion", "stock"}},
+		{Name: "Roast Squash", Webpath: "RoastSquash", Tags: []string{"Side"}, Ingredients: []string{"butternut squash", "olive oil"}},
+		{Name: "Onion Soup", Webpath: "OnionSoup", Tags: []string{"Soup"}, Ingredients: []string{"onion", "stock", "cheese"}},
+		{Name: "Lemonade", Webpath: "Lemonade", Tags: []string{"Drink"}, Ingredients: []string{"lemons", "sugar"}},
+	} {
+		r.Markdown = strings.Join(r.Ingredients, "\n")
+		if err := UpsertRecipe(idx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	related, err := Related(idx, "SquashSoup", RelatedWeights{Tags: 3, Ingredients: 2, Terms: 1}, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	webpaths := []string{}
+	for _, r := range related {
+		webpaths = append(webpaths, r.Webpath)
+	}
+	// Onion Soup shares the tag and two ingredients, Lemonade nothing.
+	if expected := []string{"OnionSoup", "RoastSquash"}; !slices.Equal(webpaths, expected) {
+		t.Errorf("expected %v, got %v", expected, webpaths)
+	}
+
+	related, err = Related(idx, "SquashSoup", RelatedWeights{Ingredients: 1}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(related) != 1 {
+		t.Errorf("expected 1 related recipe, got %v", related)
+	}
+}
+
+func TestRecentRecipes(t *testing.T) {
+	t.Parallel()
+
+	idx := NewIndex([]string{"en"}, nil)
+	defer idx.Close()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for i, r := range []Recipe{
+		{Name: "Squash Soup", Webpath: "SquashSoup", Tags: []string{"Soup"}},
+		{Name: "Onion Soup", Webpath: "OnionSoup", Tags: []string{"Soup"}},
+		{Name: "Lemonade", Webpath: "Lemonade", Tags: []string{"Drink"}},
+	} {
+		r.Added = now.Add(-time.Hour)
+		r.Modified = now.Add(time.Duration(i) * time.Minute)
+		if err := UpsertRecipe(idx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	recent, err := RecentRecipes(idx, "", 2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recent) != 2 || recent[0].Webpath != "Lemonade" || recent[1].Webpath != "OnionSoup" {
+		t.Fatalf("expected the two most recently modified recipes, got %+v", recent)
+	}
+	if !recent[0].Modified.Equal(now.Add(2*time.Minute)) || !recent[0].Added.Equal(now.Add(-time.Hour)) {
+		t.Errorf("expected the recipe's times, got added %v, modified %v", recent[0].Added, recent[0].Modified)
+	}
+
+	soups, err := RecentRecipes(idx, "Soup", 10, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(soups) != 2 || soups[0].Webpath != "OnionSoup" {
+		t.Errorf("expected the soups, got %+v", soups)
+	}
+}
+
+func TestVisibility(t *testing.T) {
+	t.Parallel()
+
+	idx := NewIndex([]string{"en"}, nil)
+	defer idx.Close()
+
+	for _, r := range []Recipe{
+		{Name: "Squash Soup", Webpath: "SquashSoup", Tags: []string{"Soup"}, Markdown: "squash"},
+		{Name: "Secret Soup", Webpath: "SecretSoup", Tags: []string{"Soup", "Secret"}, Markdown: "squash saffron", Visibility: VisibilityPrivate},
+		{Name: "Squash Pie", Webpath: "SquashPie", Tags: []string{"Pie"}, Markdown: "squash", Visibility: VisibilityUnlisted},
+	} {
+		if err := UpsertRecipe(idx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	recipe, err := GetRecipe(idx, "SquashSoup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recipe.Visibility != VisibilityPublic || !recipe.Listed() {
+		t.Errorf("expected recipes to be public by default, got %q", recipe.Visibility)
+	}
+
+	results, err := SearchRecipes(idx, "squash", Options{Filters: Filters{Public: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results.Hits) != 1 || results.Hits[0].Webpath != "SquashSoup" {
+		t.Errorf("expected only the public recipe, got %+v", results.Hits)
+	}
+	results, err = SearchRecipes(idx, "squash", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results.Hits) != 3 {
+		t.Errorf("expected every recipe, got %+v", results.Hits)
+	}
+
+	// Corrections only use the words of the recipes the user can see.
+	for _, test := range []struct {
+		q         string
+		public    bool
+		corrected string
+	}{
+		{q: "saffrom", public: true, corrected: ""},
+		{q: "saffrom", public: false, corrected: "saffron"},
+		{q: "squosh", public: true, corrected: "squash"},
+	} {
+		results, err := SearchRecipes(idx, test.q, Options{Filters: Filters{Public: test.public}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if results.Corrected != test.corrected {
+			t.Errorf("%q, public %v: expected the correction %q, got %q", test.q, test.public, test.corrected, results.Corrected)
+		}
+		for _, hit := range results.Hits {
+			if test.public && hit.Webpath == "SecretSoup" {
+				t.Errorf("%q: expected no private recipe, got %+v", test.q, results.Hits)
+			}
+		}
+	}
+
+	groups, _, err := GetRecipesGroupedByTag(idx, SortName, 1, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 || groups[0].TagName != "Soup" || len(groups[0].Recipes) != 1 {
+		t.Errorf("expected only the public soup, got %+v", groups)
+	}
+
+	tags, err := ListTags(idx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(tags, []string{"Soup"}) {
+		t.Errorf("expected only the tags of public recipes, got %v", tags)
+	}
+
+	recent, err := RecentRecipes(idx, "", 10, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recent) != 1 || recent[0].Webpath != "SquashSoup" {
+		t.Errorf("expected only the public recipe, got %+v", recent)
+	}
+
+	for value, want := range map[string]string{"": VisibilityPublic, " Private": VisibilityPrivate, "unlisted": VisibilityUnlisted} {
+		if got, err := ParseVisibility(value); err != nil || got != want {
+			t.Errorf("ParseVisibility(%q) = %q, %v, expected %q", value, got, err, want)
+		}
+	}
+	if _, err := ParseVisibility("secret"); err == nil {
+		t.Error("expected an error for an unknown visibility")
+	}
+}
+
+func TestTagsOfDeletedRecipes(t *testing.T) {
+	t.Parallel()
+
+	idx := NewIndex([]string{"en"}, nil)
+	defer idx.Close()
+
+	for _, r := range []Recipe{
+		{Name: "Carrot Cake", Webpath: "CarrotCake", Tags: []string{"Cake"}},
+		{Name: "Squash Soup", Webpath: "SquashSoup", Tags: []string{"Soup"}},
+		{Name: "Beef Stew", Webpath: "BeefStew", Tags: []string{"Stew"}},
+	} {
+		if err := UpsertRecipe(idx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := DeleteRecipe(idx, "CarrotCake"); err != nil {
+		t.Fatal(err)
+	}
+	// Squash Soup was re-tagged.
+	if err := UpsertRecipe(idx, Recipe{Name: "Squash Soup", Webpath: "SquashSoup", Tags: []string{"Stew"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	groups, _, err := GetRecipesGroupedByTag(idx, SortName, 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 || groups[0].TagName != "Stew" || len(groups[0].Recipes) != 2 {
+		t.Errorf("expected only the stews, got %+v", groups)
+	}
+
+	tags, err := ListTags(idx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(tags, []string{"Stew"}) {
+		t.Errorf("expected only the tags in use, got %v", tags)
+	}
+	suggestions, err := Suggest(idx, "s", 10, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(suggestions.Tags, []string{"Stew"}) {
+		t.Errorf("expected only the tags in use suggested, got %v", suggestions.Tags)
+	}
+}
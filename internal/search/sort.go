@@ -0,0 +1,31 @@
+package search
+
+// Sort orders search results and the recipes of each tag.
+type Sort string
+
+const (
+	// SortRelevance is by score for a query, otherwise by name.
+	SortRelevance Sort = ""
+	SortName      Sort = "name"
+	SortAdded     Sort = "added"
+	SortModified  Sort = "modified"
+	SortTime      Sort = "time"
+)
+
+// fields are the bleve sort fields, names break ties.
+func (s Sort) fields(hasQuery bool) []string {
+	switch s {
+	case SortName:
+		return []string{"webpath"}
+	case SortAdded:
+		return []string{"-added", "webpath"}
+	case SortModified:
+		return []string{"-modified", "webpath"}
+	case SortTime:
+		return []string{"time", "webpath"}
+	}
+	if hasQuery {
+		return []string{"-_score", "webpath"}
+	}
+	return []string{"webpath"}
+}
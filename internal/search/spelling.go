@@ -0,0 +1,259 @@
+package search
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+// spellingField indexes the words of the name and markdown without stemming,
+// for suggestions, corrections and fuzzy matching.
+const spellingField = "spelling"
+
+var wordPattern = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// words returns the lower case words of text.
+func words(text string) []string {
+	return wordPattern.FindAllString(strings.ToLower(text), -1)
+}
+
+// fuzziness is the number of edits allowed for a word to match another,
+// none for short words.
+func fuzziness(word string) int {
+	switch n := len([]rune(word)); {
+	case n < 4:
+		return 0
+	case n < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// fuzzyQuery matches recipes with every word of q or a word a few edits away
+// from it, so "lasagne" finds "lasagna".
+func fuzzyQuery(q string) query.Query {
+	queries := []query.Query{}
+	for _, word := range words(q) {
+		match := bleve.NewMatchQuery(word)
+		match.SetField(spellingField)
+		match.SetFuzziness(fuzziness(word))
+		queries = append(queries, match)
+	}
+	if len(queries) == 0 {
+		return nil
+	}
+	return bleve.NewConjunctionQuery(queries...)
+}
+
+// spellingTerms returns the words of all recipes with the number of recipes
+// using them, of only the public recipes when public is set.
+func spellingTerms(idx bleve.Index, public bool) (map[string]uint64, error) {
+	dict, err := idx.FieldDict(spellingField)
+	if err != nil {
+		return nil, err
+	}
+	defer dict.Close()
+
+	terms := map[string]uint64{}
+	for {
+		entry, err := dict.Next()
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			break
+		}
+		// Skip the words of deleted recipes, which stay with no count.
+		if entry.Count == 0 {
+			continue
+		}
+		terms[entry.Term] = entry.Count
+	}
+	if public {
+		return publicSpellingTerms(idx, len(terms))
+	}
+	return terms, nil
+}
+
+// publicSpellingTerms counts the public recipes using up to size words.  The
+// dictionary counts every recipe, so these are counted by a facet, as for the
+// tags.
+func publicSpellingTerms(idx bleve.Index, size int) (map[string]uint64, error) {
+	searchRequest := bleve.NewSearchRequest(Filters{Public: true}.apply(bleve.NewMatchAllQuery()))
+	searchRequest.Size = 0
+	searchRequest.AddFacet(spellingField, bleve.NewFacetRequest(spellingField, max(size, 1)))
+
+	results, err := idx.Search(searchRequest)
+	if err != nil {
+		return nil, err
+	}
+	terms := map[string]uint64{}
+	if result, ok := results.Facets[spellingField]; ok && result.Terms != nil {
+		for _, term := range result.Terms.Terms() {
+			terms[term.Term] = uint64(term.Count)
+		}
+	}
+	return terms, nil
+}
+
+// Correct replaces the words of q not found in any recipe with the most
+// common word within a few edits of it, only looking at the words of the
+// public recipes when public is set.  It returns "" when there is nothing to
+// correct.
+func Correct(idx bleve.Index, q string, public bool) (string, error) {
+	terms, err := spellingTerms(idx, public)
+	if err != nil {
+		return "", err
+	}
+
+	corrected := false
+	result := wordPattern.ReplaceAllStringFunc(q, func(word string) string {
+		lower := strings.ToLower(word)
+		if _, ok := terms[lower]; ok {
+			return word
+		}
+		best, bestDistance, bestCount := "", fuzziness(lower)+1, uint64(0)
+		for term, count := range terms {
+			distance := levenshtein(lower, term)
+			if distance < bestDistance || distance == bestDistance && (count > bestCount || count == bestCount && term < best) {
+				best, bestDistance, bestCount = term, distance, count
+			}
+		}
+		if best == "" {
+			return word
+		}
+		corrected = true
+		return best
+	})
+	if !corrected {
+		return "", nil
+	}
+	return result, nil
+}
+
+// levenshtein returns the number of single rune insertions, deletions and
+// substitutions to change a into b.
+func levenshtein(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	previous := make([]int, len(t)+1)
+	current := make([]int, len(t)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		current[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(t)]
+}
+
+type Suggestions struct {
+	Names       []string `json:"names"`
+	Tags        []string `json:"tags"`
+	Ingredients []string `json:"ingredients"`
+}
+
+// suggestCandidates is the number of recipes matching the prefix considered
+// for name and ingredient suggestions.
+var suggestCandidates = 50
+
+// Suggest returns up to limit recipe names, tags and ingredients completing
+// the prefix typed so far, of only the public recipes when public is set.
+// Ingredients complete the last word of the prefix.
+func Suggest(idx bleve.Index, prefix string, limit int, public bool) (*Suggestions, error) {
+	suggestions := &Suggestions{Names: []string{}, Tags: []string{}, Ingredients: []string{}}
+
+	typed := words(prefix)
+	if len(typed) == 0 {
+		return suggestions, nil
+	}
+	last := typed[len(typed)-1]
+
+	tags, err := ListTags(idx, public)
+	if err != nil {
+		return nil, err
+	}
+	for _, tag := range tags {
+		if len(suggestions.Tags) < limit && strings.HasPrefix(strings.ToLower(tag), strings.ToLower(strings.TrimSpace(prefix))) {
+			suggestions.Tags = append(suggestions.Tags, tag)
+		}
+	}
+
+	queries := []query.Query{}
+	for _, word := range typed[:len(typed)-1] {
+		match := bleve.NewMatchQuery(word)
+		match.SetField(spellingField)
+		queries = append(queries, match)
+	}
+	prefixQuery := bleve.NewPrefixQuery(last)
+	prefixQuery.SetField(spellingField)
+	queries = append(queries, prefixQuery)
+
+	searchRequest := bleve.NewSearchRequest(Filters{Public: public}.apply(bleve.NewConjunctionQuery(queries...)))
+	searchRequest.Fields = []string{"name", "ingredients"}
+	searchRequest.Size = suggestCandidates
+
+	results, err := idx.Search(searchRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	// Complete the last word with the words of the ingredients.
+	start := strings.Join(typed[:len(typed)-1], " ")
+	if start != "" {
+		start += " "
+	}
+	ingredients := map[string]bool{}
+	for _, hit := range results.Hits {
+		name, _ := hit.Fields["name"].(string)
+		if hasWords(words(name), typed) {
+			suggestions.Names = append(suggestions.Names, name)
+		}
+		for _, ingredient := range fieldStrings(hit.Fields["ingredients"]) {
+			for _, word := range words(ingredient) {
+				// Skip quantities.
+				if strings.HasPrefix(word, last) && strings.Trim(word, "0123456789") != "" {
+					ingredients[start+word] = true
+				}
+			}
+		}
+	}
+	for ingredient := range ingredients {
+		suggestions.Ingredients = append(suggestions.Ingredients, ingredient)
+	}
+	sort.Strings(suggestions.Names)
+	sort.Strings(suggestions.Ingredients)
+	suggestions.Names = suggestions.Names[:min(len(suggestions.Names), limit)]
+	suggestions.Ingredients = suggestions.Ingredients[:min(len(suggestions.Ingredients), limit)]
+
+	return suggestions, nil
+}
+
+// hasWords reports whether words contains the typed words, with the last one
+// possibly incomplete.
+func hasWords(words []string, typed []string) bool {
+	for i, word := range typed {
+		found := false
+		for _, w := range words {
+			if w == word || i == len(typed)-1 && strings.HasPrefix(w, word) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
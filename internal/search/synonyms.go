@@ -0,0 +1,155 @@
+package search
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2/analysis"
+	"github.com/blevesearch/bleve/v2/registry"
+)
+
+// synonymsAnalyzerType wraps an analyzer to replace each synonym with the
+// first word of its group, at index and query time, so searching for either
+// word finds both.
+const synonymsAnalyzerType = "synonyms"
+
+func init() {
+	registry.RegisterAnalyzer(synonymsAnalyzerType, synonymsAnalyzerConstructor)
+}
+
+// ParseSynonyms reads groups of words meaning the same thing, one comma
+// separated group per line.  Blank lines and lines starting with # are
+// skipped.
+func ParseSynonyms(r io.Reader) ([][]string, error) {
+	groups := [][]string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		group := []string{}
+		for _, word := range strings.Split(line, ",") {
+			if word = strings.TrimSpace(word); word != "" {
+				group = append(group, word)
+			}
+		}
+		if len(group) > 1 {
+			groups = append(groups, group)
+		}
+	}
+	return groups, scanner.Err()
+}
+
+// synonymRule replaces the terms of a synonym with the terms of the first
+// word of its group.
+type synonymRule struct {
+	from []string
+	to   []string
+}
+
+type synonymsAnalyzer struct {
+	analyzer analysis.Analyzer
+	// rules are longest first, so "green onion" is replaced before "onion".
+	rules []synonymRule
+}
+
+func synonymsAnalyzerConstructor(config map[string]interface{}, cache *registry.Cache) (analysis.Analyzer, error) {
+	name, ok := config["analyzer"].(string)
+	if !ok {
+		return nil, fmt.Errorf("synonyms analyzer must specify analyzer")
+	}
+	analyzer, err := cache.AnalyzerNamed(name)
+	if err != nil {
+		return nil, err
+	}
+
+	groups, ok := config["synonyms"].([][]string)
+	if !ok {
+		return nil, fmt.Errorf("synonyms analyzer must specify synonyms")
+	}
+
+	termsOf := func(text string) []string {
+		terms := []string{}
+		for _, token := range analyzer.Analyze([]byte(text)) {
+			terms = append(terms, string(token.Term))
+		}
+		return terms
+	}
+
+	rules := []synonymRule{}
+	for _, group := range groups {
+		to := termsOf(group[0])
+		if len(to) == 0 {
+			continue
+		}
+		for _, word := range group[1:] {
+			from := termsOf(word)
+			if len(from) > 0 && strings.Join(from, " ") != strings.Join(to, " ") {
+				rules = append(rules, synonymRule{from: from, to: to})
+			}
+		}
+	}
+	sort.SliceStable(rules, func(i, j int) bool {
+		return len(rules[i].from) > len(rules[j].from)
+	})
+
+	return &synonymsAnalyzer{analyzer: analyzer, rules: rules}, nil
+}
+
+func (a *synonymsAnalyzer) Analyze(input []byte) analysis.TokenStream {
+	tokens := a.analyzer.Analyze(input)
+	if len(a.rules) == 0 {
+		return tokens
+	}
+
+	result := make(analysis.TokenStream, 0, len(tokens))
+	// shift moves the positions after a replacement of a different length.
+	shift := 0
+	for i := 0; i < len(tokens); {
+		rule := a.match(tokens[i:])
+		if rule == nil {
+			token := *tokens[i]
+			token.Position += shift
+			result = append(result, &token)
+			i++
+			continue
+		}
+
+		first, last := tokens[i], tokens[i+len(rule.from)-1]
+		for j, term := range rule.to {
+			result = append(result, &analysis.Token{
+				Start:    first.Start,
+				End:      last.End,
+				Term:     []byte(term),
+				Position: first.Position + shift + j,
+				Type:     first.Type,
+			})
+		}
+		shift += len(rule.to) - len(rule.from)
+		i += len(rule.from)
+	}
+	return result
+}
+
+func (a *synonymsAnalyzer) match(tokens analysis.TokenStream) *synonymRule {
+	for i, rule := range a.rules {
+		if len(rule.from) > len(tokens) {
+			continue
+		}
+		found := true
+		for j, term := range rule.from {
+			if string(tokens[j].Term) != term {
+				found = false
+				break
+			}
+		}
+		if found {
+			return &a.rules[i]
+		}
+	}
+	return nil
+}
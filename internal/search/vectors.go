@@ -0,0 +1,63 @@
+package search
+
+import (
+	"math"
+	"sync"
+)
+
+// Vectors holds an embedding for each recipe, keyed by webpath, next to the
+// bleve index.
+type Vectors struct {
+	mu      sync.RWMutex
+	vectors map[string][]float32
+}
+
+func NewVectors() *Vectors {
+	return &Vectors{vectors: map[string][]float32{}}
+}
+
+func (v *Vectors) Set(webpath string, vector []float32) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.vectors[webpath] = vector
+}
+
+func (v *Vectors) Delete(webpath string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.vectors, webpath)
+}
+
+func (v *Vectors) Len() int {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return len(v.vectors)
+}
+
+// Similarities returns the cosine similarity of query to every recipe.
+func (v *Vectors) Similarities(query []float32) map[string]float64 {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	similarities := make(map[string]float64, len(v.vectors))
+	for webpath, vector := range v.vectors {
+		similarities[webpath] = cosine(query, vector)
+	}
+	return similarities
+}
+
+func cosine(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
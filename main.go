@@ -1,17 +1,19 @@
 package main
 
 import (
+	"context"
 	"encoding/hex"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"path/filepath"
 	"syscall"
 
 	"cookbook/internal/auth"
 	"cookbook/internal/core"
 	"cookbook/internal/handlers"
-	"cookbook/internal/search"
 
 	"github.com/gorilla/csrf"
 	"github.com/gorilla/securecookie"
@@ -36,17 +38,79 @@ func serve(configPath string) {
 		authentication = core.Auth{AddHandlers: core.AddHandlersNop}
 	}
 
+	fetcher, err := core.NewFetcher(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	embeddings, err := core.NewEmbeddings(context.Background(), cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	tokens, err := core.NewTokens(cfg.Server.TokensPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// OIDC users' roles are only known when they sign in.
+	var users *core.Users
+	if cfg.OIDC != nil {
+		users, err = core.NewUsers(filepath.Join(cfg.Server.StatePath, "users.json"))
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	shares, err := core.NewShares(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if shares == nil {
+		log.Println("Share links are disabled, set Server.ShareSecrets or Server.SessionSecrets to enable them")
+	}
+
+	index := core.NewIndex(cfg)
+
+	webhooks, err := core.NewWebhooks(index, cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	var state = core.State{
-		Index:        search.NewIndex(cfg.Server.Language),
+		Index:        index,
 		SessionStore: auth.NewSessionStore(cfg.Server.SessionSecrets, cfg.Server.SecureCookies),
 		Config:       cfg,
 		Auth:         authentication,
+		BulkImports:  core.NewBulkImportJobs(),
+		Fetcher:      fetcher,
+		Embeddings:   embeddings,
+		Related:      core.NewRelatedRecipes(index, cfg),
+		Tokens:       tokens,
+		Users:        users,
+		Shares:       shares,
+		Webhooks:     webhooks,
 	}
 	defer state.Index.Close()
 
+	if embeddings != nil {
+		go embeddings.Run(context.Background())
+	}
+	go state.Related.Run(context.Background())
+	if webhooks != nil {
+		go webhooks.Run(context.Background())
+	}
 	state.LoadRecipes()
 	go state.MonitorRecipesDirectory()
 
+	if cfg.Server.RequireLoginToView && authentication.LoginUrl == "" {
+		log.Fatal("Server.RequireLoginToView needs OIDC or FormBasedAuthUsers")
+	}
+
+	if cfg.Server.BaseURL == "" {
+		log.Println("Warning: Server.BaseURL is not set, links in feeds and share links use the Host header of each request")
+	}
+
 	serveMux := http.NewServeMux()
 
 	fs := http.FileServer(http.Dir("static"))
@@ -63,18 +127,40 @@ func serve(configPath string) {
 	csrfMiddleware := csrf.Protect(
 		csrfKey,
 		csrf.Secure(cfg.Server.SecureCookies),
+		csrf.ErrorHandler(http.HandlerFunc(auth.CSRFFailure)),
 	)
 
+	var handler http.Handler = serveMux
+	if cfg.Server.RequireLoginToView {
+		handler = auth.RequireLoginToView(state, os.DirFS("static"), handler)
+	}
+
 	log.Println("Server starting on", state.Config.Server.Address)
 	err = http.ListenAndServe(
 		state.Config.Server.Address,
-		csrfMiddleware(serveMux),
+		auth.SkipCSRFForBearer(csrfMiddleware(handler)),
 	)
 	if err != nil {
 		log.Fatal(err)
 	}
 }
 
+func proposeTags(configPath string, write bool) {
+	cfg := core.LoadConfig(configPath)
+
+	state := core.State{
+		Index:  core.NewIndex(cfg),
+		Config: cfg,
+	}
+	defer state.Index.Close()
+
+	state.LoadRecipes()
+
+	if err := state.ProposeTags(context.Background(), os.Stdout, write); err != nil {
+		log.Fatal(err)
+	}
+}
+
 func main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
@@ -83,6 +169,8 @@ func main() {
 	passwordHash := flag.Bool("p", false, "Hash password for form based authentication.")
 	help := flag.Bool("h", false, "Print help.")
 	key := flag.Bool("k", false, "Generates a new key which can be used for secrets in config.")
+	tags := flag.Bool("t", false, "Propose tags for recipes tagged Other using the config LLM. Ex. -c config.toml -t")
+	writeTags := flag.Bool("w", false, "With -t, add the proposed tags to the recipe files.")
 	flag.Parse()
 
 	if *help {
@@ -106,6 +194,11 @@ func main() {
 		return
 	}
 
+	if *configPath != "" && *tags {
+		proposeTags(*configPath, *writeTags)
+		return
+	}
+
 	if *configPath != "" {
 		serve(*configPath)
 		return
@@ -0,0 +1,18 @@
+// Adds a suggested tag chip to the tags: line of the recipe being edited.
+function addTag(chip) {
+    const body = chip.closest("form").querySelector("textarea[name=body]");
+    const tag = chip.dataset.tag;
+    const lines = body.value.split("\n");
+    const i = lines.findIndex(line => line.startsWith("tags:"));
+    if (i === -1) {
+        lines.unshift("tags: " + tag, "");
+    } else {
+        const tags = lines[i].slice(5).split(",").map(t => t.trim()).filter(t => t !== "");
+        if (!tags.includes(tag)) {
+            tags.push(tag);
+        }
+        lines[i] = "tags: " + tags.join(", ");
+    }
+    body.value = lines.join("\n");
+    chip.remove();
+}